@@ -2,7 +2,13 @@ package assets
 
 import "embed"
 
-//go:embed template.css propuesta.yaml html_template.yaml logo.svg presupuesto.yaml
+// TemplatesVersion identifies the embedded templates; bump it whenever
+// template.css, propuesta.yaml, html_template.yaml, presupuesto.yaml,
+// presupuesto.example.json, presupuesto.html.tmpl or logo.svg change, and
+// add the SHA-256 of each replaced file to template_hashes.json
+const TemplatesVersion = "6"
+
+//go:embed template.css propuesta.yaml html_template.yaml logo.svg presupuesto.yaml presupuesto.example.json presupuesto.html.tmpl models.json config.yaml template_hashes.json
 var FS embed.FS
 
 // GetCSS returns the embedded CSS template
@@ -30,3 +36,28 @@ func GetPresupuestoYAML() ([]byte, error) {
 	return FS.ReadFile("presupuesto.yaml")
 }
 
+// GetPresupuestoExample returns the embedded example cotización
+func GetPresupuestoExample() ([]byte, error) {
+	return FS.ReadFile("presupuesto.example.json")
+}
+
+// GetCotizacionTemplate returns the embedded cotización HTML template
+func GetCotizacionTemplate() ([]byte, error) {
+	return FS.ReadFile("presupuesto.html.tmpl")
+}
+
+// GetModelCatalog returns the embedded fallback model catalog
+func GetModelCatalog() ([]byte, error) {
+	return FS.ReadFile("models.json")
+}
+
+// GetDefaultConfig returns the embedded default configuration
+func GetDefaultConfig() ([]byte, error) {
+	return FS.ReadFile("config.yaml")
+}
+
+// GetTemplateHashes returns the hashes of the templates shipped by previous
+// template versions, keyed by file and then by hash
+func GetTemplateHashes() ([]byte, error) {
+	return FS.ReadFile("template_hashes.json")
+}
@@ -2,58 +2,304 @@ package ai
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 
+	"orgmprop/internal/config"
 	"orgmprop/internal/logger"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 )
 
-// Client encapsulates the Anthropic client
+// Client encapsulates the Anthropic client and implements Provider
 type Client struct {
 	client *anthropic.Client
 	model  string
+	retry  config.RetryConfig
 }
 
 // NewClient creates a new AI client
-func NewClient(apiKey, model string) *Client {
+func NewClient(apiKey, model string, retry config.RetryConfig) *Client {
 	logger.Debug("Creando cliente Anthropic con modelo: %s", model)
-	client := anthropic.NewClient(option.WithAPIKey(apiKey))
+	// Retries are handled by withRetry so every attempt is logged
+	client := anthropic.NewClient(
+		option.WithAPIKey(apiKey),
+		option.WithMaxRetries(0),
+	)
 	return &Client{
 		client: client,
 		model:  model,
+		retry:  retry,
 	}
 }
 
-// GenerateProposal generates a proposal HTML using the AI model
-func (c *Client) GenerateProposal(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
-	logger.Debug("Generando propuesta con modelo: %s", c.model)
-	logger.Debug("System prompt length: %d", len(systemPrompt))
-	logger.Debug("User prompt length: %d", len(userPrompt))
+// Model returns the model used by the client
+func (c *Client) Model() string {
+	return c.model
+}
+
+// Generate generates a document using the AI model
+func (c *Client) Generate(ctx context.Context, req Request) (*Response, error) {
+	logger.Debug("Generando %s con modelo: %s", req.Kind, c.model)
+	return c.generate(ctx, req, c.sendTurn)
+}
+
+// GenerateStream generates a document using streaming
+func (c *Client) GenerateStream(ctx context.Context, req Request, onChunk func(string)) (*Response, error) {
+	logger.Debug("Generando %s con streaming, modelo: %s", req.Kind, c.model)
+	return c.generate(ctx, req, func(ctx context.Context, params anthropic.MessageNewParams) (*turnResult, error) {
+		return c.streamTurn(ctx, params, onChunk)
+	})
+}
+
+// turnResult is the outcome of a single Messages API call
+type turnResult struct {
+	text       string
+	toolUseID  string
+	toolInput  json.RawMessage
+	usage      Usage
+	stopReason string
+}
+
+// turnFunc sends a single Messages API call
+type turnFunc func(ctx context.Context, params anthropic.MessageNewParams) (*turnResult, error)
+
+// generate runs the request and, while the model stops at max_tokens, sends
+// continuation turns that prefill the text so far, stitching the results
+func (c *Client) generate(ctx context.Context, req Request, turn turnFunc) (*Response, error) {
+	logger.Debug("System prompt length: %d", len(req.SystemPrompt))
+	logger.Debug("User prompt length: %d", len(req.UserContent()))
+
+	if req.Tool != nil {
+		return c.generateTool(ctx, req, turn)
+	}
+
+	var text string
+	var usage Usage
+	var stopReason string
+
+	for continuation := 0; ; continuation++ {
+		messages := initialMessages(req)
+		if text != "" {
+			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(text)))
+		}
+
+		result, err := turn(ctx, c.newParams(req, messages))
+		if err != nil {
+			return nil, withUsage(err, usage)
+		}
+
+		text += result.text
+		usage.Add(result.usage)
+		stopReason = result.stopReason
+
+		if stopReason != string(anthropic.MessageStopReasonMaxTokens) {
+			break
+		}
+		if continuation >= req.MaxContinuations {
+			logger.Warn("Respuesta cortada por max_tokens tras %d continuaciones", continuation)
+			break
+		}
+
+		// The API rejects an assistant prefill that ends in whitespace
+		text = strings.TrimRight(text, " \t\r\n")
+		logger.Info("Respuesta cortada por max_tokens, enviando continuación %d de %d", continuation+1, req.MaxContinuations)
+	}
+
+	logger.Debug("Contenido generado, longitud: %d", len(text))
+	logUsage(usage)
+
+	// Clean up HTML if needed
+	text = cleanHTMLResponse(text)
+
+	return &Response{Text: text, Usage: usage, StopReason: stopReason}, nil
+}
+
+// generateTool forces the model to call req.Tool. When the tool input fails
+// validation, the errors are sent back as a tool result for one repair round.
+// Input truncated by max_tokens is returned as Text for the caller to repair.
+// Failures return a UsageError with the tokens billed and the model output.
+func (c *Client) generateTool(ctx context.Context, req Request, turn turnFunc) (*Response, error) {
+	messages := initialMessages(req)
+
+	var usage Usage
+	failed := func(err error) error {
+		logUsage(usage)
+		return withUsage(err, usage)
+	}
+	failedWith := func(err error, raw string) error {
+		logUsage(usage)
+		return &UsageError{Err: err, Usage: usage, Raw: raw}
+	}
 
+	for round := 0; ; round++ {
+		result, err := turn(ctx, c.newParams(req, messages))
+		if err != nil {
+			return nil, failed(err)
+		}
+		usage.Add(result.usage)
+
+		if result.stopReason == string(anthropic.MessageStopReasonMaxTokens) {
+			if len(result.toolInput) == 0 {
+				return nil, failedWith(fmt.Errorf("salida de la herramienta %s truncada por max_tokens (%d tokens); aumenta max_tokens.%s", req.Tool.Name, req.OutputLimit(), req.Kind), result.text)
+			}
+			logger.Warn("Entrada de %s truncada por max_tokens (%d tokens); se devuelve para reparar", req.Tool.Name, req.OutputLimit())
+			logUsage(usage)
+			return &Response{Text: string(result.toolInput), Usage: usage, StopReason: result.stopReason}, nil
+		}
+		if result.toolInput == nil {
+			return nil, failedWith(fmt.Errorf("el modelo no llamó la herramienta %s", req.Tool.Name), result.text)
+		}
+
+		logger.Debug("Herramienta %s llamada, entrada de %d bytes", req.Tool.Name, len(result.toolInput))
+
+		verr := validateToolInput(req.Tool, result.toolInput)
+		if verr == nil {
+			logUsage(usage)
+			return &Response{Text: string(result.toolInput), ToolInput: result.toolInput, Usage: usage, StopReason: result.stopReason}, nil
+		}
+		if round >= toolRepairRounds {
+			return nil, failedWith(fmt.Errorf("salida inválida tras %d ronda de reparación: %w", toolRepairRounds, verr), string(result.toolInput))
+		}
+
+		logger.Warn("Salida de %s inválida, solicitando reparación: %v", req.Tool.Name, verr)
+
+		var input interface{}
+		if err := json.Unmarshal(result.toolInput, &input); err != nil {
+			return nil, failed(fmt.Errorf("entrada de herramienta inválida: %w", err))
+		}
+		messages = append(messages,
+			anthropic.NewAssistantMessage(anthropic.NewToolUseBlockParam(result.toolUseID, req.Tool.Name, input)),
+			anthropic.NewUserMessage(anthropic.NewToolResultBlock(result.toolUseID, toolRepairPrompt(verr), true)),
+		)
+	}
+}
+
+// newParams builds the message params for a conversation
+func (c *Client) newParams(req Request, messages []anthropic.MessageParam) anthropic.MessageNewParams {
 	// Create message params using the F helper
 	params := anthropic.MessageNewParams{
 		Model:     anthropic.F(anthropic.Model(c.model)),
-		MaxTokens: anthropic.F(int64(8192)),
-		Messages: anthropic.F([]anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(userPrompt)),
-		}),
+		MaxTokens: anthropic.F(req.OutputLimit()),
+		Messages:  anthropic.F(messages),
 		System: anthropic.F([]anthropic.TextBlockParam{
+			cachedTextBlock(req.SystemPrompt),
+		}),
+	}
+
+	// Force the tool call when the request has a Tool
+	if req.Tool != nil {
+		params.Tools = anthropic.F([]anthropic.ToolParam{
 			{
-				Type: anthropic.F(anthropic.TextBlockParamTypeText),
-				Text: anthropic.F(systemPrompt),
+				Name:        anthropic.F(req.Tool.Name),
+				Description: anthropic.F(req.Tool.Description),
+				InputSchema: anthropic.F[interface{}](req.Tool.InputSchema),
 			},
+		})
+		params.ToolChoice = anthropic.F[anthropic.ToolChoiceUnionParam](anthropic.ToolChoiceToolParam{
+			Type: anthropic.F(anthropic.ToolChoiceToolTypeTool),
+			Name: anthropic.F(req.Tool.Name),
+		})
+	}
+
+	return params
+}
+
+// initialMessages builds the conversation history followed by the current
+// user turn. The last history turn is a cache breakpoint, so a growing
+// conversation only pays full price for the newest turns.
+func initialMessages(req Request) []anthropic.MessageParam {
+	messages := make([]anthropic.MessageParam, 0, len(req.History)+1)
+	for i, message := range req.History {
+		block := anthropic.NewTextBlock(message.Content)
+		if i == len(req.History)-1 {
+			block = cachedTextBlock(message.Content)
+		}
+
+		if message.Role == RoleAssistant {
+			messages = append(messages, anthropic.NewAssistantMessage(block))
+		} else {
+			messages = append(messages, anthropic.NewUserMessage(block))
+		}
+	}
+
+	return append(messages, userMessage(req))
+}
+
+// userMessage builds the current user turn. The cached prefix goes in its own
+// block with a cache breakpoint so only the variable part is billed in full.
+func userMessage(req Request) anthropic.MessageParam {
+	var blocks []anthropic.ContentBlockParamUnion
+	if req.CachedPrefix != "" {
+		blocks = append(blocks, cachedTextBlock(req.CachedPrefix))
+	}
+	for _, attachment := range req.Attachments {
+		blocks = append(blocks, attachmentBlocks(attachment)...)
+	}
+	blocks = append(blocks, anthropic.NewTextBlock(req.UserPrompt))
+
+	return anthropic.NewUserMessage(blocks...)
+}
+
+// attachmentBlocks converts an attachment into content blocks: PDFs as
+// documents, images as images and text files inline
+func attachmentBlocks(attachment Attachment) []anthropic.ContentBlockParamUnion {
+	label := anthropic.NewTextBlock("Archivo adjunto: " + attachment.Name)
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+
+	switch attachment.Kind {
+	case AttachmentPDF:
+		return []anthropic.ContentBlockParamUnion{label, anthropic.DocumentBlockParam{
+			Type: anthropic.F(anthropic.DocumentBlockParamTypeDocument),
+			Source: anthropic.F(anthropic.Base64PDFSourceParam{
+				Type:      anthropic.F(anthropic.Base64PDFSourceTypeBase64),
+				MediaType: anthropic.F(anthropic.Base64PDFSourceMediaTypeApplicationPDF),
+				Data:      anthropic.F(encoded),
+			}),
+		}}
+	case AttachmentImage:
+		return []anthropic.ContentBlockParamUnion{label, anthropic.NewImageBlockBase64(attachment.MediaType, encoded)}
+	}
+
+	return []anthropic.ContentBlockParamUnion{anthropic.NewTextBlock(attachment.inlineText())}
+}
+
+// cachedTextBlock returns a text block marked as a prompt cache breakpoint.
+// Everything up to and including the block (tools, system, earlier blocks) is
+// cached; prefixes shorter than the model's minimum are simply not cached.
+func cachedTextBlock(text string) anthropic.TextBlockParam {
+	return anthropic.TextBlockParam{
+		Type: anthropic.F(anthropic.TextBlockParamTypeText),
+		Text: anthropic.F(text),
+		CacheControl: anthropic.F(anthropic.CacheControlEphemeralParam{
+			Type: anthropic.F(anthropic.CacheControlEphemeralTypeEphemeral),
 		}),
 	}
+}
+
+// logUsage reports token usage, including prompt cache hits and misses
+func logUsage(usage Usage) {
+	logger.Debug("Tokens usados: %d entrada, %d salida", usage.InputTokens, usage.OutputTokens)
+	logger.Debug("Caché de prompt: %d tokens leídos (hit), %d tokens escritos (miss)", usage.CacheReadInputTokens, usage.CacheCreationInputTokens)
+}
 
+// sendTurn sends a single non-streaming request
+func (c *Client) sendTurn(ctx context.Context, params anthropic.MessageNewParams) (*turnResult, error) {
 	// Send request
 	logger.Debug("Enviando solicitud a Anthropic...")
-	resp, err := c.client.Messages.New(ctx, params)
+	var resp *anthropic.Message
+	err := withRetry(ctx, c.retry, "Solicitud a Anthropic", func() error {
+		var err error
+		resp, err = c.client.Messages.New(ctx, params)
+		return err
+	})
 	if err != nil {
 		logger.Error("Error en solicitud a Anthropic: %v", err)
-		return "", fmt.Errorf("error en la solicitud a Anthropic: %w", err)
+		return nil, fmt.Errorf("error en la solicitud a Anthropic: %w", err)
 	}
 
 	logger.Debug("Respuesta recibida, procesando contenido...")
@@ -61,82 +307,165 @@ func (c *Client) GenerateProposal(ctx context.Context, systemPrompt, userPrompt
 	// Extract content from response
 	if len(resp.Content) == 0 {
 		logger.Error("Respuesta vacía de Anthropic")
-		return "", fmt.Errorf("respuesta vacía de Anthropic")
+		return nil, fmt.Errorf("respuesta vacía de Anthropic")
 	}
 
-	// The content can be text or blocks, extract text
-	var content strings.Builder
-	for _, block := range resp.Content {
-		if block.Type == anthropic.ContentBlockTypeText {
-			content.WriteString(block.Text)
-		}
-	}
+	return turnFromMessage(resp), nil
+}
 
-	result := content.String()
-	logger.Debug("Contenido generado, longitud: %d", len(result))
+// streamTurn sends a single streaming request. A text stream that fails
+// midway is resumed with the text received so far as a prefill, so onChunk
+// never sees a chunk twice. A tool call cannot be prefilled and is restarted;
+// its chunks are only forwarded once past what was already shown.
+func (c *Client) streamTurn(ctx context.Context, params anthropic.MessageNewParams, onChunk func(string)) (*turnResult, error) {
+	isTool := len(params.Tools.Value) > 0
 
-	// Clean up HTML if needed
-	result = cleanHTMLResponse(result)
+	// Read and accumulate response
+	var message anthropic.Message
+	// received is the text of failed attempts a resumed stream continues
+	var received string
+	// billed is the usage of failed attempts
+	var billed Usage
+	// delivered counts the bytes of received and the current attempt passed
+	// to onChunk
+	delivered := 0
+	// shownSpace is whitespace passed to onChunk but trimmed from received
+	var shownSpace string
 
-	return result, nil
-}
+	err := withRetry(ctx, c.retry, "Stream de Anthropic", func() error {
+		attemptParams := params
+		if len(message.Content) > 0 || message.Usage.InputTokens > 0 {
+			partial := turnFromMessage(&message)
+			billed.Add(partial.usage)
 
-// GenerateProposalStream generates a proposal HTML using streaming
-func (c *Client) GenerateProposalStream(ctx context.Context, systemPrompt, userPrompt string, onChunk func(string)) (string, error) {
-	logger.Debug("Generando propuesta con streaming, modelo: %s", c.model)
+			if isTool {
+				logger.Warn("Reiniciando stream de la herramienta, descartando respuesta parcial")
+			} else {
+				text := received + partial.text
+				// The API rejects an assistant prefill that ends in whitespace
+				received = strings.TrimRight(text, " \t\r\n")
+				if delivered > len(received) {
+					shownSpace = text[len(received):min(delivered, len(text))] + shownSpace
+					delivered = len(received)
+				}
+				logger.Warn("Stream interrumpido, continuando desde %d caracteres recibidos", len(received))
+			}
+		}
+		if received != "" {
+			attemptParams.Messages = anthropic.F(withPrefill(params.Messages.Value, received))
+		}
+		message = anthropic.Message{}
+		streamed := len(received)
 
-	// Create message params using the F helper
-	params := anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.Model(c.model)),
-		MaxTokens: anthropic.F(int64(8192)),
-		Messages: anthropic.F([]anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(userPrompt)),
-		}),
-		System: anthropic.F([]anthropic.TextBlockParam{
-			{
-				Type: anthropic.F(anthropic.TextBlockParamTypeText),
-				Text: anthropic.F(systemPrompt),
-			},
-		}),
-	}
+		// Create stream
+		stream := c.client.Messages.NewStreaming(ctx, attemptParams)
+		defer stream.Close()
 
-	// Create stream
-	stream := c.client.Messages.NewStreaming(ctx, params)
+		completed := false
+		for stream.Next() {
+			event := stream.Current()
+			if err := message.Accumulate(event); err != nil {
+				return err
+			}
 
-	// Read and accumulate response
-	var fullResponse strings.Builder
-
-	for stream.Next() {
-		event := stream.Current()
-
-		// Process content_block_delta events
-		if event.Type == anthropic.MessageStreamEventTypeContentBlockDelta {
-			// Type assert Delta to access its fields
-			if delta, ok := event.Delta.(anthropic.ContentBlockDeltaEventDelta); ok {
-				if delta.Type == anthropic.ContentBlockDeltaEventDeltaTypeTextDelta {
-					fullResponse.WriteString(delta.Text)
-					if onChunk != nil {
-						onChunk(delta.Text)
+			switch event.Type {
+			case anthropic.MessageStreamEventTypeContentBlockDelta:
+				// Type assert Delta to access its fields
+				if delta, ok := event.Delta.(anthropic.ContentBlockDeltaEventDelta); ok && onChunk != nil {
+					chunk := delta.Text
+					if delta.Type == anthropic.ContentBlockDeltaEventDeltaTypeInputJSONDelta {
+						chunk = delta.PartialJSON
+					}
+					streamed += len(chunk)
+					if streamed > delivered {
+						chunk, shownSpace = skipShown(chunk[max(len(chunk)-(streamed-delivered), 0):], shownSpace)
+						delivered = streamed
+						if chunk != "" {
+							onChunk(chunk)
+						}
 					}
 				}
+			case anthropic.MessageStreamEventTypeMessageStop:
+				completed = true
 			}
 		}
-	}
 
-	if err := stream.Err(); err != nil {
+		if err := stream.Err(); err != nil {
+			return err
+		}
+		if !completed {
+			return fmt.Errorf("stream interrumpido antes de terminar: %w", io.ErrUnexpectedEOF)
+		}
+		return nil
+	})
+	if err != nil {
 		logger.Error("Error leyendo stream: %v", err)
-		return "", fmt.Errorf("error leyendo stream: %w", err)
+		// An interrupted stream was already billed for what it consumed
+		billed.Add(turnFromMessage(&message).usage)
+		return nil, withUsage(fmt.Errorf("error leyendo stream: %w", err), billed)
 	}
 
-	result := fullResponse.String()
-	logger.Debug("Streaming completado, longitud: %d", len(result))
-
-	// Clean up HTML
-	result = cleanHTMLResponse(result)
+	result := turnFromMessage(&message)
+	result.text = received + result.text
+	result.usage.Add(billed)
+	logger.Debug("Streaming completado, longitud: %d", len(result.text))
 
 	return result, nil
 }
 
+// skipShown drops the start of a resumed chunk that repeats whitespace
+// already shown; shown is cleared once the text moves past it
+func skipShown(chunk, shown string) (string, string) {
+	for shown != "" && chunk != "" && chunk[0] == shown[0] {
+		chunk, shown = chunk[1:], shown[1:]
+	}
+	if chunk != "" {
+		shown = ""
+	}
+	return chunk, shown
+}
+
+// withPrefill returns messages ending in an assistant turn with text. A
+// continuation already ends in one, which gets text as an extra block.
+func withPrefill(messages []anthropic.MessageParam, text string) []anthropic.MessageParam {
+	result := append([]anthropic.MessageParam{}, messages...)
+	last := len(result) - 1
+	if last >= 0 && result[last].Role.Value == anthropic.MessageParamRoleAssistant {
+		content := append(append([]anthropic.ContentBlockParamUnion{}, result[last].Content.Value...), anthropic.NewTextBlock(text))
+		result[last].Content = anthropic.F(content)
+		return result
+	}
+	return append(result, anthropic.NewAssistantMessage(anthropic.NewTextBlock(text)))
+}
+
+// turnFromMessage extracts text, tool input, usage and stop reason from a message
+func turnFromMessage(message *anthropic.Message) *turnResult {
+	result := &turnResult{
+		usage: Usage{
+			InputTokens:              message.Usage.InputTokens,
+			OutputTokens:             message.Usage.OutputTokens,
+			CacheCreationInputTokens: message.Usage.CacheCreationInputTokens,
+			CacheReadInputTokens:     message.Usage.CacheReadInputTokens,
+		},
+		stopReason: string(message.StopReason),
+	}
+
+	// The content can be text or blocks, extract text
+	var content strings.Builder
+	for _, block := range message.Content {
+		switch block.Type {
+		case anthropic.ContentBlockTypeText:
+			content.WriteString(block.Text)
+		case anthropic.ContentBlockTypeToolUse:
+			result.toolUseID = block.ID
+			result.toolInput = block.Input
+		}
+	}
+	result.text = content.String()
+
+	return result
+}
+
 // cleanHTMLResponse cleans up the HTML response from the AI
 func cleanHTMLResponse(html string) string {
 	// Remove markdown code fences if present
@@ -0,0 +1,129 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"orgmprop/internal/config"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// sseTextStream returns the events of a text stream with deltas; an
+// unfinished stream stops before message_stop
+func sseTextStream(deltas []string, finished bool) string {
+	var b strings.Builder
+	event := func(name, data string) {
+		fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", name, data)
+	}
+	event("message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"modelo","stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":1}}}`)
+	event("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`)
+	for _, delta := range deltas {
+		event("content_block_delta", fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%q}}`, delta))
+	}
+	if finished {
+		event("content_block_stop", `{"type":"content_block_stop","index":0}`)
+		event("message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":5}}`)
+		event("message_stop", `{"type":"message_stop"}`)
+	}
+	return b.String()
+}
+
+func TestStreamTurnResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     []string
+		resumed   []string
+		prefill   string
+		wantShown string
+		wantText  string
+	}{
+		{
+			name:      "sin espacio final",
+			first:     []string{"Hola", " mundo"},
+			resumed:   []string{" y más."},
+			prefill:   "Hola mundo",
+			wantShown: "Hola mundo y más.",
+			wantText:  "Hola mundo y más.",
+		},
+		{
+			name:      "continuación repite el espacio",
+			first:     []string{"Hola mundo", "\n\n"},
+			resumed:   []string{"\n", "\nFin."},
+			prefill:   "Hola mundo",
+			wantShown: "Hola mundo\n\nFin.",
+			wantText:  "Hola mundo\n\nFin.",
+		},
+		{
+			name:      "continuación repite parte del espacio",
+			first:     []string{"Hola mundo  "},
+			resumed:   []string{" y más."},
+			prefill:   "Hola mundo",
+			wantShown: "Hola mundo  y más.",
+			wantText:  "Hola mundo y más.",
+		},
+		{
+			name:      "continuación sin espacio",
+			first:     []string{"Hola mundo "},
+			resumed:   []string{"."},
+			prefill:   "Hola mundo",
+			wantShown: "Hola mundo .",
+			wantText:  "Hola mundo.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "text/event-stream")
+				if requests == 1 {
+					io.WriteString(w, sseTextStream(tt.first, false))
+					return
+				}
+				if !strings.Contains(string(body), fmt.Sprintf(`"text":%q`, tt.prefill)) {
+					t.Errorf("resumed request lacks prefill %q: %s", tt.prefill, body)
+				}
+				io.WriteString(w, sseTextStream(tt.resumed, true))
+			}))
+			defer server.Close()
+
+			c := &Client{
+				client: anthropic.NewClient(option.WithAPIKey("clave"), option.WithBaseURL(server.URL), option.WithMaxRetries(0)),
+				model:  "modelo",
+				retry:  config.RetryConfig{MaxRetries: 1, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			}
+			params := anthropic.MessageNewParams{
+				Model:     anthropic.F(anthropic.Model("modelo")),
+				MaxTokens: anthropic.F(int64(100)),
+				Messages:  anthropic.F([]anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("Saluda"))}),
+			}
+
+			var shown strings.Builder
+			result, err := c.streamTurn(context.Background(), params, func(chunk string) {
+				shown.WriteString(chunk)
+			})
+			if err != nil {
+				t.Fatalf("streamTurn: %v", err)
+			}
+			if requests != 2 {
+				t.Errorf("requests = %d, want 2", requests)
+			}
+			if shown.String() != tt.wantShown {
+				t.Errorf("shown = %q, want %q", shown.String(), tt.wantShown)
+			}
+			if result.text != tt.wantText {
+				t.Errorf("text = %q, want %q", result.text, tt.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"orgmprop/internal/logger"
+)
+
+// Attachment kinds, which decide how a file is sent to the model
+const (
+	AttachmentPDF   = "pdf"
+	AttachmentImage = "imagen"
+	AttachmentText  = "texto"
+)
+
+// Size limits of the Messages API for attached files
+const (
+	maxPDFSize   = 32 << 20
+	maxImageSize = 5 << 20
+	maxTextSize  = 1 << 20
+)
+
+// attachmentTypes maps supported file extensions to kind and media type
+var attachmentTypes = map[string]struct {
+	kind      string
+	mediaType string
+}{
+	".pdf":  {AttachmentPDF, "application/pdf"},
+	".png":  {AttachmentImage, "image/png"},
+	".jpg":  {AttachmentImage, "image/jpeg"},
+	".jpeg": {AttachmentImage, "image/jpeg"},
+	".gif":  {AttachmentImage, "image/gif"},
+	".webp": {AttachmentImage, "image/webp"},
+	".txt":  {AttachmentText, "text/plain"},
+	".md":   {AttachmentText, "text/markdown"},
+	".csv":  {AttachmentText, "text/csv"},
+	".tsv":  {AttachmentText, "text/tab-separated-values"},
+	".json": {AttachmentText, "application/json"},
+}
+
+// Attachment is a client file sent to the model with the user prompt
+type Attachment struct {
+	// Name identifies the file in prompts, e.g. its path inside Recibido
+	Name      string
+	Kind      string
+	MediaType string
+	Data      []byte
+}
+
+// IsSupportedAttachment reports whether a file can be attached by extension
+func IsSupportedAttachment(path string) bool {
+	_, ok := attachmentTypes[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// LoadAttachment reads a file and detects how to send it to the model
+func LoadAttachment(path, name string) (Attachment, error) {
+	fileType, ok := attachmentTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return Attachment{}, fmt.Errorf("tipo de archivo no soportado: %s", name)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("error leyendo adjunto %s: %w", name, err)
+	}
+
+	limit := maxTextSize
+	switch fileType.kind {
+	case AttachmentPDF:
+		limit = maxPDFSize
+	case AttachmentImage:
+		limit = maxImageSize
+	}
+	if len(data) > limit {
+		return Attachment{}, fmt.Errorf("adjunto %s demasiado grande: %d bytes (máximo %d)", name, len(data), limit)
+	}
+
+	logger.Debug("Adjunto cargado: %s (%s, %d bytes)", name, fileType.mediaType, len(data))
+	return Attachment{
+		Name:      name,
+		Kind:      fileType.kind,
+		MediaType: fileType.mediaType,
+		Data:      data,
+	}, nil
+}
+
+// inlineText returns a text attachment wrapped with its file name
+func (a Attachment) inlineText() string {
+	return fmt.Sprintf("Archivo adjunto: %s\n```\n%s\n```", a.Name, strings.TrimRight(string(a.Data), "\r\n"))
+}
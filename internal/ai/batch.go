@@ -0,0 +1,208 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"orgmprop/internal/logger"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// batchPollInterval is how often the status of a submitted batch is checked
+const batchPollInterval = 30 * time.Second
+
+// BatchRequest is a request submitted through a batch API
+type BatchRequest struct {
+	// ID matches the result to the request; unique within the batch
+	ID      string
+	Request Request
+}
+
+// BatchResult is the outcome of a single request of a batch. A failed
+// request that was billed keeps its Response for the usage.
+type BatchResult struct {
+	ID       string
+	Response *Response
+	Err      error
+}
+
+// BatchProvider is implemented by providers with an asynchronous batch API.
+// Batched requests cost less but may take up to 24 hours, and get neither
+// continuations nor repair rounds.
+type BatchProvider interface {
+	Provider
+	// SubmitBatch creates a batch with the requests and returns its ID
+	SubmitBatch(ctx context.Context, reqs []BatchRequest) (string, error)
+	// AwaitBatch waits for a submitted batch to end and returns one result
+	// per request, calling onStatus while waiting. reqs must be the requests
+	// the batch was submitted with.
+	AwaitBatch(ctx context.Context, batchID string, reqs []BatchRequest, onStatus func(string)) ([]BatchResult, error)
+}
+
+// SubmitBatch submits the requests to the Message Batches API
+func (c *Client) SubmitBatch(ctx context.Context, reqs []BatchRequest) (string, error) {
+	logger.Debug("Enviando lote de %d solicitudes con modelo: %s", len(reqs), c.model)
+
+	params := make([]anthropic.MessageBatchNewParamsRequest, len(reqs))
+	for i, req := range reqs {
+		params[i] = anthropic.MessageBatchNewParamsRequest{
+			CustomID: anthropic.F(req.ID),
+			Params:   anthropic.F(c.newParams(req.Request, initialMessages(req.Request))),
+		}
+	}
+
+	var batch *anthropic.MessageBatch
+	err := withRetry(ctx, c.retry, "Creación de lote", func() error {
+		var err error
+		batch, err = c.client.Messages.Batches.New(ctx, anthropic.MessageBatchNewParams{
+			Requests: anthropic.F(params),
+		})
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creando lote: %w", err)
+	}
+
+	logger.Info("Lote %s creado con %d solicitudes", batch.ID, len(reqs))
+	return batch.ID, nil
+}
+
+// AwaitBatch polls a batch of the Message Batches API until it ends and
+// downloads its results
+func (c *Client) AwaitBatch(ctx context.Context, batchID string, reqs []BatchRequest, onStatus func(string)) ([]BatchResult, error) {
+	byID := make(map[string]Request, len(reqs))
+	for _, req := range reqs {
+		byID[req.ID] = req.Request
+	}
+
+	var batch *anthropic.MessageBatch
+	poll := func() error {
+		return withRetry(ctx, c.retry, "Consulta de lote", func() error {
+			var err error
+			batch, err = c.client.Messages.Batches.Get(ctx, batchID)
+			return err
+		})
+	}
+	if err := poll(); err != nil {
+		return nil, fmt.Errorf("error consultando lote %s: %w", batchID, err)
+	}
+
+	// Poll until every request has ended
+	for batch.ProcessingStatus != anthropic.MessageBatchProcessingStatusEnded {
+		if onStatus != nil {
+			onStatus(fmt.Sprintf("Lote %s: %d en proceso, %d completadas, %d con error",
+				batch.ID, batch.RequestCounts.Processing, batch.RequestCounts.Succeeded, batch.RequestCounts.Errored))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("espera del lote %s interrumpida; el lote sigue en proceso: %w", batch.ID, ctx.Err())
+		case <-time.After(batchPollInterval):
+		}
+
+		if err := poll(); err != nil {
+			return nil, fmt.Errorf("error consultando lote %s: %w", batchID, err)
+		}
+	}
+
+	logger.Debug("Lote %s terminado, descargando resultados", batch.ID)
+
+	resp, err := c.client.Messages.Batches.Results(ctx, batch.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error descargando resultados del lote %s: %w", batch.ID, err)
+	}
+	defer resp.Body.Close()
+
+	// Results come as JSONL in any order
+	found := make(map[string]BatchResult, len(reqs))
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var line anthropic.MessageBatchIndividualResponse
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			logger.Warn("Resultado de lote inválido ignorado: %v", err)
+			continue
+		}
+
+		found[line.CustomID] = batchResult(line, byID[line.CustomID])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo resultados del lote %s: %w", batch.ID, err)
+	}
+
+	results := make([]BatchResult, len(reqs))
+	for i, req := range reqs {
+		result, ok := found[req.ID]
+		if !ok {
+			result = BatchResult{ID: req.ID, Err: fmt.Errorf("sin resultado en el lote %s", batch.ID)}
+		}
+		results[i] = result
+	}
+
+	return results, nil
+}
+
+// batchResult converts a batch result line into a BatchResult
+func batchResult(line anthropic.MessageBatchIndividualResponse, req Request) BatchResult {
+	result := BatchResult{ID: line.CustomID}
+
+	if line.Result.Type == anthropic.MessageBatchResultTypeErrored {
+		result.Err = fmt.Errorf("error en el lote: %s", line.Result.Error.Error.Message)
+		return result
+	}
+	if line.Result.Type != anthropic.MessageBatchResultTypeSucceeded {
+		result.Err = fmt.Errorf("solicitud no procesada: %s", line.Result.Type)
+		return result
+	}
+
+	turn := turnFromMessage(&line.Result.Message)
+	response := &Response{Usage: turn.usage, StopReason: turn.stopReason}
+
+	if req.Tool == nil {
+		if turn.stopReason == string(anthropic.MessageStopReasonMaxTokens) {
+			logger.Warn("Resultado %s cortado por max_tokens; el lote no envía continuaciones", line.CustomID)
+		}
+		response.Text = cleanHTMLResponse(turn.text)
+		result.Response = response
+		return result
+	}
+
+	// Failed tool calls keep the response, with the model output as Text, so
+	// their usage is still recorded and the output can be inspected.
+	// Truncated input is returned as Text for the caller to repair.
+	if turn.stopReason == string(anthropic.MessageStopReasonMaxTokens) {
+		if len(turn.toolInput) == 0 {
+			result.Err = fmt.Errorf("salida de la herramienta %s truncada por max_tokens (%d tokens); aumenta max_tokens.%s", req.Tool.Name, req.OutputLimit(), req.Kind)
+			response.Text = turn.text
+		} else {
+			response.Text = string(turn.toolInput)
+		}
+		result.Response = response
+		return result
+	}
+	if turn.toolInput == nil {
+		result.Err = fmt.Errorf("el modelo no llamó la herramienta %s", req.Tool.Name)
+		response.Text = turn.text
+		result.Response = response
+		return result
+	}
+	if err := validateToolInput(req.Tool, turn.toolInput); err != nil {
+		result.Err = fmt.Errorf("salida inválida: %w", err)
+		response.Text = string(turn.toolInput)
+		result.Response = response
+		return result
+	}
+
+	response.Text = string(turn.toolInput)
+	response.ToolInput = turn.toolInput
+	result.Response = response
+	return result
+}
@@ -0,0 +1,151 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"orgmprop/internal/logger"
+)
+
+// FakeModel is the model name recorded for documents produced by FakeClient
+const FakeModel = "fake"
+
+// FakeClient is an offline provider that returns fixture files.
+//
+// For each request it looks in the fixtures directory for, in order:
+//   - <hash>.txt, where hash identifies the exact prompts (see FixtureHash)
+//   - <kind>.txt, e.g. propuesta.txt or presupuesto.txt
+type FakeClient struct {
+	fixturesDir string
+}
+
+// NewFakeClient creates a new fake client reading fixtures from a directory
+func NewFakeClient(fixturesDir string) *FakeClient {
+	logger.Debug("Creando cliente fake con fixtures en: %s", fixturesDir)
+	return &FakeClient{
+		fixturesDir: fixturesDir,
+	}
+}
+
+// Model returns the model name of the fake client
+func (c *FakeClient) Model() string {
+	return FakeModel
+}
+
+// Generate returns the fixture matching the request
+func (c *FakeClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	content, err := c.fixture(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.response(req, content)
+}
+
+// GenerateStream returns the fixture matching the request, line by line
+func (c *FakeClient) GenerateStream(ctx context.Context, req Request, onChunk func(string)) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	content, err := c.fixture(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if onChunk != nil {
+		for _, line := range strings.SplitAfter(content, "\n") {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			onChunk(line)
+		}
+	}
+
+	return c.response(req, content)
+}
+
+// response builds the response for a fixture, validating it as tool input
+// when the request has a Tool
+func (c *FakeClient) response(req Request, content string) (*Response, error) {
+	text := cleanHTMLResponse(content)
+	if req.Tool == nil {
+		return &Response{Text: text}, nil
+	}
+
+	// Fixtures may keep the ```json fence of a recorded text response
+	input := json.RawMessage(trimCodeFence(content))
+	if err := validateToolInput(req.Tool, input); err != nil {
+		return nil, fmt.Errorf("fixture inválido para la herramienta %s: %w", req.Tool.Name, err)
+	}
+
+	return &Response{Text: string(input), ToolInput: input}, nil
+}
+
+// trimCodeFence removes a Markdown code fence, with any language tag, around text
+func trimCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		_, text, _ = strings.Cut(text, "\n")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	return strings.TrimSpace(text)
+}
+
+// fixture reads the first fixture file that matches the request
+func (c *FakeClient) fixture(req Request) (string, error) {
+	hash := FixtureHash(req)
+	logger.Debug("Buscando fixture para %s, hash: %s", req.Kind, hash)
+
+	candidates := []string{
+		hash + ".txt",
+		req.Kind + ".txt",
+	}
+
+	for _, name := range candidates {
+		path := filepath.Join(c.fixturesDir, name)
+		data, err := os.ReadFile(path)
+		if err == nil {
+			logger.Debug("Fixture cargado: %s", path)
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("error leyendo fixture %s: %w", path, err)
+		}
+	}
+
+	return "", fmt.Errorf("fixture no encontrado en %s (se buscó: %s)", c.fixturesDir, strings.Join(candidates, ", "))
+}
+
+// FixtureHash returns a stable identifier for the prompts of a request
+func FixtureHash(req Request) string {
+	h := sha256.New()
+	h.Write([]byte(req.Kind))
+	h.Write([]byte{0})
+	h.Write([]byte(req.SystemPrompt))
+	h.Write([]byte{0})
+	for _, message := range req.History {
+		h.Write([]byte(message.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(message.Content))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(req.UserContent()))
+	for _, attachment := range req.Attachments {
+		h.Write([]byte{0})
+		h.Write([]byte(attachment.Name))
+		h.Write([]byte{0})
+		h.Write(attachment.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
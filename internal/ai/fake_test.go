@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFakeClientCancelled(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, KindPropuesta+".txt"), []byte("<html>\n</html>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := NewFakeClient(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		generate func() (*Response, error)
+	}{
+		{"Generate", func() (*Response, error) { return client.Generate(ctx, Request{Kind: KindPropuesta}) }},
+		{"GenerateStream sin onChunk", func() (*Response, error) { return client.GenerateStream(ctx, Request{Kind: KindPropuesta}, nil) }},
+		{"GenerateStream con onChunk", func() (*Response, error) {
+			return client.GenerateStream(ctx, Request{Kind: KindPropuesta}, func(string) {})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.generate(); !errors.Is(err, context.Canceled) {
+				t.Errorf("error = %v, want %v", err, context.Canceled)
+			}
+		})
+	}
+}
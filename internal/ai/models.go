@@ -0,0 +1,172 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"orgmprop/internal/config"
+	"orgmprop/internal/logger"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// ModelCatalog returns the model catalog of the configured provider. A stale
+// cache is refreshed from the provider's models-list endpoint; if that fails,
+// the cached or embedded catalog is returned.
+func ModelCatalog(ctx context.Context, cfg *config.Config) *config.ModelCatalog {
+	provider := cfg.GetProvider()
+	catalog := config.LoadModelCatalog(provider)
+	if !catalog.Stale() {
+		logger.Debug("Catálogo de modelos de %s en caché desde %s", provider, catalog.FetchedAt.Format(time.RFC3339))
+		return catalog
+	}
+
+	refreshed, err := RefreshModelCatalog(ctx, cfg)
+	if err != nil {
+		logger.Warn("No se pudo actualizar el catálogo de modelos, usando el local: %v", err)
+		return catalog
+	}
+
+	return refreshed
+}
+
+// RefreshModelCatalog fetches the model list of the configured provider and
+// caches it. Metadata the endpoint does not report (context window, max
+// output, price) is kept from the previous and embedded catalogs. It never
+// prompts: an encrypted API key must be unlocked beforehand.
+func RefreshModelCatalog(ctx context.Context, cfg *config.Config) (*config.ModelCatalog, error) {
+	provider := cfg.GetProvider()
+	logger.Debug("Actualizando catálogo de modelos de %s", provider)
+
+	models, err := ListModels(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, model := range models {
+		if known, ok := config.LookupModel(provider, model.ID); ok {
+			models[i] = mergeModelInfo(model, known)
+		}
+	}
+
+	catalog := &config.ModelCatalog{
+		Provider:  provider,
+		FetchedAt: time.Now(),
+		Models:    models,
+	}
+	if err := config.SaveModelCatalog(catalog); err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Catálogo de modelos actualizado: %d modelos", len(models))
+	return catalog, nil
+}
+
+// ListModels fetches the model list of the configured provider without
+// caching it or prompting for the API key
+func ListModels(ctx context.Context, cfg *config.Config) ([]config.ModelInfo, error) {
+	var models []config.ModelInfo
+	var err error
+	switch provider := cfg.GetProvider(); provider {
+	case config.ProviderAnthropic:
+		var apiKey string
+		if apiKey, err = cfg.ResolveAPIKey(); err != nil {
+			return nil, err
+		}
+		models, err = fetchAnthropicModels(ctx, apiKey)
+	case config.ProviderOpenAI:
+		baseURL := cfg.OpenAIBaseURL
+		if baseURL == "" {
+			baseURL = config.DefaultOpenAIBaseURL
+		}
+		models, err = fetchOpenAIModels(ctx, baseURL, cfg.OpenAIAPIKey)
+	case config.ProviderFake:
+		models = []config.ModelInfo{{ID: FakeModel, DisplayName: "Fixtures locales"}}
+	default:
+		return nil, fmt.Errorf("proveedor de IA desconocido: %s", provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// mergeModelInfo fills the fields the endpoint left empty from known metadata
+func mergeModelInfo(fetched, known config.ModelInfo) config.ModelInfo {
+	if fetched.DisplayName == "" {
+		fetched.DisplayName = known.DisplayName
+	}
+	if fetched.ContextWindow == 0 {
+		fetched.ContextWindow = known.ContextWindow
+	}
+	if fetched.MaxOutputTokens == 0 {
+		fetched.MaxOutputTokens = known.MaxOutputTokens
+	}
+	if fetched.Price == nil {
+		fetched.Price = known.Price
+	}
+	return fetched
+}
+
+// fetchAnthropicModels lists the models available to the API key
+func fetchAnthropicModels(ctx context.Context, apiKey string) ([]config.ModelInfo, error) {
+	client := anthropic.NewClient(option.WithAPIKey(apiKey))
+
+	var models []config.ModelInfo
+	pager := client.Models.ListAutoPaging(ctx, anthropic.ModelListParams{})
+	for pager.Next() {
+		model := pager.Current()
+		models = append(models, config.ModelInfo{
+			ID:          model.ID,
+			DisplayName: model.DisplayName,
+		})
+	}
+	if err := pager.Err(); err != nil {
+		return nil, fmt.Errorf("error listando modelos de Anthropic: %w", err)
+	}
+
+	return models, nil
+}
+
+// fetchOpenAIModels lists the models of an OpenAI-compatible server
+func fetchOpenAIModels(ctx context.Context, baseURL, apiKey string) ([]config.ModelInfo, error) {
+	url := strings.TrimSuffix(baseURL, "/") + "/models"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creando solicitud: %w", err)
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error listando modelos de %s: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error listando modelos de %s: %s", baseURL, resp.Status)
+	}
+
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("error decodificando lista de modelos: %w", err)
+	}
+
+	models := make([]config.ModelInfo, len(body.Data))
+	for i, model := range body.Data {
+		models[i] = config.ModelInfo{ID: model.ID}
+	}
+
+	return models, nil
+}
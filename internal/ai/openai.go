@@ -0,0 +1,527 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"orgmprop/internal/config"
+	"orgmprop/internal/logger"
+)
+
+// OpenAIClient talks to any OpenAI-compatible chat completions endpoint,
+// such as a local llama.cpp or Ollama server
+type OpenAIClient struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	model      string
+	retry      config.RetryConfig
+}
+
+// openAIMessage is a chat message in the OpenAI format
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	// Parts, when set, replaces Content with multimodal content parts
+	Parts []openAIContentPart `json:"-"`
+}
+
+// openAIContentPart is a text or image part of a multimodal message
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+// openAIImageURL holds an image as a data URL
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// MarshalJSON sends Parts as the message content when present
+func (m openAIMessage) MarshalJSON() ([]byte, error) {
+	type plain openAIMessage
+	if len(m.Parts) == 0 {
+		return json.Marshal(plain(m))
+	}
+
+	return json.Marshal(struct {
+		plain
+		Content []openAIContentPart `json:"content"`
+	}{plain: plain(m), Content: m.Parts})
+}
+
+// openAIToolCall is a function call made by the model
+type openAIToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// openAITool declares a function the model can call
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIToolFunction `json:"function"`
+}
+
+// openAIToolFunction describes a callable function
+type openAIToolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// openAIStreamOptions asks the server to report usage in the last chunk
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIRequest is the body sent to /chat/completions
+type openAIRequest struct {
+	Model         string               `json:"model"`
+	Messages      []openAIMessage      `json:"messages"`
+	MaxTokens     int64                `json:"max_tokens"`
+	Stream        bool                 `json:"stream"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+	Tools         []openAITool         `json:"tools,omitempty"`
+	ToolChoice    interface{}          `json:"tool_choice,omitempty"`
+}
+
+// openAIUsage is the token usage reported by /chat/completions
+type openAIUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+// openAIResponse is the non-streaming response from /chat/completions
+type openAIResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// openAIStreamChunk is a single SSE chunk from /chat/completions
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string           `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// openAITurn is the outcome of a single chat completions call
+type openAITurn struct {
+	message      openAIMessage
+	usage        Usage
+	finishReason string
+}
+
+// toUsage converts the OpenAI usage block, which may be missing
+func (u *openAIUsage) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+	}
+}
+
+// stopReason maps an OpenAI finish_reason to the Anthropic stop reasons
+func stopReason(finishReason string) string {
+	if finishReason == "length" {
+		return "max_tokens"
+	}
+	return finishReason
+}
+
+// NewOpenAIClient creates a new OpenAI-compatible client
+func NewOpenAIClient(baseURL, apiKey, model string, retry config.RetryConfig) *OpenAIClient {
+	logger.Debug("Creando cliente OpenAI-compatible en %s con modelo: %s", baseURL, model)
+	return &OpenAIClient{
+		httpClient: &http.Client{},
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		retry:      retry,
+	}
+}
+
+// Model returns the model used by the client
+func (c *OpenAIClient) Model() string {
+	return c.model
+}
+
+// Generate generates a document using the chat completions endpoint
+func (c *OpenAIClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	logger.Debug("Generando %s con modelo OpenAI-compatible: %s", req.Kind, c.model)
+	return c.generate(ctx, req, nil, false)
+}
+
+// GenerateStream generates a document using server-sent events
+func (c *OpenAIClient) GenerateStream(ctx context.Context, req Request, onChunk func(string)) (*Response, error) {
+	logger.Debug("Generando %s con streaming, modelo OpenAI-compatible: %s", req.Kind, c.model)
+	return c.generate(ctx, req, onChunk, true)
+}
+
+// openAIContinuationPrompt asks for the rest of a response cut by max_tokens.
+// Chat completions servers do not reliably continue an assistant prefill, so
+// the continuation is requested as a new user turn.
+const openAIContinuationPrompt = "Tu respuesta anterior se cortó por el límite de tokens. Continúa exactamente donde quedó, sin repetir nada ni agregar comentarios."
+
+// generate runs the request. A text response cut by max_tokens gets up to
+// MaxContinuations continuation turns; with a Tool, invalid function
+// arguments are sent back to the model for one repair round.
+func (c *OpenAIClient) generate(ctx context.Context, req Request, onChunk func(string), stream bool) (*Response, error) {
+	messages := []openAIMessage{{Role: "system", Content: req.SystemPrompt}}
+	for _, message := range req.History {
+		messages = append(messages, openAIMessage{Role: message.Role, Content: message.Content})
+	}
+	user, err := openAIUserMessage(req)
+	if err != nil {
+		return nil, err
+	}
+	messages = append(messages, user)
+
+	var usage Usage
+	// text and continuation track the continuation turns of a text response
+	var text string
+	continuation := 0
+	for round := 0; ; round++ {
+		var turn *openAITurn
+		var err error
+		if stream {
+			turn, err = c.streamTurn(ctx, req, messages, onChunk)
+		} else {
+			turn, err = c.sendTurn(ctx, req, messages)
+		}
+		if err != nil {
+			return nil, withUsage(err, usage)
+		}
+		usage.Add(turn.usage)
+
+		if req.Tool == nil {
+			text += turn.message.Content
+			if stopReason(turn.finishReason) == "max_tokens" {
+				if continuation < req.MaxContinuations {
+					continuation++
+					logger.Info("Respuesta cortada por max_tokens, enviando continuación %d de %d", continuation, req.MaxContinuations)
+					messages = append(messages,
+						openAIMessage{Role: "assistant", Content: turn.message.Content},
+						openAIMessage{Role: "user", Content: openAIContinuationPrompt},
+					)
+					continue
+				}
+				logger.Warn("Respuesta cortada por max_tokens tras %d continuaciones", continuation)
+			}
+
+			logger.Debug("Contenido generado, longitud: %d", len(text))
+			return &Response{
+				Text:       cleanHTMLResponse(text),
+				Usage:      usage,
+				StopReason: stopReason(turn.finishReason),
+			}, nil
+		}
+
+		if stopReason(turn.finishReason) == "max_tokens" {
+			if len(turn.message.ToolCalls) == 0 || turn.message.ToolCalls[0].Function.Arguments == "" {
+				return nil, &UsageError{Err: fmt.Errorf("salida de la función %s truncada por max_tokens (%d tokens); aumenta max_tokens.%s", req.Tool.Name, req.OutputLimit(), req.Kind), Usage: usage, Raw: turn.message.Content}
+			}
+			logger.Warn("Argumentos de %s truncados por max_tokens (%d tokens); se devuelven para reparar", req.Tool.Name, req.OutputLimit())
+			return &Response{
+				Text:       turn.message.ToolCalls[0].Function.Arguments,
+				Usage:      usage,
+				StopReason: "max_tokens",
+			}, nil
+		}
+		if len(turn.message.ToolCalls) == 0 {
+			return nil, &UsageError{Err: fmt.Errorf("el modelo no llamó la función %s", req.Tool.Name), Usage: usage, Raw: turn.message.Content}
+		}
+
+		call := turn.message.ToolCalls[0]
+		input := json.RawMessage(call.Function.Arguments)
+		verr := validateToolInput(req.Tool, input)
+		if verr == nil {
+			return &Response{
+				Text:       string(input),
+				ToolInput:  input,
+				Usage:      usage,
+				StopReason: stopReason(turn.finishReason),
+			}, nil
+		}
+		if round >= toolRepairRounds {
+			return nil, &UsageError{Err: fmt.Errorf("salida inválida tras %d ronda de reparación: %w", toolRepairRounds, verr), Usage: usage, Raw: call.Function.Arguments}
+		}
+
+		logger.Warn("Salida de %s inválida, solicitando reparación: %v", req.Tool.Name, verr)
+		messages = append(messages,
+			openAIMessage{Role: "assistant", ToolCalls: []openAIToolCall{call}},
+			openAIMessage{Role: "tool", ToolCallID: call.ID, Content: toolRepairPrompt(verr)},
+		)
+	}
+}
+
+// openAIUserMessage builds the current user turn. Text files are inlined and
+// images sent as data URLs; PDFs are not supported by the chat completions API.
+func openAIUserMessage(req Request) (openAIMessage, error) {
+	message := openAIMessage{Role: "user", Content: req.UserContent()}
+	if len(req.Attachments) == 0 {
+		return message, nil
+	}
+
+	parts := []openAIContentPart{}
+	if req.CachedPrefix != "" {
+		parts = append(parts, openAIContentPart{Type: "text", Text: req.CachedPrefix})
+	}
+	for _, attachment := range req.Attachments {
+		switch attachment.Kind {
+		case AttachmentPDF:
+			return openAIMessage{}, fmt.Errorf("el proveedor openai no admite PDF adjuntos: %s", attachment.Name)
+		case AttachmentImage:
+			parts = append(parts,
+				openAIContentPart{Type: "text", Text: "Archivo adjunto: " + attachment.Name},
+				openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{
+					URL: "data:" + attachment.MediaType + ";base64," + base64.StdEncoding.EncodeToString(attachment.Data),
+				}},
+			)
+		default:
+			parts = append(parts, openAIContentPart{Type: "text", Text: attachment.inlineText()})
+		}
+	}
+	parts = append(parts, openAIContentPart{Type: "text", Text: req.UserPrompt})
+
+	message.Parts = parts
+	return message, nil
+}
+
+// sendTurn sends a single non-streaming request
+func (c *OpenAIClient) sendTurn(ctx context.Context, req Request, messages []openAIMessage) (*openAITurn, error) {
+	var turn *openAITurn
+	err := withRetry(ctx, c.retry, "Solicitud a "+c.baseURL, func() error {
+		resp, err := c.post(ctx, req, messages, false)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var body openAIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			logger.Error("Error decodificando respuesta OpenAI: %v", err)
+			return fmt.Errorf("error decodificando respuesta: %w", err)
+		}
+
+		if len(body.Choices) == 0 {
+			logger.Error("Respuesta vacía del servidor OpenAI-compatible")
+			return fmt.Errorf("respuesta vacía del servidor %s", c.baseURL)
+		}
+
+		turn = &openAITurn{
+			message:      body.Choices[0].Message,
+			usage:        body.Usage.toUsage(),
+			finishReason: body.Choices[0].FinishReason,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return turn, nil
+}
+
+// streamTurn sends a single streaming request. A stream that fails midway
+// is restarted; its chunks are only forwarded to onChunk once past what was
+// already shown.
+func (c *OpenAIClient) streamTurn(ctx context.Context, req Request, messages []openAIMessage, onChunk func(string)) (*openAITurn, error) {
+	var turn *openAITurn
+	// delivered counts the bytes passed to onChunk over all attempts
+	delivered := 0
+
+	err := withRetry(ctx, c.retry, "Stream de "+c.baseURL, func() error {
+		streamed := 0
+		emit := func(chunk string) {
+			streamed += len(chunk)
+			if onChunk != nil && streamed > delivered {
+				onChunk(chunk[max(len(chunk)-(streamed-delivered), 0):])
+				delivered = streamed
+			}
+		}
+
+		var err error
+		turn, err = c.readStream(ctx, req, messages, emit)
+		return err
+	})
+	if err != nil {
+		logger.Error("Error leyendo stream: %v", err)
+		return nil, fmt.Errorf("error leyendo stream: %w", err)
+	}
+
+	logger.Debug("Streaming completado, longitud: %d", len(turn.message.Content))
+	return turn, nil
+}
+
+// readStream runs one attempt of a streaming request
+func (c *OpenAIClient) readStream(ctx context.Context, req Request, messages []openAIMessage, onChunk func(string)) (*openAITurn, error) {
+	resp, err := c.post(ctx, req, messages, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var fullResponse strings.Builder
+	var toolCalls []openAIToolCall
+	turn := &openAITurn{}
+	done := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			logger.Warn("Chunk de stream inválido ignorado: %v", err)
+			continue
+		}
+
+		if chunk.Usage != nil {
+			turn.usage = chunk.Usage.toUsage()
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				turn.finishReason = choice.FinishReason
+			}
+
+			// Function call arguments arrive in fragments keyed by index
+			for _, delta := range choice.Delta.ToolCalls {
+				for len(toolCalls) <= delta.Index {
+					toolCalls = append(toolCalls, openAIToolCall{Index: len(toolCalls), Type: "function"})
+				}
+				call := &toolCalls[delta.Index]
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				if delta.Function.Name != "" {
+					call.Function.Name = delta.Function.Name
+				}
+				call.Function.Arguments += delta.Function.Arguments
+				if delta.Function.Arguments != "" {
+					onChunk(delta.Function.Arguments)
+				}
+			}
+
+			if choice.Delta.Content == "" {
+				continue
+			}
+			fullResponse.WriteString(choice.Delta.Content)
+			onChunk(choice.Delta.Content)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// Some servers close without [DONE]; a finish reason still marks the end
+	if !done && turn.finishReason == "" {
+		return nil, fmt.Errorf("stream interrumpido antes de terminar: %w", io.ErrUnexpectedEOF)
+	}
+
+	turn.message = openAIMessage{
+		Role:      "assistant",
+		Content:   fullResponse.String(),
+		ToolCalls: toolCalls,
+	}
+	return turn, nil
+}
+
+// post sends a chat completions request and checks the HTTP status
+func (c *OpenAIClient) post(ctx context.Context, req Request, messages []openAIMessage, stream bool) (*http.Response, error) {
+	body := openAIRequest{
+		Model:     c.model,
+		Messages:  messages,
+		MaxTokens: req.OutputLimit(),
+		Stream:    stream,
+	}
+	if stream {
+		body.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	if req.Tool != nil {
+		body.Tools = []openAITool{
+			{
+				Type: "function",
+				Function: openAIToolFunction{
+					Name:        req.Tool.Name,
+					Description: req.Tool.Description,
+					Parameters:  req.Tool.InputSchema,
+				},
+			},
+		}
+		body.ToolChoice = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": req.Tool.Name},
+		}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error serializando solicitud: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("error creando solicitud: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	logger.Debug("Enviando solicitud a %s...", c.baseURL)
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		logger.Error("Error en solicitud a %s: %v", c.baseURL, err)
+		return nil, fmt.Errorf("error en la solicitud a %s: %w", c.baseURL, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		resp.Body.Close()
+		logger.Error("Respuesta %d de %s: %s", resp.StatusCode, c.baseURL, string(body))
+		return nil, &StatusError{
+			URL:        c.baseURL,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,199 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"orgmprop/internal/config"
+	"orgmprop/internal/logger"
+)
+
+// Document kinds sent in a Request
+const (
+	KindPropuesta    = "propuesta"
+	KindPresupuesto  = "presupuesto"
+	KindRefinamiento = "refinamiento"
+)
+
+// Roles of the turns in a conversation
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is an earlier turn of a conversation sent with a Request
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Request represents a single generation request
+type Request struct {
+	Kind         string
+	SystemPrompt string
+	// History holds earlier turns, starting with a user turn and alternating,
+	// sent before the current user prompt
+	History []Message
+	// CachedPrefix is stable text sent before UserPrompt, such as a long
+	// example, that providers with prompt caching mark for reuse
+	CachedPrefix string
+	UserPrompt   string
+	// Attachments are sent with the current user turn, before UserPrompt
+	Attachments []Attachment
+	// MaxTokens is the output limit of a single API call
+	MaxTokens int64
+	// MaxOutputTokens is the model's output limit from the catalog, zero when
+	// unknown. Tool calls cannot be continued, so they use it instead.
+	MaxOutputTokens int64
+	// MaxContinuations limits the extra turns sent when output hits MaxTokens
+	MaxContinuations int
+	// Tool, when set, forces structured output through a tool call
+	Tool *Tool
+}
+
+// UserContent returns the full user prompt, including the cached prefix
+func (r Request) UserContent() string {
+	return r.CachedPrefix + r.UserPrompt
+}
+
+// OutputLimit returns the max_tokens sent with a call: MaxTokens, or the
+// model's whole output for a tool call, whose input cannot be continued
+func (r Request) OutputLimit() int64 {
+	limit := r.MaxTokens
+	if limit <= 0 {
+		limit = config.DefaultMaxTokens
+	}
+	if r.Tool != nil && r.MaxOutputTokens > limit {
+		return r.MaxOutputTokens
+	}
+	return limit
+}
+
+// Usage holds the token counts reported for a generation
+type Usage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens,omitempty"`
+}
+
+// Add accumulates the token counts of another usage
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+// Response represents the result of a generation
+type Response struct {
+	Text string
+	// ToolInput holds the validated tool input when the request had a Tool.
+	// Tool input truncated by max_tokens is returned in Text instead, with
+	// StopReason "max_tokens", for the caller to repair.
+	ToolInput json.RawMessage
+	Usage     Usage
+	// StopReason is "max_tokens" when the text is still truncated
+	StopReason string
+}
+
+// UsageError is a failed generation whose tokens were already billed
+type UsageError struct {
+	Err   error
+	Usage Usage
+	// Raw is the tool input or text the model returned, if any, so it can
+	// be kept for inspection
+	Raw string
+}
+
+// Error returns the message of the underlying error
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+// UsageOf returns the tokens billed before a generation failed with err
+func UsageOf(err error) (Usage, bool) {
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		return usageErr.Usage, true
+	}
+	return Usage{}, false
+}
+
+// RawOf returns the model output of a generation that failed with err
+func RawOf(err error) (string, bool) {
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) && usageErr.Raw != "" {
+		return usageErr.Raw, true
+	}
+	return "", false
+}
+
+// withUsage attaches the tokens billed so far to err, adding those already
+// carried by err and keeping its raw output. Errors with nothing billed are
+// returned unchanged.
+func withUsage(err error, usage Usage) error {
+	var raw string
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		usage.Add(usageErr.Usage)
+		raw = usageErr.Raw
+	}
+	if usage == (Usage{}) && raw == "" {
+		return err
+	}
+	return &UsageError{Err: err, Usage: usage, Raw: raw}
+}
+
+// Provider is implemented by every AI backend
+type Provider interface {
+	// Model returns the model name recorded with generated documents
+	Model() string
+	// Generate returns the full response
+	Generate(ctx context.Context, req Request) (*Response, error)
+	// GenerateStream returns the full response, calling onChunk as text arrives
+	GenerateStream(ctx context.Context, req Request, onChunk func(string)) (*Response, error)
+}
+
+// NewProvider creates the provider selected in the configuration
+func NewProvider(cfg *config.Config) (Provider, error) {
+	provider := cfg.GetProvider()
+
+	logger.Debug("Proveedor de IA seleccionado: %s", provider)
+
+	switch provider {
+	case config.ProviderAnthropic:
+		apiKey, err := cfg.ResolveAPIKey()
+		if err != nil {
+			return nil, err
+		}
+		return NewClient(apiKey, cfg.Model, cfg.Retry), nil
+
+	case config.ProviderOpenAI:
+		baseURL := cfg.OpenAIBaseURL
+		if baseURL == "" {
+			baseURL = config.DefaultOpenAIBaseURL
+		}
+		model := cfg.OpenAIModel
+		if model == "" {
+			return nil, fmt.Errorf("modelo OpenAI no configurado. Define 'openai_model' en config.yaml")
+		}
+		return NewOpenAIClient(baseURL, cfg.OpenAIAPIKey, model, cfg.Retry), nil
+
+	case config.ProviderFake:
+		fixturesDir := cfg.FakeFixturesDir
+		if fixturesDir == "" {
+			fixturesDir = config.GetConfigFilePath("fixtures")
+		}
+		return NewFakeClient(fixturesDir), nil
+	}
+
+	return nil, fmt.Errorf("proveedor de IA desconocido: %s", provider)
+}
@@ -0,0 +1,212 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"orgmprop/internal/config"
+	"orgmprop/internal/logger"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Failure kinds reported once retries are exhausted
+const (
+	FailureQuota    = "cuota"
+	FailureOverload = "sobrecarga"
+	FailureNetwork  = "red"
+)
+
+// RetryError is returned when a request keeps failing after every retry
+type RetryError struct {
+	Kind     string
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	var reason string
+	switch e.Kind {
+	case FailureQuota:
+		reason = "cuota o límite de solicitudes excedido (429)"
+	case FailureOverload:
+		reason = "servicio sobrecargado"
+	case FailureNetwork:
+		reason = "error de red"
+	default:
+		reason = "error desconocido"
+	}
+	return fmt.Sprintf("fallaron %d intentos por %s: %v", e.Attempts, reason, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError is a non-200 response from an OpenAI-compatible server
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("error en la solicitud a %s: %s: %s", e.URL, e.Status, e.Body)
+}
+
+// withRetry runs fn until it succeeds, fails with a permanent error or the
+// retry budget is exhausted. fn is called again from scratch on each attempt.
+func withRetry(ctx context.Context, retry config.RetryConfig, operation string, fn func() error) error {
+	retry = retry.WithDefaults()
+	attempts := retry.MaxRetries + 1
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		logger.Debug("%s: intento %d de %d", operation, attempt, attempts)
+
+		err = fn()
+		if err == nil {
+			if attempt > 1 {
+				logger.Info("%s: completado en el intento %d", operation, attempt)
+			}
+			return nil
+		}
+
+		kind := classifyError(err)
+		if kind == "" || ctx.Err() != nil {
+			return err
+		}
+
+		if attempt == attempts {
+			logger.Error("%s: intento %d falló (%s), sin reintentos restantes: %v", operation, attempt, kind, err)
+			return &RetryError{Kind: kind, Attempts: attempt, Err: err}
+		}
+
+		delay := backoffDelay(retry, attempt, retryAfter(err))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			logger.Error("%s: intento %d falló (%s), la espera de %s supera el límite de tiempo: %v", operation, attempt, kind, delay.Round(time.Millisecond), err)
+			return &RetryError{Kind: kind, Attempts: attempt, Err: err}
+		}
+		logger.Warn("%s: intento %d falló (%s), reintentando en %s: %v", operation, attempt, kind, delay.Round(time.Millisecond), err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
+
+// classifyError returns the failure kind of a retryable error, or "" if the
+// error is permanent
+func classifyError(err error) string {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ""
+	}
+
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		return classifyStatus(apiErr.StatusCode)
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return classifyStatus(statusErr.StatusCode)
+	}
+
+	// Errors sent as SSE events in the middle of a stream
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "rate_limit_error"):
+		return FailureQuota
+	case strings.Contains(msg, "overloaded_error"), strings.Contains(msg, "api_error"):
+		return FailureOverload
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return FailureNetwork
+	}
+	if strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe") {
+		return FailureNetwork
+	}
+
+	return ""
+}
+
+// classifyStatus returns the failure kind of an HTTP status, or "" if it is
+// permanent
+func classifyStatus(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return FailureQuota
+	case status == 529, status >= 500:
+		return FailureOverload
+	case status == http.StatusRequestTimeout, status == http.StatusConflict:
+		return FailureNetwork
+	}
+	return ""
+}
+
+// retryAfter returns the delay requested by the server, if any
+func retryAfter(err error) time.Duration {
+	var header http.Header
+	var apiErr *anthropic.Error
+	var statusErr *StatusError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Response != nil:
+		header = apiErr.Response.Header
+	case errors.As(err, &statusErr):
+		header = statusErr.Header
+	default:
+		return 0
+	}
+
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := header.Get("retry-after")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// backoffDelay returns the wait before the next attempt: the server's
+// retry-after when present, otherwise exponential backoff with jitter. Both
+// are capped at MaxDelay.
+func backoffDelay(retry config.RetryConfig, attempt int, serverDelay time.Duration) time.Duration {
+	if serverDelay > 0 {
+		return min(serverDelay, retry.MaxDelay)
+	}
+
+	delay := retry.InitialDelay << (attempt - 1)
+	if delay <= 0 || delay > retry.MaxDelay {
+		delay = retry.MaxDelay
+	}
+
+	// Full jitter over the upper half of the window
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"orgmprop/internal/config"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	retry := config.RetryConfig{InitialDelay: 2 * time.Second, MaxDelay: 60 * time.Second}
+
+	tests := []struct {
+		name        string
+		attempt     int
+		serverDelay time.Duration
+		min, max    time.Duration
+	}{
+		{"primer intento", 1, 0, time.Second, 2 * time.Second},
+		{"tercer intento", 3, 0, 4 * time.Second, 8 * time.Second},
+		{"backoff limitado", 10, 0, 30 * time.Second, 60 * time.Second},
+		{"retry-after respetado", 1, 5 * time.Second, 5 * time.Second, 5 * time.Second},
+		{"retry-after limitado", 1, time.Hour, 60 * time.Second, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := backoffDelay(retry, tt.attempt, tt.serverDelay)
+			if got < tt.min || got > tt.max {
+				t.Errorf("backoffDelay = %s, want between %s and %s", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestClassifyStatusError(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusTooManyRequests, FailureQuota},
+		{http.StatusServiceUnavailable, FailureOverload},
+		{529, FailureOverload},
+		{http.StatusRequestTimeout, FailureNetwork},
+		{http.StatusBadRequest, ""},
+		{http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		err := &StatusError{StatusCode: tt.status, Status: http.StatusText(tt.status)}
+		if got := classifyError(err); got != tt.want {
+			t.Errorf("classifyError(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfterStatusError(t *testing.T) {
+	err := &StatusError{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"3"}}}
+	if got := retryAfter(err); got != 3*time.Second {
+		t.Errorf("retryAfter = %s, want 3s", got)
+	}
+}
@@ -0,0 +1,180 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// toolRepairRounds is how many times invalid tool input is sent back to the model
+const toolRepairRounds = 1
+
+// Tool describes a tool the model is forced to call, so the response is
+// structured data matching InputSchema instead of free text
+type Tool struct {
+	Name        string
+	Description string
+	// InputSchema is a JSON Schema of type object
+	InputSchema map[string]interface{}
+	// Validate optionally checks the input beyond the schema
+	Validate func(input json.RawMessage) error
+}
+
+// SchemaError lists every place where a value does not match a schema
+type SchemaError struct {
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return "no cumple el esquema: " + strings.Join(e.Problems, "; ")
+}
+
+// validateToolInput checks tool input against the tool schema and validator
+func validateToolInput(tool *Tool, input json.RawMessage) error {
+	var value interface{}
+	if err := json.Unmarshal(input, &value); err != nil {
+		return fmt.Errorf("JSON inválido: %w", err)
+	}
+
+	if problems := ValidateSchema(tool.InputSchema, value); len(problems) > 0 {
+		return &SchemaError{Problems: problems}
+	}
+
+	if tool.Validate != nil {
+		return tool.Validate(input)
+	}
+
+	return nil
+}
+
+// toolRepairPrompt is the tool result sent back when the input is invalid
+func toolRepairPrompt(err error) string {
+	return fmt.Sprintf("La entrada no es válida: %v\n\nVuelve a llamar la herramienta con la entrada completa corregida.", err)
+}
+
+// ValidateSchema checks value against a JSON Schema subset (type, required,
+// properties, items, enum) and returns the problems found
+func ValidateSchema(schema map[string]interface{}, value interface{}) []string {
+	var problems []string
+	validateSchemaAt(schema, value, "$", &problems)
+	return problems
+}
+
+// validateSchemaAt validates value at path, appending problems
+func validateSchemaAt(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	if schema == nil {
+		return
+	}
+
+	if typ, ok := schema["type"].(string); ok && !matchesType(typ, value) {
+		*problems = append(*problems, fmt.Sprintf("%s: se esperaba %s, se recibió %s", path, typ, jsonType(value)))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			if fmt.Sprint(option) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			*problems = append(*problems, fmt.Sprintf("%s: valor %v no permitido", path, value))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: falta el campo requerido %q", path, name))
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child, ok := v[name]
+			if !ok {
+				continue
+			}
+			if sub, ok := properties[name].(map[string]interface{}); ok {
+				validateSchemaAt(sub, child, path+"."+name, problems)
+			}
+		}
+
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateSchemaAt(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	}
+}
+
+// matchesType reports whether value has the given JSON Schema type
+func matchesType(typ string, value interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// jsonType returns the JSON type name of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// stringList converts a decoded YAML or JSON list to strings
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["datos", "items"],
+	"properties": {
+		"datos": {
+			"type": "object",
+			"required": ["cliente"],
+			"properties": {
+				"cliente": {"type": "string"},
+				"moneda": {"type": "string", "enum": ["DOP", "USD"]}
+			}
+		},
+		"items": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["cantidad"],
+				"properties": {
+					"cantidad": {"type": "integer"},
+					"precio": {"type": "number"},
+					"activo": {"type": "boolean"},
+					"nota": {"type": "null"}
+				}
+			}
+		}
+	}
+}`
+
+func TestValidateSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(testSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{
+			name:  "válido",
+			value: `{"datos": {"cliente": "ACME", "moneda": "DOP"}, "items": [{"cantidad": 2, "precio": 10.5, "activo": true, "nota": null}]}`,
+		},
+		{
+			name:  "campos extra permitidos",
+			value: `{"datos": {"cliente": "ACME", "extra": 1}, "items": []}`,
+		},
+		{
+			name:  "no es objeto",
+			value: `[]`,
+			want:  []string{"$: se esperaba object, se recibió array"},
+		},
+		{
+			name:  "requeridos faltantes",
+			value: `{"datos": {}}`,
+			want: []string{
+				`$: falta el campo requerido "items"`,
+				`$.datos: falta el campo requerido "cliente"`,
+			},
+		},
+		{
+			name:  "tipos incorrectos",
+			value: `{"datos": {"cliente": 5}, "items": [{"cantidad": 1.5, "precio": "10", "activo": "sí", "nota": 0}]}`,
+			want: []string{
+				"$.datos.cliente: se esperaba string, se recibió number",
+				"$.items[0].activo: se esperaba boolean, se recibió string",
+				"$.items[0].cantidad: se esperaba integer, se recibió number",
+				"$.items[0].nota: se esperaba null, se recibió number",
+				"$.items[0].precio: se esperaba number, se recibió string",
+			},
+		},
+		{
+			name:  "enum",
+			value: `{"datos": {"cliente": "ACME", "moneda": "EUR"}, "items": []}`,
+			want:  []string{"$.datos.moneda: valor EUR no permitido"},
+		},
+		{
+			name:  "cada elemento de la lista",
+			value: `{"datos": {"cliente": "ACME"}, "items": [{"cantidad": 1}, {}, "x"]}`,
+			want: []string{
+				`$.items[1]: falta el campo requerido "cantidad"`,
+				"$.items[2]: se esperaba object, se recibió string",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			if got := ValidateSchema(schema, value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateSchema =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimCodeFence(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: `{"a": 1}`, want: `{"a": 1}`},
+		{text: "```json\n{\"a\": 1}\n```", want: `{"a": 1}`},
+		{text: "```\n{\"a\": 1}\n```\n", want: `{"a": 1}`},
+		{text: "  ```JSON\n{\"json\": 1}\n```  ", want: `{"json": 1}`},
+	}
+
+	for _, tt := range tests {
+		if got := trimCodeFence(tt.text); got != tt.want {
+			t.Errorf("trimCodeFence(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	tool := &Tool{Name: "guardar"}
+	tests := []struct {
+		name string
+		req  Request
+		want int64
+	}{
+		{name: "por defecto", req: Request{}, want: 8192},
+		{name: "configurado", req: Request{MaxTokens: 16000, MaxOutputTokens: 64000}, want: 16000},
+		{name: "herramienta usa el máximo del modelo", req: Request{MaxTokens: 8192, MaxOutputTokens: 64000, Tool: tool}, want: 64000},
+		{name: "herramienta sin catálogo", req: Request{MaxTokens: 8192, Tool: tool}, want: 8192},
+		{name: "herramienta con límite mayor al modelo", req: Request{MaxTokens: 32000, MaxOutputTokens: 16000, Tool: tool}, want: 32000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.OutputLimit(); got != tt.want {
+				t.Errorf("OutputLimit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
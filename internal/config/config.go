@@ -1,10 +1,14 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"orgmprop/internal/logger"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,42 +16,132 @@ import (
 const (
 	DefaultModel = "claude-sonnet-4-5-20250929"
 	DotfilesURL  = "https://github.com/osmargm1202/dotfiles.git"
+
+	DefaultOpenAIBaseURL = "http://localhost:11434/v1"
+
+	DefaultMaxRetries   = 4
+	DefaultInitialDelay = 2 * time.Second
+	DefaultMaxDelay     = 60 * time.Second
+
+	DefaultRequestTimeout = 10 * time.Minute
+
+	DefaultMaxTokens        = 8192
+	DefaultMaxContinuations = 4
+
+	DefaultBatchWorkers = 4
+
+	// firstSyncTimeout bounds the template source fetch of the first run,
+	// after which the embedded templates are used
+	firstSyncTimeout = 30 * time.Second
 )
 
+// AI providers
+const (
+	ProviderAnthropic = "anthropic"
+	ProviderOpenAI    = "openai"
+	ProviderFake      = "fake"
+)
+
+// ConfigDir and ConfigFile are resolved from ORGMPROP_CONFIG_DIR,
+// ORGMPROP_CONFIG and XDG_CONFIG_HOME; see SetConfigDir and SetConfigFile
 var (
-	ConfigDir  = filepath.Join(os.Getenv("HOME"), ".config", "orgmprop")
-	ConfigFile = filepath.Join(ConfigDir, "config.yaml")
+	ConfigDir  = defaultConfigDir()
+	ConfigFile = defaultConfigFile()
 )
 
 // Config represents the application configuration
 type Config struct {
+	// Version is the layout of config.yaml; see CurrentConfigVersion
+	Version int `yaml:"version,omitempty"`
+
+	// AnthropicAPIKey is only read from config.yaml to migrate it; keys are
+	// kept in the Secret Service or credenciales.enc
 	AnthropicAPIKey string `yaml:"anthropic_api_key"`
-	Model           string `yaml:"model"`
-	BaseFolder      string `yaml:"base_folder"`
+	// APIKeyCommand prints the API key, e.g. "pass show anthropic"
+	APIKeyCommand string `yaml:"api_key_command,omitempty"`
+	Model         string `yaml:"model"`
+	BaseFolder    string `yaml:"base_folder"`
+
+	// Provider selects the AI backend: anthropic (default), openai or fake
+	Provider        string `yaml:"provider,omitempty"`
+	OpenAIBaseURL   string `yaml:"openai_base_url,omitempty"`
+	OpenAIAPIKey    string `yaml:"openai_api_key,omitempty"`
+	OpenAIModel     string `yaml:"openai_model,omitempty"`
+	FakeFixturesDir string `yaml:"fake_fixtures_dir,omitempty"`
+
+	Retry RetryConfig `yaml:"retry,omitempty"`
+	// RequestTimeout is the deadline for a single generation; negative disables it
+	RequestTimeout time.Duration `yaml:"request_timeout,omitempty"`
+
+	// MaxTokens is the output token limit per document type (propuesta, presupuesto)
+	MaxTokens map[string]int64 `yaml:"max_tokens,omitempty"`
+	// MaxContinuations limits the continuation turns sent when output hits
+	// max_tokens; negative disables continuations
+	MaxContinuations int `yaml:"max_continuations,omitempty"`
+
+	// Prices overrides the default price table, keyed by model
+	Prices map[string]ModelPrice `yaml:"prices,omitempty"`
+
+	// BatchWorkers limits the concurrent generations of orgmprop batch
+	BatchWorkers int `yaml:"batch_workers,omitempty"`
+
+	// Tenant selects the company profile injected into prompts and budgets
+	Tenant  string            `yaml:"tenant,omitempty"`
+	Tenants map[string]Tenant `yaml:"tenants,omitempty"`
+
+	// TemplateSource is where orgmprop templates sync fetches templates from
+	TemplateSource TemplateSourceConfig `yaml:"template_source,omitempty"`
 }
 
-// Load loads the configuration from YAML file
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input  float64 `yaml:"input" json:"input"`
+	Output float64 `yaml:"output" json:"output"`
+}
+
+// RetryConfig controls how failed AI requests are retried.
+// A negative MaxRetries disables retries.
+type RetryConfig struct {
+	MaxRetries   int           `yaml:"max_retries"`
+	InitialDelay time.Duration `yaml:"initial_delay"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
+}
+
+// WithDefaults returns a copy of the retry config with unset values filled in
+func (r RetryConfig) WithDefaults() RetryConfig {
+	if r.MaxRetries == 0 {
+		r.MaxRetries = DefaultMaxRetries
+	}
+	if r.MaxRetries < 0 {
+		r.MaxRetries = 0
+	}
+	if r.InitialDelay <= 0 {
+		r.InitialDelay = DefaultInitialDelay
+	}
+	if r.MaxDelay <= 0 {
+		r.MaxDelay = DefaultMaxDelay
+	}
+	return r
+}
+
+// Load loads the effective configuration: embedded defaults, then the user
+// config, the project's .orgmprop.yaml, ORGMPROP_* variables and flags
 func Load() (*Config, error) {
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(ConfigDir, 0755); err != nil {
 		return nil, fmt.Errorf("error creando directorio de configuración: %w", err)
 	}
 
-	// If file doesn't exist, return default config
-	if _, err := os.Stat(ConfigFile); os.IsNotExist(err) {
-		return &Config{
-			Model: DefaultModel,
-		}, nil
-	}
-
-	// Read file
-	data, err := os.ReadFile(ConfigFile)
+	layers, err := loadLayers()
 	if err != nil {
-		return nil, fmt.Errorf("error leyendo archivo de configuración: %w", err)
+		return nil, err
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	warnUnknownKeys(layers)
+
+	merged, _ := mergeLayers(layers)
+	config, err := decodeConfig(merged)
+	if err != nil {
 		return nil, fmt.Errorf("error parseando configuración: %w", err)
 	}
 
@@ -56,42 +150,101 @@ func Load() (*Config, error) {
 		config.Model = DefaultModel
 	}
 
-	return &config, nil
+	return config, nil
 }
 
-// Save saves the configuration to YAML file
+// Save saves the configuration to the user YAML file. Only settings that
+// differ from the effective configuration are written, so values coming
+// from defaults, the project, the environment or flags stay out of it.
 func Save(config *Config) error {
 	// Create directory if it doesn't exist
-	if err := os.MkdirAll(ConfigDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(ConfigFile), 0755); err != nil {
 		return fmt.Errorf("error creando directorio de configuración: %w", err)
 	}
 
+	layers, err := loadLayers()
+	if err != nil {
+		return err
+	}
+
+	merged, _ := mergeLayers(layers)
+	effectiveConfig, err := decodeConfig(merged)
+	if err != nil {
+		return fmt.Errorf("error parseando configuración: %w", err)
+	}
+	if effectiveConfig.Model == "" {
+		effectiveConfig.Model = DefaultModel
+	}
+
+	effective, err := configValues(effectiveConfig)
+	if err != nil {
+		return fmt.Errorf("error serializando configuración: %w", err)
+	}
+	current, err := configValues(config)
+	if err != nil {
+		return fmt.Errorf("error serializando configuración: %w", err)
+	}
+
+	var user map[string]interface{}
+	for _, l := range layers {
+		if l.source == SourceUser {
+			user = l.values
+		}
+	}
+	changes := userChanges(user, current, effective)
+
+	// The API key goes to a secure store instead of the YAML file. Save never
+	// prompts: the encrypted store needs ORGMPROP_PASSPHRASE here, otherwise
+	// StoreAPIKey moves the key later
+	if key, _ := changes[apiKeyAccount].(string); key != "" && isStoredAPIKey(key) {
+		delete(changes, apiKeyAccount)
+	} else if key != "" {
+		if _, err := storeAPIKey(key, nil); err != nil {
+			logger.Warn("No se pudo guardar la API key de forma segura; queda en texto plano: %v", err)
+		} else {
+			delete(changes, apiKeyAccount)
+		}
+	}
+
+	return writeUserValues(changes)
+}
+
+// writeUserValues writes the user config file, readable only by its owner
+func writeUserValues(values map[string]interface{}) error {
+	values["version"] = CurrentConfigVersion
+	return writeValuesTo(ConfigFile, values)
+}
+
+// writeValuesTo writes a config file readable only by its owner
+func writeValuesTo(path string, values map[string]interface{}) error {
 	// Serialize to YAML
-	data, err := yaml.Marshal(config)
+	data, err := yaml.Marshal(values)
 	if err != nil {
 		return fmt.Errorf("error serializando configuración: %w", err)
 	}
 
 	// Write file
-	if err := os.WriteFile(ConfigFile, data, 0644); err != nil {
+	if err := os.WriteFile(path, data, 0600); err != nil {
 		return fmt.Errorf("error escribiendo archivo de configuración: %w", err)
 	}
 
+	// Tighten files created by older versions with 0644
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("error ajustando permisos de configuración: %w", err)
+	}
+
 	return nil
 }
 
-// GetAPIKey returns the API key or error if not configured
+// GetAPIKey returns the API key or error if not configured. See
+// Config.ResolveAPIKey for the backends it is looked up in.
 func GetAPIKey() (string, error) {
 	config, err := Load()
 	if err != nil {
 		return "", err
 	}
 
-	if config.AnthropicAPIKey == "" {
-		return "", fmt.Errorf("API key no configurada. Ejecuta 'orgmprop config apikey'")
-	}
-
-	return config.AnthropicAPIKey, nil
+	return config.ResolveAPIKey()
 }
 
 // GetModel returns the configured model
@@ -122,112 +275,157 @@ func GetBaseFolder() (string, error) {
 	return config.BaseFolder, nil
 }
 
-// AvailableModels returns the list of available Anthropic models
+// AvailableModels returns the Anthropic models of the cached or embedded
+// catalog. Use ai.ModelCatalog to refresh it from the API.
 func AvailableModels() []string {
-	return []string{
-		"claude-sonnet-4-5-20250929",
-		"claude-haiku-4-5-20251001",
-		"claude-3-5-sonnet-20241022",
-		"claude-3-opus-20240229",
+	return LoadModelCatalog(ProviderAnthropic).IDs()
+}
+
+// GetProvider returns the configured AI provider
+func (c *Config) GetProvider() string {
+	if c.Provider == "" {
+		return ProviderAnthropic
 	}
+	return c.Provider
 }
 
-// EnsureConfigFiles ensures all config files exist, downloading from dotfiles if needed
-func EnsureConfigFiles() error {
-	requiredFiles := []string{
-		"template.css",
-		"propuesta.yaml",
-		"html_template.yaml",
-		"presupuesto.yaml",
-		"logo.svg",
+// ActiveModel returns the model used by the configured provider
+func (c *Config) ActiveModel() string {
+	if c.GetProvider() == ProviderOpenAI {
+		return c.OpenAIModel
 	}
+	return c.Model
+}
 
-	// Check if any file is missing
-	missingFiles := []string{}
-	for _, file := range requiredFiles {
-		filePath := filepath.Join(ConfigDir, file)
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			missingFiles = append(missingFiles, file)
-		}
+// WithModel returns a copy of the config that uses another model with the
+// configured provider
+func (c *Config) WithModel(model string) *Config {
+	copied := *c
+	if copied.GetProvider() == ProviderOpenAI {
+		copied.OpenAIModel = model
+	} else {
+		copied.Model = model
 	}
+	return &copied
+}
 
-	if len(missingFiles) == 0 {
-		return nil
+// MaxTokensFor returns the output token limit for a document type, capped
+// at the maximum output of the active model when the catalog knows it
+func (c *Config) MaxTokensFor(kind string) int64 {
+	maxTokens := int64(DefaultMaxTokens)
+	if configured, ok := c.MaxTokens[kind]; ok && configured > 0 {
+		maxTokens = configured
 	}
 
-	// Try to download from dotfiles
-	if err := downloadDotfiles(); err != nil {
-		// If dotfiles download fails, copy from embedded assets
-		return copyFromEmbeddedAssets(missingFiles)
+	if info, ok := LookupModel(c.GetProvider(), c.ActiveModel()); ok && info.MaxOutputTokens > 0 && maxTokens > info.MaxOutputTokens {
+		return info.MaxOutputTokens
 	}
+	return maxTokens
+}
 
-	return nil
+// ModelMaxOutputTokens returns the maximum output of the active model from
+// the catalog, or zero when unknown
+func (c *Config) ModelMaxOutputTokens() int64 {
+	if info, ok := LookupModel(c.GetProvider(), c.ActiveModel()); ok {
+		return info.MaxOutputTokens
+	}
+	return 0
 }
 
-// downloadDotfiles downloads configuration from dotfiles repository
-func downloadDotfiles() error {
-	downloadsDir := filepath.Join(os.Getenv("HOME"), "Downloads")
-	dotfilesDir := filepath.Join(downloadsDir, "dotfiles")
+// GetMaxContinuations returns the configured continuation limit
+func (c *Config) GetMaxContinuations() int {
+	if c.MaxContinuations == 0 {
+		return DefaultMaxContinuations
+	}
+	if c.MaxContinuations < 0 {
+		return 0
+	}
+	return c.MaxContinuations
+}
 
-	// Create downloads dir if it doesn't exist
-	if err := os.MkdirAll(downloadsDir, 0755); err != nil {
-		return fmt.Errorf("error creando directorio Downloads: %w", err)
+// GetBatchWorkers returns the configured worker pool size for batches
+func (c *Config) GetBatchWorkers() int {
+	if c.BatchWorkers <= 0 {
+		return DefaultBatchWorkers
 	}
+	return c.BatchWorkers
+}
 
-	// Remove existing dotfiles dir
-	os.RemoveAll(dotfilesDir)
+// PriceFor returns the price of a model, preferring the configured table
+// over the model catalog
+func (c *Config) PriceFor(model string) (ModelPrice, bool) {
+	return c.PriceForProvider(c.GetProvider(), model)
+}
 
-	// Clone dotfiles repository
-	cmd := exec.Command("git", "clone", "--depth", "1", DotfilesURL, dotfilesDir)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error clonando dotfiles: %w", err)
+// PriceForProvider returns the price of a model of the given provider,
+// preferring the configured table. With no provider, the model is looked up
+// in the catalog of every provider.
+func (c *Config) PriceForProvider(provider, model string) (ModelPrice, bool) {
+	if price, ok := c.Prices[model]; ok {
+		return price, true
 	}
 
-	// Copy orgmprop config files
-	orgmpropDir := filepath.Join(dotfilesDir, ".config", "orgmprop")
-	if _, err := os.Stat(orgmpropDir); os.IsNotExist(err) {
-		return fmt.Errorf("directorio orgmprop no encontrado en dotfiles")
+	providers := []string{provider}
+	if provider == "" {
+		providers = AvailableProviders()
 	}
+	for _, provider := range providers {
+		if info, ok := LookupModel(provider, model); ok && info.Price != nil {
+			return *info.Price, true
+		}
+	}
+	return ModelPrice{}, false
+}
 
-	// Copy files
-	entries, err := os.ReadDir(orgmpropDir)
-	if err != nil {
-		return fmt.Errorf("error leyendo directorio orgmprop en dotfiles: %w", err)
+// AvailableProviders returns the list of supported AI providers
+func AvailableProviders() []string {
+	return []string{
+		ProviderAnthropic,
+		ProviderOpenAI,
+		ProviderFake,
 	}
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+// EnsureConfigFiles ensures all config files exist, syncing them from the
+// template source if needed
+func EnsureConfigFiles() error {
+	// Check if any file is missing
+	missingFiles := []string{}
+	for _, file := range TemplateFiles {
+		filePath := filepath.Join(ConfigDir, file)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			missingFiles = append(missingFiles, file)
 		}
+	}
 
-		src := filepath.Join(orgmpropDir, entry.Name())
-		dst := filepath.Join(ConfigDir, entry.Name())
-
-		// Don't overwrite existing config.yaml
-		if entry.Name() == "config.yaml" {
-			if _, err := os.Stat(dst); err == nil {
-				continue
-			}
+	if len(missingFiles) == 0 {
+		if outdated, err := OutdatedTemplates(); err == nil && len(outdated) > 0 {
+			logger.Info("Hay nuevas versiones de plantillas (%s). Ejecuta 'orgmprop templates upgrade'", strings.Join(outdated, ", "))
 		}
+		return nil
+	}
 
-		data, err := os.ReadFile(src)
-		if err != nil {
-			continue
-		}
+	cfg, err := Load()
+	if err != nil {
+		cfg = &Config{}
+	}
 
-		if err := os.WriteFile(dst, data, 0644); err != nil {
-			continue
-		}
+	// Only missing files are taken from the template source, existing ones
+	// are updated with orgmprop templates sync
+	ctx, cancel := context.WithTimeout(context.Background(), firstSyncTimeout)
+	defer cancel()
+	if _, err := syncTemplates(ctx, cfg, missingFiles, false); err != nil {
+		// If the source is unavailable, copy from embedded assets
+		logger.Warn("No se pudo sincronizar la fuente de plantillas, usando archivos embebidos: %v", err)
+		return copyFromEmbeddedAssets(missingFiles)
 	}
 
-	return nil
-}
+	// Files the source does not provide come from embedded assets
+	if missing := ListMissingConfigFiles(); len(missing) > 0 {
+		return copyFromEmbeddedAssets(missing)
+	}
 
-// copyFromEmbeddedAssets copies missing files from embedded assets
-func copyFromEmbeddedAssets(missingFiles []string) error {
-	// This will be implemented using the assets package
-	// For now, we'll return an error indicating manual setup is needed
-	return fmt.Errorf("archivos de configuración faltantes: %v. Ejecuta el instalador o copia manualmente", missingFiles)
+	return nil
 }
 
 // GetConfigFilePath returns the path to a config file
@@ -257,16 +455,8 @@ func CopyTemplateFile(srcPath, destName string) error {
 
 // ListMissingConfigFiles returns a list of missing configuration files
 func ListMissingConfigFiles() []string {
-	requiredFiles := []string{
-		"template.css",
-		"propuesta.yaml",
-		"html_template.yaml",
-		"presupuesto.yaml",
-		"logo.svg",
-	}
-
 	missing := []string{}
-	for _, file := range requiredFiles {
+	for _, file := range TemplateFiles {
 		filePath := filepath.Join(ConfigDir, file)
 		if _, err := os.Stat(filePath); os.IsNotExist(err) {
 			missing = append(missing, file)
@@ -275,4 +465,3 @@ func ListMissingConfigFiles() []string {
 
 	return missing
 }
-
@@ -0,0 +1,450 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"orgmprop/assets"
+	"orgmprop/internal/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration sources, from lowest to highest precedence
+const (
+	SourceDefault = "embebido"
+	SourceUser    = "usuario"
+	SourceProject = "proyecto"
+	SourceEnv     = "entorno"
+	SourceFlag    = "flag"
+)
+
+const (
+	// EnvPrefix prefixes the environment variables that override settings.
+	// Nested keys use a double underscore: ORGMPROP_MAX_TOKENS__PRESUPUESTO.
+	EnvPrefix = "ORGMPROP_"
+	// EnvConfigDir overrides the user configuration directory
+	EnvConfigDir = "ORGMPROP_CONFIG_DIR"
+	// EnvConfigFile overrides the user configuration file
+	EnvConfigFile = "ORGMPROP_CONFIG"
+
+	// ProjectConfigFileName is the project-local config, looked up from the
+	// current directory upwards
+	ProjectConfigFileName = ".orgmprop.yaml"
+)
+
+// flagOverrides holds the settings given as command line flags
+var flagOverrides = map[string]string{}
+
+// layer is the set of values read from one configuration source
+type layer struct {
+	source string
+	// origin is the file or variable the values came from
+	origin string
+	values map[string]interface{}
+}
+
+// Setting is the effective value of a setting and where it came from
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+	Origin string
+}
+
+// defaultConfigDir returns the user configuration directory, honoring
+// ORGMPROP_CONFIG_DIR and XDG_CONFIG_HOME
+func defaultConfigDir() string {
+	if dir := os.Getenv(EnvConfigDir); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "orgmprop")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "orgmprop")
+}
+
+// defaultConfigFile returns the user configuration file, honoring
+// ORGMPROP_CONFIG
+func defaultConfigFile() string {
+	if file := os.Getenv(EnvConfigFile); file != "" {
+		return file
+	}
+	return filepath.Join(ConfigDir, "config.yaml")
+}
+
+// SetConfigDir changes the user configuration directory, as with a
+// --config-dir flag. The config file moves with it unless set explicitly.
+func SetConfigDir(dir string) {
+	if ConfigFile == filepath.Join(ConfigDir, "config.yaml") {
+		ConfigFile = filepath.Join(dir, "config.yaml")
+	}
+	ConfigDir = dir
+}
+
+// SetConfigFile changes the user configuration file, as with a --config flag
+func SetConfigFile(path string) {
+	ConfigFile = path
+}
+
+// SetFlag overrides a setting from a command line flag. Nested keys are
+// separated by dots, as in max_tokens.presupuesto.
+func SetFlag(key, value string) {
+	flagOverrides[key] = value
+}
+
+// loadLayers reads every configuration source, from lowest to highest precedence
+func loadLayers() ([]layer, error) {
+	var layers []layer
+
+	defaults, err := assets.GetDefaultConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo configuración embebida: %w", err)
+	}
+	values, err := parseLayer(defaults)
+	if err != nil {
+		return nil, fmt.Errorf("error parseando configuración embebida: %w", err)
+	}
+	layers = append(layers, layer{source: SourceDefault, origin: "config.yaml", values: values})
+
+	user, err := loadFileLayer(SourceUser, ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateUserFile(&user); err != nil {
+		return nil, err
+	}
+	layers = append(layers, user)
+
+	if path := findProjectConfig(); path != "" {
+		project, err := loadFileLayer(SourceProject, path)
+		if err != nil {
+			return nil, err
+		}
+		// The project file is shared, so it is only migrated in memory
+		if applied, err := migrateValues(project.values, false); err != nil {
+			logger.Warn("%s: %v", path, err)
+		} else if len(applied) > 0 {
+			logger.Debug("%s migrado en memoria: %s", path, strings.Join(applied, ", "))
+		}
+		layers = append(layers, project)
+	}
+
+	env, err := envLayer()
+	if err != nil {
+		return nil, err
+	}
+	flags, err := flagLayer()
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, env, flags)
+	return layers, nil
+}
+
+// loadFileLayer reads a YAML layer; a missing file is an empty layer
+func loadFileLayer(source, path string) (layer, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return layer{source: source, origin: path, values: map[string]interface{}{}}, nil
+	}
+	if err != nil {
+		return layer{}, fmt.Errorf("error leyendo archivo de configuración %s: %w", path, err)
+	}
+
+	values, err := parseLayer(data)
+	if err != nil {
+		return layer{}, fmt.Errorf("error parseando configuración %s: %w", path, err)
+	}
+
+	return layer{source: source, origin: path, values: values}, nil
+}
+
+// parseLayer parses YAML into a generic map
+func parseLayer(data []byte) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// findProjectConfig looks for .orgmprop.yaml from the current directory up
+func findProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		path := filepath.Join(dir, ProjectConfigFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// envLayer reads the ORGMPROP_* environment variables
+func envLayer() (layer, error) {
+	values := map[string]interface{}{}
+	for _, entry := range os.Environ() {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) || name == EnvConfigDir || name == EnvConfigFile || name == EnvPassphrase {
+			continue
+		}
+
+		path := strings.Split(strings.ToLower(strings.TrimPrefix(name, EnvPrefix)), "__")
+		typed, err := typedValue(path, value)
+		if err != nil {
+			return layer{}, fmt.Errorf("valor inválido en %s: %w", name, err)
+		}
+		setPath(values, path, typed)
+	}
+	return layer{source: SourceEnv, origin: EnvPrefix + "*", values: values}, nil
+}
+
+// flagLayer reads the settings given as command line flags
+func flagLayer() (layer, error) {
+	values := map[string]interface{}{}
+	for key, value := range flagOverrides {
+		path := strings.Split(key, ".")
+		typed, err := typedValue(path, value)
+		if err != nil {
+			return layer{}, fmt.Errorf("valor inválido en --%s: %w", key, err)
+		}
+		setPath(values, path, typed)
+	}
+	return layer{source: SourceFlag, origin: "línea de comandos", values: values}, nil
+}
+
+// typedValue decodes an environment or flag value against the type of the
+// setting at path: strings stay strings, integers are decimal and durations
+// take a unit or a number of seconds. Unknown settings are kept as strings.
+func typedValue(path []string, value string) (interface{}, error) {
+	t := settingType(reflect.TypeOf(Config{}), path)
+	if t == nil {
+		return value, nil
+	}
+
+	if t == reflect.TypeOf(time.Duration(0)) {
+		if _, err := time.ParseDuration(value); err == nil {
+			return value, nil
+		}
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return fmt.Sprintf("%ds", seconds), nil
+		}
+		return nil, fmt.Errorf("%q no es una duración (por ejemplo 300s o 5m)", value)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return value, nil
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q no es true ni false", value)
+		}
+		return parsed, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q no es un número entero", value)
+		}
+		return parsed, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q no es un número entero positivo", value)
+		}
+		return parsed, nil
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q no es un número", value)
+		}
+		return parsed, nil
+	}
+
+	// Maps, lists and structs are given as YAML
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// settingType returns the type of the setting at path inside t, or nil when
+// t does not define it
+func settingType(t reflect.Type, path []string) reflect.Type {
+	for _, key := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := yamlFields(t)[key]
+			if !ok {
+				return nil
+			}
+			t = field
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil
+		}
+	}
+	return t
+}
+
+// setPath sets a nested value, creating the intermediate maps
+func setPath(values map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := values[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			values[key] = next
+		}
+		values = next
+	}
+	values[path[len(path)-1]] = value
+}
+
+// mergeLayers merges the layers in order, recording the layer of every leaf
+func mergeLayers(layers []layer) (map[string]interface{}, map[string]layer) {
+	merged := map[string]interface{}{}
+	sources := map[string]layer{}
+	for _, l := range layers {
+		mergeValues(merged, l.values, "", l, sources)
+	}
+	return merged, sources
+}
+
+// mergeValues deep-merges src into dst
+func mergeValues(dst, src map[string]interface{}, prefix string, l layer, sources map[string]layer) {
+	for key, value := range src {
+		path := prefix + key
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			dstMap, ok := dst[key].(map[string]interface{})
+			if !ok {
+				dstMap = map[string]interface{}{}
+				dst[key] = dstMap
+			}
+			mergeValues(dstMap, srcMap, path+".", l, sources)
+			continue
+		}
+		dst[key] = value
+		sources[path] = l
+	}
+}
+
+// decodeConfig converts merged values into a Config
+func decodeConfig(values map[string]interface{}) (*Config, error) {
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// configValues converts a Config into generic values, as it would be saved
+func configValues(config *Config) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return parseLayer(data)
+}
+
+// userChanges returns the user layer updated with the values of current that
+// differ from the effective configuration, so saving never copies values of
+// the other layers into the user file
+func userChanges(user, current, effective map[string]interface{}) map[string]interface{} {
+	if user == nil {
+		user = map[string]interface{}{}
+	}
+
+	for key, value := range current {
+		if currentMap, ok := value.(map[string]interface{}); ok {
+			effectiveMap, _ := effective[key].(map[string]interface{})
+			userMap, _ := user[key].(map[string]interface{})
+			if changed := userChanges(userMap, currentMap, effectiveMap); len(changed) > 0 {
+				user[key] = changed
+			}
+			continue
+		}
+		if !reflect.DeepEqual(value, effective[key]) {
+			user[key] = value
+		}
+	}
+
+	// Settings removed from the config are removed from the user file
+	for key := range effective {
+		if _, ok := current[key]; !ok {
+			delete(user, key)
+		}
+	}
+
+	return user
+}
+
+// Settings returns the effective value of every setting and its source.
+// API keys are masked.
+func Settings() ([]Setting, error) {
+	layers, err := loadLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	merged, sources := mergeLayers(layers)
+	var settings []Setting
+	collectSettings(merged, "", sources, &settings)
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+
+	return settings, nil
+}
+
+// collectSettings flattens merged values into settings
+func collectSettings(values map[string]interface{}, prefix string, sources map[string]layer, settings *[]Setting) {
+	for key, value := range values {
+		path := prefix + key
+		if nested, ok := value.(map[string]interface{}); ok {
+			collectSettings(nested, path+".", sources, settings)
+			continue
+		}
+
+		display := fmt.Sprint(value)
+		if value == nil {
+			display = ""
+		}
+		if strings.Contains(key, "api_key") && display != "" {
+			display = maskSecret(display)
+		}
+
+		l := sources[path]
+		*settings = append(*settings, Setting{Key: path, Value: display, Source: l.source, Origin: l.origin})
+	}
+}
+
+// maskSecret hides all but the last four characters of a secret
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
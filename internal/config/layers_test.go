@@ -0,0 +1,65 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTypedValue(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		want    interface{}
+		wantErr bool
+	}{
+		{key: "model", value: "0123", want: "0123"},
+		{key: "model", value: "0x1f", want: "0x1f"},
+		{key: "model", value: "true", want: "true"},
+		{key: "base_folder", value: "~/proyectos: 2024", want: "~/proyectos: 2024"},
+		{key: "batch_workers", value: "0123", want: int64(123)},
+		{key: "batch_workers", value: "0x1f", wantErr: true},
+		{key: "max_continuations", value: "-1", want: int64(-1)},
+		{key: "max_tokens.presupuesto", value: "16000", want: int64(16000)},
+		{key: "request_timeout", value: "300", want: "300s"},
+		{key: "request_timeout", value: "5m", want: "5m"},
+		{key: "request_timeout", value: "-1", want: "-1s"},
+		{key: "request_timeout", value: "pronto", wantErr: true},
+		{key: "retry.initial_delay", value: "2s", want: "2s"},
+		{key: "prices.modelo.input", value: "3", want: float64(3)},
+		{key: "tenants.acme.rnc", value: "0123", want: "0123"},
+		{key: "opcion_desconocida", value: "42", want: "42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			got, err := typedValue(strings.Split(tt.key, "."), tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("typedValue error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("typedValue = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEnvValues(t *testing.T) {
+	t.Setenv("ORGMPROP_REQUEST_TIMEOUT", "300")
+	t.Setenv("ORGMPROP_MODEL", "0123")
+
+	env, err := envLayer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := decodeConfig(env.values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RequestTimeout.Seconds() != 300 {
+		t.Errorf("RequestTimeout = %v, want 5m0s", config.RequestTimeout)
+	}
+	if config.Model != "0123" {
+		t.Errorf("Model = %q, want 0123", config.Model)
+	}
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"orgmprop/internal/logger"
+)
+
+// CurrentConfigVersion is the config.yaml layout written by this binary.
+// Files without a version field are version 1.
+const CurrentConfigVersion = 2
+
+// migration upgrades the values of a config file from one version to the next
+type migration struct {
+	from        int
+	description string
+	apply       func(values map[string]interface{}) error
+	// persistent steps move data out of the file, so they only run when the
+	// file itself is rewritten and never on an in-memory migration
+	persistent bool
+}
+
+// migrations holds one step per version, in order. To change the layout,
+// bump CurrentConfigVersion and append the step from the previous version.
+var migrations = []migration{
+	{
+		from:        1,
+		description: "API key a almacenamiento seguro",
+		apply:       migrateAPIKey,
+		persistent:  true,
+	},
+}
+
+// UnknownKey is a setting of a configuration source that Config does not define
+type UnknownKey struct {
+	Key    string
+	Source string
+	Origin string
+}
+
+var (
+	// warnedKeys avoids repeating the unknown key warnings on every Load
+	warnedKeys   = map[string]bool{}
+	warnedKeysMu sync.Mutex
+)
+
+// configVersion returns the version of a config file's values
+func configVersion(values map[string]interface{}) int {
+	switch version := values["version"].(type) {
+	case int:
+		return version
+	case float64:
+		return int(version)
+	}
+	return 1
+}
+
+// migrateValues applies the migrations after the version of values, returning
+// the descriptions of the steps applied. Unless persist, persistent steps are
+// skipped.
+func migrateValues(values map[string]interface{}, persist bool) ([]string, error) {
+	version := configVersion(values)
+	if version > CurrentConfigVersion {
+		return nil, fmt.Errorf("versión de configuración %d no soportada (máxima %d); actualiza orgmprop", version, CurrentConfigVersion)
+	}
+
+	var applied []string
+	for _, step := range migrations {
+		if step.from < version || (step.persistent && !persist) {
+			continue
+		}
+		if err := step.apply(values); err != nil {
+			return applied, fmt.Errorf("error migrando configuración de la versión %d: %w", step.from, err)
+		}
+		version = step.from + 1
+		applied = append(applied, step.description)
+	}
+	values["version"] = CurrentConfigVersion
+
+	return applied, nil
+}
+
+// migrateUserFile upgrades an older user config file in place, keeping the
+// original as config.yaml.v<version>.bak
+func migrateUserFile(l *layer) error {
+	if len(l.values) == 0 || configVersion(l.values) == CurrentConfigVersion {
+		return nil
+	}
+
+	version := configVersion(l.values)
+	if version > CurrentConfigVersion {
+		logger.Warn("%s es de la versión %d de la configuración, más nueva que esta (%d); actualiza orgmprop", l.origin, version, CurrentConfigVersion)
+		return nil
+	}
+
+	original, err := os.ReadFile(l.origin)
+	if err != nil {
+		return fmt.Errorf("error leyendo archivo de configuración: %w", err)
+	}
+
+	// A failed step leaves the file as is, to be retried on the next load
+	applied, err := migrateValues(l.values, true)
+	if err != nil {
+		logger.Warn("%s no se migró: %v", l.origin, err)
+		return nil
+	}
+
+	// The backup must not keep a key that was moved to a secure store
+	if _, ok := l.values[apiKeyAccount]; !ok {
+		original = withoutPlaintextKey(original)
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", l.origin, version)
+	if err := os.WriteFile(backup, original, 0600); err != nil {
+		return fmt.Errorf("error respaldando configuración: %w", err)
+	}
+	if err := writeValuesTo(l.origin, l.values); err != nil {
+		return err
+	}
+
+	logger.Info("Configuración migrada de la versión %d a la %d (%s); respaldo en %s", version, CurrentConfigVersion, strings.Join(applied, ", "), backup)
+	return nil
+}
+
+// migrateAPIKey moves a plaintext anthropic_api_key to the Secret Service, or
+// to the encrypted store when ORGMPROP_PASSPHRASE is set, without prompting
+func migrateAPIKey(values map[string]interface{}) error {
+	key, _ := values[apiKeyAccount].(string)
+	if key == "" {
+		return nil
+	}
+
+	backend, err := storeAPIKey(key, nil)
+	if err != nil {
+		return fmt.Errorf("la API key sigue en texto plano (ejecuta 'orgmprop config apikey' para moverla): %w", err)
+	}
+	delete(values, apiKeyAccount)
+
+	logger.Info("API key migrada de config.yaml a: %s", backend)
+	return nil
+}
+
+// withoutPlaintextKey drops the anthropic_api_key line of a config file
+func withoutPlaintextKey(data []byte) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, apiKeyAccount+":") {
+			kept = append(kept, line)
+		}
+	}
+	return []byte(strings.Join(kept, ""))
+}
+
+// UnknownKeys returns the settings of every configuration source that
+// Config does not define, which yaml.Unmarshal would otherwise drop silently
+func UnknownKeys() ([]UnknownKey, error) {
+	layers, err := loadLayers()
+	if err != nil {
+		return nil, err
+	}
+	return layerUnknownKeys(layers), nil
+}
+
+// layerUnknownKeys collects the unknown keys of the layers
+func layerUnknownKeys(layers []layer) []UnknownKey {
+	var unknown []UnknownKey
+	for _, l := range layers {
+		for _, key := range unknownKeys(l.values, reflect.TypeOf(Config{}), "") {
+			unknown = append(unknown, UnknownKey{Key: key, Source: l.source, Origin: l.origin})
+		}
+	}
+	return unknown
+}
+
+// warnUnknownKeys logs the unknown keys of the layers once per process
+func warnUnknownKeys(layers []layer) {
+	warnedKeysMu.Lock()
+	defer warnedKeysMu.Unlock()
+
+	for _, key := range layerUnknownKeys(layers) {
+		id := key.Origin + ":" + key.Key
+		if warnedKeys[id] {
+			continue
+		}
+		warnedKeys[id] = true
+		logger.Warn("Opción desconocida '%s' en %s (%s); se ignora", key.Key, key.Origin, key.Source)
+	}
+}
+
+// unknownKeys walks values against the yaml fields of t
+func unknownKeys(values map[string]interface{}, t reflect.Type, prefix string) []string {
+	var unknown []string
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := yamlFields(t)
+		for key, value := range values {
+			fieldType, ok := fields[key]
+			if !ok {
+				unknown = append(unknown, prefix+key)
+				continue
+			}
+			if nested, ok := value.(map[string]interface{}); ok {
+				unknown = append(unknown, unknownKeys(nested, fieldType, prefix+key+".")...)
+			}
+		}
+	case reflect.Map:
+		for key, value := range values {
+			if nested, ok := value.(map[string]interface{}); ok {
+				unknown = append(unknown, unknownKeys(nested, t.Elem(), prefix+key+".")...)
+			}
+		}
+	}
+
+	sort.Strings(unknown)
+	return unknown
+}
+
+// yamlFields maps the yaml keys of a struct to their types
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrateValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		persist bool
+		want    map[string]interface{}
+		applied []string
+		wantErr bool
+	}{
+		{
+			name:    "versión 1 sin API key",
+			values:  map[string]interface{}{"model": "m"},
+			persist: true,
+			want:    map[string]interface{}{"model": "m", "version": CurrentConfigVersion},
+			applied: []string{"API key a almacenamiento seguro"},
+		},
+		{
+			name:    "versión actual",
+			values:  map[string]interface{}{"version": CurrentConfigVersion, "model": "m"},
+			persist: true,
+			want:    map[string]interface{}{"version": CurrentConfigVersion, "model": "m"},
+		},
+		{
+			name:    "versión de YAML como float",
+			values:  map[string]interface{}{"version": float64(CurrentConfigVersion)},
+			persist: true,
+			want:    map[string]interface{}{"version": CurrentConfigVersion},
+		},
+		{
+			name:    "en memoria conserva la API key",
+			values:  map[string]interface{}{apiKeyAccount: "sk-prueba"},
+			persist: false,
+			want:    map[string]interface{}{apiKeyAccount: "sk-prueba", "version": CurrentConfigVersion},
+		},
+		{
+			name:    "versión más nueva",
+			values:  map[string]interface{}{"version": CurrentConfigVersion + 1},
+			persist: true,
+			want:    map[string]interface{}{"version": CurrentConfigVersion + 1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied, err := migrateValues(tt.values, tt.persist)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migrateValues error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(tt.values, tt.want) {
+				t.Errorf("values = %v, want %v", tt.values, tt.want)
+			}
+			if !reflect.DeepEqual(applied, tt.applied) {
+				t.Errorf("applied = %q, want %q", applied, tt.applied)
+			}
+		})
+	}
+}
+
+func TestWithoutPlaintextKey(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "con API key",
+			data: "model: m\nanthropic_api_key: sk-prueba\nprovider: anthropic\n",
+			want: "model: m\nprovider: anthropic\n",
+		},
+		{
+			name: "sin API key",
+			data: "model: m\n",
+			want: "model: m\n",
+		},
+		{
+			name: "última línea sin salto",
+			data: "model: m\nanthropic_api_key: sk-prueba",
+			want: "model: m\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(withoutPlaintextKey([]byte(tt.data))); got != tt.want {
+				t.Errorf("withoutPlaintextKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"orgmprop/assets"
+	"orgmprop/internal/logger"
+)
+
+// ModelCatalogTTL is how long a cached model list is used before refreshing
+const ModelCatalogTTL = 24 * time.Hour
+
+// ModelInfo describes a model of the catalog. Zero values mean unknown.
+type ModelInfo struct {
+	ID              string      `json:"id"`
+	DisplayName     string      `json:"display_name,omitempty"`
+	ContextWindow   int64       `json:"context_window,omitempty"`
+	MaxOutputTokens int64       `json:"max_output_tokens,omitempty"`
+	Price           *ModelPrice `json:"price,omitempty"`
+}
+
+// ModelCatalog is the list of models offered by a provider
+type ModelCatalog struct {
+	Provider  string      `json:"provider"`
+	FetchedAt time.Time   `json:"fetched_at,omitempty"`
+	Models    []ModelInfo `json:"models"`
+}
+
+// catalogs memoizes loaded catalogs by provider, since prices are looked up
+// once per ledger entry
+var (
+	catalogsMu sync.Mutex
+	catalogs   = map[string]*ModelCatalog{}
+)
+
+// Lookup returns the metadata of a model
+func (c *ModelCatalog) Lookup(id string) (ModelInfo, bool) {
+	for _, model := range c.Models {
+		if model.ID == id {
+			return model, true
+		}
+	}
+	return ModelInfo{}, false
+}
+
+// IDs returns the model identifiers in catalog order
+func (c *ModelCatalog) IDs() []string {
+	ids := make([]string, len(c.Models))
+	for i, model := range c.Models {
+		ids[i] = model.ID
+	}
+	return ids
+}
+
+// Stale reports whether the catalog should be refreshed from the provider
+func (c *ModelCatalog) Stale() bool {
+	return c.FetchedAt.IsZero() || time.Since(c.FetchedAt) > ModelCatalogTTL
+}
+
+// ModelCatalogFilePath returns the cache file of a provider's model list
+func ModelCatalogFilePath(provider string) string {
+	return GetConfigFilePath(fmt.Sprintf("modelos_%s.json", provider))
+}
+
+// EmbeddedModelCatalog returns the Anthropic catalog shipped with the binary
+func EmbeddedModelCatalog() (*ModelCatalog, error) {
+	data, err := assets.GetModelCatalog()
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo catálogo de modelos embebido: %w", err)
+	}
+
+	var catalog ModelCatalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("error parseando catálogo de modelos embebido: %w", err)
+	}
+
+	return &catalog, nil
+}
+
+// LoadModelCatalog returns the cached catalog of a provider. When the cache
+// is missing, corrupt or empty it falls back to the embedded catalog for
+// Anthropic and to an empty catalog otherwise.
+func LoadModelCatalog(provider string) *ModelCatalog {
+	catalogsMu.Lock()
+	defer catalogsMu.Unlock()
+
+	if catalog, ok := catalogs[provider]; ok {
+		return catalog
+	}
+
+	catalog, err := readCachedCatalog(provider)
+	if err != nil {
+		logger.Debug("Caché de modelos de %s no usable: %v", provider, err)
+		catalog = &ModelCatalog{Provider: provider}
+		if provider == ProviderAnthropic {
+			if embedded, err := EmbeddedModelCatalog(); err == nil {
+				catalog = embedded
+			}
+		}
+	}
+
+	catalogs[provider] = catalog
+	return catalog
+}
+
+// readCachedCatalog reads the cached catalog of a provider, failing when it
+// is missing, corrupt or has no models
+func readCachedCatalog(provider string) (*ModelCatalog, error) {
+	data, err := os.ReadFile(ModelCatalogFilePath(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	var cached ModelCatalog
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("catálogo corrupto: %w", err)
+	}
+	if len(cached.Models) == 0 {
+		return nil, fmt.Errorf("catálogo vacío")
+	}
+	return &cached, nil
+}
+
+// SaveModelCatalog caches a provider's catalog in the config directory
+func SaveModelCatalog(catalog *ModelCatalog) error {
+	if err := os.MkdirAll(ConfigDir, 0755); err != nil {
+		return fmt.Errorf("error creando directorio de configuración: %w", err)
+	}
+
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializando catálogo de modelos: %w", err)
+	}
+
+	if err := os.WriteFile(ModelCatalogFilePath(catalog.Provider), data, 0644); err != nil {
+		return fmt.Errorf("error guardando catálogo de modelos: %w", err)
+	}
+
+	catalogsMu.Lock()
+	catalogs[catalog.Provider] = catalog
+	catalogsMu.Unlock()
+
+	return nil
+}
+
+// LookupModel returns the metadata of a model from the catalog of the given
+// provider, then from the Anthropic catalog, then from the embedded catalog so
+// models no longer listed by the API keep their price in old ledger entries
+func LookupModel(provider, id string) (ModelInfo, bool) {
+	if provider != "" {
+		if info, ok := LoadModelCatalog(provider).Lookup(id); ok {
+			return info, true
+		}
+	}
+	if info, ok := LoadModelCatalog(ProviderAnthropic).Lookup(id); ok {
+		return info, true
+	}
+
+	embedded, err := EmbeddedModelCatalog()
+	if err != nil {
+		return ModelInfo{}, false
+	}
+	return embedded.Lookup(id)
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoadModelCatalogFallback(t *testing.T) {
+	embedded, err := EmbeddedModelCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		cache    string
+		want     int
+	}{
+		{name: "sin caché", provider: ProviderAnthropic, want: len(embedded.Models)},
+		{name: "caché corrupta", provider: ProviderAnthropic, cache: `{"models": [`, want: len(embedded.Models)},
+		{name: "caché vacía", provider: ProviderAnthropic, cache: `{"provider": "anthropic", "models": []}`, want: len(embedded.Models)},
+		{name: "caché válida", provider: ProviderAnthropic, cache: `{"provider": "anthropic", "models": [{"id": "modelo"}]}`, want: 1},
+		{name: "caché corrupta de otro proveedor", provider: ProviderOpenAI, cache: `no es json`, want: 0},
+	}
+
+	previous := ConfigDir
+	defer func() { ConfigDir = previous }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ConfigDir = t.TempDir()
+			catalogsMu.Lock()
+			delete(catalogs, tt.provider)
+			catalogsMu.Unlock()
+
+			if tt.cache != "" {
+				if err := os.WriteFile(ModelCatalogFilePath(tt.provider), []byte(tt.cache), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := len(LoadModelCatalog(tt.provider).Models); got != tt.want {
+				t.Errorf("modelos = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	catalogsMu.Lock()
+	delete(catalogs, ProviderAnthropic)
+	delete(catalogs, ProviderOpenAI)
+	catalogsMu.Unlock()
+}
+
+func TestPriceForProvider(t *testing.T) {
+	previous := ConfigDir
+	defer func() { ConfigDir = previous }()
+	ConfigDir = t.TempDir()
+
+	openAI := `{"provider": "openai", "models": [{"id": "gpt-local", "price": {"input": 2, "output": 8}}]}`
+	if err := os.WriteFile(ModelCatalogFilePath(ProviderOpenAI), []byte(openAI), 0644); err != nil {
+		t.Fatal(err)
+	}
+	catalogsMu.Lock()
+	delete(catalogs, ProviderAnthropic)
+	delete(catalogs, ProviderOpenAI)
+	catalogsMu.Unlock()
+	defer func() {
+		catalogsMu.Lock()
+		delete(catalogs, ProviderAnthropic)
+		delete(catalogs, ProviderOpenAI)
+		catalogsMu.Unlock()
+	}()
+
+	cfg := &Config{
+		Provider: ProviderAnthropic,
+		Prices:   map[string]ModelPrice{"precio-propio": {Input: 7, Output: 9}},
+	}
+
+	tests := []struct {
+		name       string
+		provider   string
+		model      string
+		wantInput  float64
+		wantPriced bool
+	}{
+		{"tabla configurada", ProviderOpenAI, "precio-propio", 7, true},
+		{"catálogo de Anthropic", ProviderAnthropic, "claude-sonnet-4-5-20250929", 3, true},
+		{"catálogo de OpenAI con otro proveedor activo", ProviderOpenAI, "gpt-local", 2, true},
+		{"modelo de OpenAI buscado en Anthropic", ProviderAnthropic, "gpt-local", 0, false},
+		{"registro sin proveedor", "", "gpt-local", 2, true},
+		{"modelo desconocido", ProviderOpenAI, "otro", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, ok := cfg.PriceForProvider(tt.provider, tt.model)
+			if ok != tt.wantPriced || price.Input != tt.wantInput {
+				t.Errorf("PriceForProvider = %v, %v, want input %v, %v", price, ok, tt.wantInput, tt.wantPriced)
+			}
+		})
+	}
+}
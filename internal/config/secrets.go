@@ -0,0 +1,469 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"orgmprop/internal/logger"
+)
+
+// API key storage backends
+const (
+	KeyStoreSecretService = "secret-service"
+	KeyStoreFile          = "archivo"
+	KeyStoreCommand       = "comando"
+	KeyStoreConfig        = "config"
+)
+
+const (
+	// SecretsFileName is the passphrase-encrypted fallback store
+	SecretsFileName = "credenciales.enc"
+	// EnvPassphrase supplies the passphrase of the encrypted store without prompting
+	EnvPassphrase = "ORGMPROP_PASSPHRASE"
+
+	// secretService is the attribute that identifies orgmprop secrets
+	secretService = "orgmprop"
+	// apiKeyAccount is the secret name of the Anthropic API key
+	apiKeyAccount = "anthropic_api_key"
+
+	// pbkdf2Iterations is the key derivation cost of the encrypted store
+	pbkdf2Iterations = 600000
+)
+
+// errSecretNotFound is returned by a backend that does not hold the secret
+var errSecretNotFound = errors.New("secreto no encontrado")
+
+// PassphrasePrompt asks the user for the passphrase of the encrypted store,
+// showing prompt. Interactive callers supply it; nil means no prompting.
+type PassphrasePrompt func(prompt string) (string, error)
+
+var (
+	resolvedKeysMu sync.Mutex
+	// resolvedKeys caches keys resolved in this process, so the passphrase or
+	// command is asked for once
+	resolvedKeys = map[string]string{}
+)
+
+// encryptedSecrets is the content of credenciales.enc
+type encryptedSecrets struct {
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Iterations int    `json:"iterations"`
+	Data       []byte `json:"data"`
+}
+
+// ResolveAPIKey returns the Anthropic API key from, in order, api_key_command,
+// the configuration (environment or a not yet migrated config.yaml), the
+// Secret Service and the encrypted store. It never prompts: the encrypted
+// store is read with ORGMPROP_PASSPHRASE or after UnlockAPIKey.
+func (c *Config) ResolveAPIKey() (string, error) {
+	return c.resolveAPIKey(nil)
+}
+
+// UnlockAPIKey resolves the API key once, asking for the passphrase of the
+// encrypted store with prompt if needed. Call it before a generation starts,
+// so no prompt interrupts it.
+func (c *Config) UnlockAPIKey(prompt PassphrasePrompt) error {
+	_, err := c.resolveAPIKey(prompt)
+	return err
+}
+
+// resolveAPIKey looks up the API key; only with a prompt may it ask for the
+// passphrase
+func (c *Config) resolveAPIKey(prompt PassphrasePrompt) (string, error) {
+	if c.APIKeyCommand != "" {
+		return runKeyCommand(c.APIKeyCommand)
+	}
+
+	if c.AnthropicAPIKey != "" {
+		return c.AnthropicAPIKey, nil
+	}
+
+	resolvedKeysMu.Lock()
+	defer resolvedKeysMu.Unlock()
+	if key, ok := resolvedKeys[apiKeyAccount]; ok {
+		return key, nil
+	}
+
+	key, err := lookupSecretService(apiKeyAccount)
+	if errors.Is(err, errSecretNotFound) {
+		key, err = lookupSecretsFile(apiKeyAccount, prompt)
+	}
+	if errors.Is(err, errSecretNotFound) {
+		return "", fmt.Errorf("API key no configurada. Ejecuta 'orgmprop config apikey'")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resolvedKeys[apiKeyAccount] = key
+	return key, nil
+}
+
+// APIKeySource reports the backend the API key would be resolved from,
+// without running api_key_command, prompting or decrypting anything. The
+// encrypted store is reported when it exists, whether or not it holds the key.
+func (c *Config) APIKeySource() (string, error) {
+	if c.APIKeyCommand != "" {
+		return KeyStoreCommand, nil
+	}
+	if c.AnthropicAPIKey != "" {
+		return KeyStoreConfig, nil
+	}
+
+	_, err := lookupSecretService(apiKeyAccount)
+	if err == nil {
+		return KeyStoreSecretService, nil
+	}
+	if !errors.Is(err, errSecretNotFound) {
+		logger.Debug("Secret Service no disponible: %v", err)
+	}
+
+	if _, err := os.Stat(GetConfigFilePath(SecretsFileName)); err == nil {
+		return KeyStoreFile, nil
+	}
+	return "", fmt.Errorf("API key no configurada")
+}
+
+// StoreAPIKey saves the Anthropic API key in the Secret Service, or in the
+// encrypted store when no Secret Service is available, and removes any
+// plaintext copy from config.yaml. The passphrase of a new or existing
+// encrypted store is asked for with prompt. Returns the backend used.
+func StoreAPIKey(key string, prompt PassphrasePrompt) (string, error) {
+	backend, err := storeAPIKey(key, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	if err := removePlaintextKey(); err != nil {
+		return backend, err
+	}
+
+	logger.Debug("API key guardada en: %s", backend)
+	return backend, nil
+}
+
+// storeAPIKey saves the API key in the Secret Service or the encrypted store.
+// Without a prompt, the encrypted store is only used when its passphrase
+// comes from ORGMPROP_PASSPHRASE.
+func storeAPIKey(key string, prompt PassphrasePrompt) (string, error) {
+	backend := KeyStoreSecretService
+	if err := storeSecretService(apiKeyAccount, key); err != nil {
+		logger.Debug("Secret Service no disponible: %v", err)
+		if prompt == nil && os.Getenv(EnvPassphrase) == "" {
+			return "", fmt.Errorf("Secret Service no disponible y %s no definida: %w", EnvPassphrase, err)
+		}
+		backend = KeyStoreFile
+		if err := storeSecretsFile(apiKeyAccount, key, prompt); err != nil {
+			return "", err
+		}
+	}
+
+	resolvedKeysMu.Lock()
+	resolvedKeys[apiKeyAccount] = key
+	resolvedKeysMu.Unlock()
+	return backend, nil
+}
+
+// isStoredAPIKey reports whether key was already resolved from or saved to
+// a secure store in this process
+func isStoredAPIKey(key string) bool {
+	resolvedKeysMu.Lock()
+	defer resolvedKeysMu.Unlock()
+	return resolvedKeys[apiKeyAccount] == key
+}
+
+// removePlaintextKey deletes anthropic_api_key from the user config.yaml
+func removePlaintextKey() error {
+	user, err := loadFileLayer(SourceUser, ConfigFile)
+	if err != nil {
+		return err
+	}
+	if _, ok := user.values[apiKeyAccount]; !ok {
+		return nil
+	}
+
+	delete(user.values, apiKeyAccount)
+	return writeUserValues(user.values)
+}
+
+// runKeyCommand runs api_key_command and returns its trimmed output
+func runKeyCommand(command string) (string, error) {
+	resolvedKeysMu.Lock()
+	defer resolvedKeysMu.Unlock()
+	if key, ok := resolvedKeys[command]; ok {
+		return key, nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error ejecutando api_key_command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	key := strings.TrimSpace(string(output))
+	if key == "" {
+		return "", fmt.Errorf("api_key_command no devolvió ninguna API key")
+	}
+
+	resolvedKeys[command] = key
+	return key, nil
+}
+
+// lookupSecretService reads a secret from the freedesktop Secret Service
+// over D-Bus, through libsecret's secret-tool
+func lookupSecretService(account string) (string, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return "", errSecretNotFound
+	}
+
+	output, err := exec.Command("secret-tool", "lookup", "service", secretService, "account", account).Output()
+	if err != nil {
+		// secret-tool exits with an error both when the secret is missing
+		// and when no Secret Service is running on the bus
+		return "", errSecretNotFound
+	}
+
+	secret := strings.TrimSpace(string(output))
+	if secret == "" {
+		return "", errSecretNotFound
+	}
+	return secret, nil
+}
+
+// storeSecretService saves a secret in the freedesktop Secret Service
+func storeSecretService(account, secret string) error {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return fmt.Errorf("secret-tool no instalado")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "store", "--label", "orgmprop "+account, "service", secretService, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// lookupSecretsFile reads a secret from the encrypted store. Without a
+// prompt, the passphrase must come from ORGMPROP_PASSPHRASE.
+func lookupSecretsFile(account string, prompt PassphrasePrompt) (string, error) {
+	path := GetConfigFilePath(SecretsFileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", errSecretNotFound
+	}
+
+	if prompt == nil && os.Getenv(EnvPassphrase) == "" {
+		return "", fmt.Errorf("%s está cifrado: define %s o desbloquéalo antes de generar", SecretsFileName, EnvPassphrase)
+	}
+	passphrase, err := passphrase(prompt, "Contraseña de credenciales.enc")
+	if err != nil {
+		return "", err
+	}
+
+	secrets, err := readSecretsFile(path, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	secret, ok := secrets[account]
+	if !ok {
+		return "", errSecretNotFound
+	}
+	return secret, nil
+}
+
+// storeSecretsFile saves a secret in the encrypted store, keeping the other
+// secrets it holds
+func storeSecretsFile(account, secret string, prompt PassphrasePrompt) error {
+	path := GetConfigFilePath(SecretsFileName)
+
+	secrets := map[string]string{}
+	var pass string
+	var err error
+	if _, statErr := os.Stat(path); statErr == nil {
+		pass, err = passphrase(prompt, "Contraseña de credenciales.enc")
+		if err != nil {
+			return err
+		}
+		if secrets, err = readSecretsFile(path, pass); err != nil {
+			return err
+		}
+	} else {
+		pass, err = newPassphrase(prompt)
+		if err != nil {
+			return err
+		}
+	}
+
+	secrets[account] = secret
+	return writeSecretsFile(path, pass, secrets)
+}
+
+// passphrase returns the passphrase from ORGMPROP_PASSPHRASE or asks for it
+// with prompt, showing label
+func passphrase(prompt PassphrasePrompt, label string) (string, error) {
+	if value := os.Getenv(EnvPassphrase); value != "" {
+		return value, nil
+	}
+	if prompt == nil {
+		return "", fmt.Errorf("%s no definida", EnvPassphrase)
+	}
+	value, err := prompt(label)
+	if err != nil {
+		return "", fmt.Errorf("error leyendo contraseña: %w", err)
+	}
+	if value == "" {
+		return "", fmt.Errorf("contraseña vacía")
+	}
+	return value, nil
+}
+
+// newPassphrase asks for the passphrase of a new encrypted store twice
+func newPassphrase(prompt PassphrasePrompt) (string, error) {
+	if value := os.Getenv(EnvPassphrase); value != "" {
+		return value, nil
+	}
+
+	value, err := passphrase(prompt, "Nueva contraseña para credenciales.enc")
+	if err != nil {
+		return "", err
+	}
+	confirm, err := passphrase(prompt, "Confirmar contraseña")
+	if err != nil {
+		return "", err
+	}
+	if value != confirm {
+		return "", fmt.Errorf("las contraseñas no coinciden")
+	}
+	return value, nil
+}
+
+// readSecretsFile decrypts the encrypted store
+func readSecretsFile(path, passphrase string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", SecretsFileName, err)
+	}
+
+	var stored encryptedSecrets
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("error parseando %s: %w", SecretsFileName, err)
+	}
+
+	gcm, err := newGCM(passphrase, stored.Salt, stored.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, stored.Nonce, stored.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("contraseña incorrecta o %s dañado", SecretsFileName)
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("error parseando %s: %w", SecretsFileName, err)
+	}
+	return secrets, nil
+}
+
+// writeSecretsFile encrypts the secrets with a fresh salt and nonce
+func writeSecretsFile(path, passphrase string, secrets map[string]string) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("error serializando credenciales: %w", err)
+	}
+
+	stored := encryptedSecrets{
+		Salt:       make([]byte, 16),
+		Iterations: pbkdf2Iterations,
+	}
+	if _, err := rand.Read(stored.Salt); err != nil {
+		return fmt.Errorf("error generando sal: %w", err)
+	}
+
+	gcm, err := newGCM(passphrase, stored.Salt, stored.Iterations)
+	if err != nil {
+		return err
+	}
+
+	stored.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(stored.Nonce); err != nil {
+		return fmt.Errorf("error generando nonce: %w", err)
+	}
+	stored.Data = gcm.Seal(nil, stored.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializando credenciales: %w", err)
+	}
+
+	if err := os.MkdirAll(ConfigDir, 0700); err != nil {
+		return fmt.Errorf("error creando directorio de configuración: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("error guardando %s: %w", SecretsFileName, err)
+	}
+	return nil
+}
+
+// newGCM derives an AES-256-GCM cipher from the passphrase
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("%s inválido: iteraciones no definidas", SecretsFileName)
+	}
+
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return nil, fmt.Errorf("error creando cifrado: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key with PBKDF2-HMAC-SHA256 (RFC 8018)
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	counter := make([]byte, 4)
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter, uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
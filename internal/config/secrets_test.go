@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		salt       string
+		iterations int
+		keyLen     int
+		want       string
+	}{
+		{
+			// RFC 7914, section 11
+			name:       "rfc7914 c=1",
+			password:   "passwd",
+			salt:       "salt",
+			iterations: 1,
+			keyLen:     64,
+			want:       "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+		{
+			// RFC 7914, section 11
+			name:       "rfc7914 c=80000",
+			password:   "Password",
+			salt:       "NaCl",
+			iterations: 80000,
+			keyLen:     64,
+			want:       "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d",
+		},
+		{
+			name:       "clave más corta que un bloque",
+			password:   "password",
+			salt:       "salt",
+			iterations: 1,
+			keyLen:     20,
+			want:       "120fb6cffcf8b32c43e7225256c4f837a86548c9",
+		},
+		{
+			name:       "un bloque",
+			password:   "password",
+			salt:       "salt",
+			iterations: 4096,
+			keyLen:     32,
+			want:       "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+			if got != tt.want {
+				t.Errorf("pbkdf2SHA256 = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		prompt  PassphrasePrompt
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "variable de entorno sin preguntar",
+			env:  "secreta",
+			prompt: func(string) (string, error) {
+				t.Error("prompt called with ORGMPROP_PASSPHRASE set")
+				return "", nil
+			},
+			want: "secreta",
+		},
+		{name: "sin prompt ni variable", wantErr: true},
+		{
+			name:   "respuesta del prompt",
+			prompt: func(string) (string, error) { return "tecleada", nil },
+			want:   "tecleada",
+		},
+		{
+			name:    "respuesta vacía",
+			prompt:  func(string) (string, error) { return "", nil },
+			wantErr: true,
+		},
+		{
+			name:    "prompt cancelado",
+			prompt:  func(string) (string, error) { return "", errors.New("cancelado") },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvPassphrase, tt.env)
+
+			got, err := passphrase(tt.prompt, "Contraseña")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("passphrase error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("passphrase = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
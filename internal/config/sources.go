@@ -0,0 +1,547 @@
+package config
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"orgmprop/internal/logger"
+)
+
+// Template source types
+const (
+	SourceTypeDir     = "directorio"
+	SourceTypeGit     = "git"
+	SourceTypeTarball = "tarball"
+)
+
+const (
+	// DefaultTemplateSubdir is the templates folder inside the dotfiles repo
+	DefaultTemplateSubdir = ".config/orgmprop"
+	// ChecksumsFileName lists sha256sum checksums of the files of a source
+	ChecksumsFileName = "SHA256SUMS"
+
+	// maxTarballSize bounds the download of a tarball source
+	maxTarballSize = 50 << 20
+)
+
+// Template change statuses
+const (
+	ChangeNew       = "nuevo"
+	ChangeModified  = "modificado"
+	ChangeUnchanged = "igual"
+)
+
+// SyncFiles are the files a template source can provide
+var SyncFiles = append(append([]string{}, TemplateFiles...), "logo.png", "folder.json")
+
+// TemplateSourceConfig selects where templates are synced from
+type TemplateSourceConfig struct {
+	// URL is a local directory, file:// URL, git URL or .tar.gz URL
+	URL string `yaml:"url,omitempty"`
+	// Ref is the branch, tag or full commit SHA of a git source
+	Ref string `yaml:"ref,omitempty"`
+	// Subdir is the templates folder inside the source
+	Subdir string `yaml:"subdir,omitempty"`
+	// SHA256 is the expected checksum of a tarball
+	SHA256 string `yaml:"sha256,omitempty"`
+}
+
+// TemplateSource fetches template files into a staging directory
+type TemplateSource interface {
+	// Describe returns the source type and location for messages
+	Describe() string
+	// Fetch downloads or copies the source into staging and returns the
+	// directory that holds its files
+	Fetch(ctx context.Context, staging string) (string, error)
+	// RequiresChecksums reports whether the source must ship SHA256SUMS,
+	// because nothing else pins its content
+	RequiresChecksums() bool
+}
+
+// TemplateChange is the effect of syncing one file
+type TemplateChange struct {
+	File   string
+	Status string
+}
+
+// GetTemplateSource returns the configured source, defaulting to the
+// dotfiles repository
+func (c *Config) GetTemplateSource() TemplateSourceConfig {
+	source := c.TemplateSource
+	if source.URL == "" {
+		source.URL = DotfilesURL
+		if source.Subdir == "" {
+			source.Subdir = DefaultTemplateSubdir
+		}
+	}
+	return source
+}
+
+// NewTemplateSource creates the source for a configured URL
+func NewTemplateSource(cfg TemplateSourceConfig) (TemplateSource, error) {
+	location := cfg.URL
+	if strings.HasPrefix(location, "file://") {
+		parsed, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("URL de plantillas inválida: %w", err)
+		}
+		location = parsed.Path
+	}
+
+	switch sourceType(cfg.URL) {
+	case SourceTypeTarball:
+		return &tarballSource{location: location, sha256: cfg.SHA256}, nil
+	case SourceTypeGit:
+		return &gitSource{url: cfg.URL, ref: cfg.Ref, isDefault: cfg.URL == DotfilesURL}, nil
+	default:
+		return &dirSource{path: location}, nil
+	}
+}
+
+// sourceType classifies a template source URL
+func sourceType(location string) string {
+	switch {
+	case strings.HasSuffix(location, ".tar.gz"), strings.HasSuffix(location, ".tgz"):
+		return SourceTypeTarball
+	case strings.HasSuffix(location, ".git"), strings.HasPrefix(location, "git@"),
+		strings.HasPrefix(location, "git://"), strings.HasPrefix(location, "ssh://"):
+		return SourceTypeGit
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		return SourceTypeGit
+	default:
+		return SourceTypeDir
+	}
+}
+
+// dirSource copies templates from a local directory
+type dirSource struct {
+	path string
+}
+
+// Describe returns the directory
+func (s *dirSource) Describe() string {
+	return fmt.Sprintf("%s %s", SourceTypeDir, s.path)
+}
+
+// Fetch copies the directory into staging so the files checked are the
+// files installed
+func (s *dirSource) Fetch(ctx context.Context, staging string) (string, error) {
+	dest := filepath.Join(staging, "fuente")
+	if err := copyDir(s.path, dest); err != nil {
+		return "", fmt.Errorf("error copiando %s: %w", s.path, err)
+	}
+	return dest, nil
+}
+
+// RequiresChecksums is false: a local directory is trusted as is
+func (s *dirSource) RequiresChecksums() bool {
+	return false
+}
+
+// gitSource clones a git repository
+type gitSource struct {
+	url string
+	ref string
+	// isDefault marks the dotfiles repository, which ships no SHA256SUMS
+	isDefault bool
+}
+
+// commitSHA matches a full git commit hash
+var commitSHA = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// Describe returns the repository and ref
+func (s *gitSource) Describe() string {
+	if s.ref != "" {
+		return fmt.Sprintf("%s %s@%s", SourceTypeGit, s.url, s.ref)
+	}
+	return fmt.Sprintf("%s %s", SourceTypeGit, s.url)
+}
+
+// Fetch clones the repository into staging. A commit SHA cannot be cloned
+// with --branch, so it is fetched and checked out instead.
+func (s *gitSource) Fetch(ctx context.Context, staging string) (string, error) {
+	dest := filepath.Join(staging, "repo")
+
+	if commitSHA.MatchString(s.ref) {
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return "", fmt.Errorf("error creando directorio temporal: %w", err)
+		}
+		steps := [][]string{
+			{"init", "--quiet"},
+			{"remote", "add", "origin", s.url},
+			{"fetch", "--quiet", "--depth", "1", "origin", s.ref},
+			{"checkout", "--quiet", "FETCH_HEAD"},
+		}
+		for _, args := range steps {
+			if err := runGit(ctx, dest, args...); err != nil {
+				return "", fmt.Errorf("error obteniendo %s@%s: %w", s.url, s.ref, err)
+			}
+		}
+		return dest, nil
+	}
+
+	args := []string{"clone", "--depth", "1"}
+	if s.ref != "" {
+		args = append(args, "--branch", s.ref)
+	}
+	args = append(args, s.url, dest)
+
+	if err := runGit(ctx, "", args...); err != nil {
+		return "", fmt.Errorf("error clonando %s: %w", s.url, err)
+	}
+	return dest, nil
+}
+
+// RequiresChecksums is true unless the ref is a commit SHA, since a branch
+// or tag can move. The default dotfiles repository is exempt.
+func (s *gitSource) RequiresChecksums() bool {
+	return !s.isDefault && !commitSHA.MatchString(s.ref)
+}
+
+// runGit runs a git command in dir, including its stderr in the error
+func runGit(ctx context.Context, dir string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// tarballSource downloads or reads a .tar.gz archive
+type tarballSource struct {
+	location string
+	sha256   string
+}
+
+// Describe returns the archive location
+func (s *tarballSource) Describe() string {
+	return fmt.Sprintf("%s %s", SourceTypeTarball, s.location)
+}
+
+// Fetch verifies the archive checksum and extracts it into staging
+func (s *tarballSource) Fetch(ctx context.Context, staging string) (string, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	if s.sha256 == "" {
+		return "", fmt.Errorf("tarball sin sha256 configurado (checksum obtenido: %s); agrégalo en template_source.sha256", actual)
+	}
+	if !strings.EqualFold(actual, s.sha256) {
+		return "", fmt.Errorf("checksum de %s no coincide: esperado %s, obtenido %s", s.location, s.sha256, actual)
+	}
+
+	dest := filepath.Join(staging, "tarball")
+	if err := extractTarGz(data, dest); err != nil {
+		return "", fmt.Errorf("error extrayendo %s: %w", s.location, err)
+	}
+	return dest, nil
+}
+
+// RequiresChecksums is true for a download: its files are only trusted when
+// the archive lists them in SHA256SUMS. A local archive is trusted as is.
+func (s *tarballSource) RequiresChecksums() bool {
+	return isHTTP(s.location)
+}
+
+// isHTTP reports whether location is an HTTP or HTTPS URL
+func isHTTP(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// read returns the archive from disk or HTTP
+func (s *tarballSource) read(ctx context.Context) ([]byte, error) {
+	if !isHTTP(s.location) {
+		data, err := os.ReadFile(s.location)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo %s: %w", s.location, err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creando solicitud: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error descargando %s: %w", s.location, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error descargando %s: %s", s.location, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTarballSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error descargando %s: %w", s.location, err)
+	}
+	if len(data) > maxTarballSize {
+		return nil, fmt.Errorf("%s excede %d MB", s.location, maxTarballSize>>20)
+	}
+	return data, nil
+}
+
+// extractTarGz extracts regular files and directories, rejecting paths that
+// leave dest
+func extractTarGz(data []byte, dest string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// The archive root itself, usually "./", is allowed
+		target := filepath.Join(dest, header.Name)
+		if target != filepath.Clean(dest) && !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("ruta inválida en el archivo: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, io.LimitReader(reader, maxTarballSize))
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// copyDir copies the regular files of a directory tree
+func copyDir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
+
+// verifyChecksums checks the files listed in the SHA256SUMS of dir and
+// returns their names, or nil when dir has no SHA256SUMS
+func verifyChecksums(dir string) (map[string]bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ChecksumsFileName))
+	if os.IsNotExist(err) {
+		logger.Debug("Sin %s en %s", ChecksumsFileName, dir)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", ChecksumsFileName, err)
+	}
+
+	listed := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		expected, name := fields[0], path.Clean(strings.TrimPrefix(fields[1], "*"))
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return nil, fmt.Errorf("ruta inválida en %s: %s", ChecksumsFileName, name)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, fmt.Errorf("archivo de %s no encontrado: %s", ChecksumsFileName, name)
+		}
+		sum := sha256.Sum256(content)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), expected) {
+			return nil, fmt.Errorf("checksum de %s no coincide", name)
+		}
+		listed[name] = true
+	}
+
+	return listed, scanner.Err()
+}
+
+// checksummedFiles verifies the SHA256SUMS of the source root and of the
+// templates subdir, returning the verified names relative to the subdir, or
+// nil when neither has one
+func checksummedFiles(root, subdir string) (map[string]bool, error) {
+	rootListed, err := verifyChecksums(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var listed map[string]bool
+	prefix := path.Clean(filepath.ToSlash(subdir)) + "/"
+	if rootListed != nil {
+		listed = make(map[string]bool)
+		for name := range rootListed {
+			if subdir == "" {
+				listed[name] = true
+			} else if strings.HasPrefix(name, prefix) {
+				listed[strings.TrimPrefix(name, prefix)] = true
+			}
+		}
+	}
+
+	if subdir != "" {
+		subdirListed, err := verifyChecksums(filepath.Join(root, filepath.FromSlash(subdir)))
+		if err != nil {
+			return nil, err
+		}
+		if subdirListed != nil && listed == nil {
+			listed = make(map[string]bool)
+		}
+		for name := range subdirListed {
+			listed[name] = true
+		}
+	}
+
+	return listed, nil
+}
+
+// SyncTemplates fetches the configured source into a staging directory,
+// verifies it and reports how every file would change. Unless dryRun, new
+// and modified files are installed, keeping the previous copy as <file>.bak.
+func SyncTemplates(ctx context.Context, cfg *Config, dryRun bool) ([]TemplateChange, error) {
+	return syncTemplates(ctx, cfg, SyncFiles, dryRun)
+}
+
+// syncTemplates syncs the given files from the configured source
+func syncTemplates(ctx context.Context, cfg *Config, files []string, dryRun bool) ([]TemplateChange, error) {
+	sourceConfig := cfg.GetTemplateSource()
+	source, err := NewTemplateSource(sourceConfig)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("Sincronizando plantillas desde %s", source.Describe())
+
+	staging, err := os.MkdirTemp("", "orgmprop-plantillas-")
+	if err != nil {
+		return nil, fmt.Errorf("error creando directorio temporal: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	root, err := source.Fetch(ctx, staging)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(root, filepath.FromSlash(sourceConfig.Subdir))
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("carpeta %s no encontrada en %s", sourceConfig.Subdir, source.Describe())
+	}
+
+	// With a SHA256SUMS every installed file must be listed in it; sources
+	// whose content is not pinned otherwise must ship one
+	listed, err := checksummedFiles(root, sourceConfig.Subdir)
+	if err != nil {
+		return nil, err
+	}
+	if listed == nil {
+		if source.RequiresChecksums() {
+			return nil, fmt.Errorf("la fuente %s no incluye %s; no se instala nada sin verificar", source.Describe(), ChecksumsFileName)
+		}
+		logger.Warn("La fuente %s no incluye %s; los archivos no se verifican", source.Describe(), ChecksumsFileName)
+	}
+
+	var changes []TemplateChange
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			continue
+		}
+		if listed != nil && !listed[file] {
+			return nil, fmt.Errorf("%s no figura en %s de %s", file, ChecksumsFileName, source.Describe())
+		}
+
+		change := TemplateChange{File: file, Status: ChangeNew}
+		path := GetConfigFilePath(file)
+		if current, err := os.ReadFile(path); err == nil {
+			change.Status = ChangeModified
+			if bytes.Equal(current, data) {
+				change.Status = ChangeUnchanged
+			}
+
+			if change.Status == ChangeModified && !dryRun {
+				if err := os.WriteFile(path+".bak", current, 0644); err != nil {
+					return changes, fmt.Errorf("error respaldando %s: %w", file, err)
+				}
+			}
+		}
+		changes = append(changes, change)
+
+		if dryRun || change.Status == ChangeUnchanged {
+			continue
+		}
+		if err := os.MkdirAll(ConfigDir, 0755); err != nil {
+			return changes, fmt.Errorf("error creando directorio de configuración: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return changes, fmt.Errorf("error escribiendo %s: %w", file, err)
+		}
+		if err := unstampTemplate(file); err != nil {
+			logger.Warn("No se pudo quitar el sello de %s: %v", file, err)
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sha256Line returns a sha256sum line for content
+func sha256Line(name, content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:]) + "  " + name + "\n"
+}
+
+// writeFiles creates files under dir, keyed by slash-separated path
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// tarEntry is a file or directory of a test archive
+type tarEntry struct {
+	name    string
+	content string
+	dir     bool
+}
+
+// tarGz builds a .tar.gz archive in memory
+func tarGz(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(entry.content))}
+		if entry.dir {
+			header = &tar.Header{Name: entry.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if !entry.dir {
+			if _, err := tw.Write([]byte(entry.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    map[string]bool
+		wantErr string
+	}{
+		{
+			name:  "sin SHA256SUMS",
+			files: map[string]string{"style.css": "a"},
+		},
+		{
+			name: "archivos listados",
+			files: map[string]string{
+				"style.css":       "a",
+				"sub/logo.svg":    "b",
+				ChecksumsFileName: sha256Line("style.css", "a") + sha256Line("*sub/logo.svg", "b"),
+			},
+			want: map[string]bool{"style.css": true, "sub/logo.svg": true},
+		},
+		{
+			name: "líneas mal formadas ignoradas",
+			files: map[string]string{
+				"style.css":       "a",
+				ChecksumsFileName: "solo-un-campo\n" + "a b c\n" + sha256Line("style.css", "a"),
+			},
+			want: map[string]bool{"style.css": true},
+		},
+		{
+			name: "checksum distinto",
+			files: map[string]string{
+				"style.css":       "cambiado",
+				ChecksumsFileName: sha256Line("style.css", "a"),
+			},
+			wantErr: "no coincide",
+		},
+		{
+			name: "ruta que sale del directorio",
+			files: map[string]string{
+				ChecksumsFileName: sha256Line("../fuera.txt", "x"),
+			},
+			wantErr: "ruta inválida",
+		},
+		{
+			name:    "archivo listado ausente",
+			files:   map[string]string{ChecksumsFileName: sha256Line("style.css", "a")},
+			wantErr: "no encontrado",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			got, err := verifyChecksums(dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verifyChecksums error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyChecksums: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("verifyChecksums = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecksummedFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		subdir string
+		want   map[string]bool
+	}{
+		{
+			name:   "sin SHA256SUMS",
+			files:  map[string]string{"plantillas/style.css": "a"},
+			subdir: "plantillas",
+		},
+		{
+			name: "raíz sin subdir",
+			files: map[string]string{
+				"style.css":       "a",
+				ChecksumsFileName: sha256Line("style.css", "a"),
+			},
+			want: map[string]bool{"style.css": true},
+		},
+		{
+			name: "raíz filtrada al subdir",
+			files: map[string]string{
+				"plantillas/style.css": "a",
+				"otro.txt":             "b",
+				ChecksumsFileName:      sha256Line("plantillas/style.css", "a") + sha256Line("otro.txt", "b"),
+			},
+			subdir: "plantillas",
+			want:   map[string]bool{"style.css": true},
+		},
+		{
+			name: "SHA256SUMS del subdir",
+			files: map[string]string{
+				"plantillas/style.css":            "a",
+				"plantillas/" + ChecksumsFileName: sha256Line("style.css", "a"),
+			},
+			subdir: "plantillas",
+			want:   map[string]bool{"style.css": true},
+		},
+		{
+			name: "raíz sin archivos del subdir",
+			files: map[string]string{
+				"plantillas/style.css": "a",
+				"otro.txt":             "b",
+				ChecksumsFileName:      sha256Line("otro.txt", "b"),
+			},
+			subdir: "plantillas",
+			want:   map[string]bool{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			got, err := checksummedFiles(dir, tt.subdir)
+			if err != nil {
+				t.Fatalf("checksummedFiles: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checksummedFiles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractTarGz(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "raíz y archivos",
+			entries: []tarEntry{
+				{name: "./", dir: true},
+				{name: "./style.css", content: "a"},
+				{name: "sub/", dir: true},
+				{name: "sub/logo.svg", content: "b"},
+			},
+			want: []string{"style.css", "sub/logo.svg"},
+		},
+		{
+			name:    "directorio implícito",
+			entries: []tarEntry{{name: "a/b/c.txt", content: "c"}},
+			want:    []string{"a/b/c.txt"},
+		},
+		{
+			name:    "ruta que sale del destino",
+			entries: []tarEntry{{name: "../fuera.txt", content: "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "ruta anidada que sale del destino",
+			entries: []tarEntry{{name: "sub/../../fuera.txt", content: "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "prefijo parecido al destino",
+			entries: []tarEntry{{name: "../tarball-otro/x.txt", content: "x"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dest := filepath.Join(parent, "tarball")
+
+			err := extractTarGz(tarGz(t, tt.entries), dest)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("extractTarGz succeeded, want error")
+				}
+				if _, err := os.Stat(filepath.Join(parent, "fuera.txt")); err == nil {
+					t.Error("extractTarGz wrote outside dest")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractTarGz: %v", err)
+			}
+
+			var got []string
+			filepath.WalkDir(dest, func(path string, entry os.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() {
+					rel, _ := filepath.Rel(dest, path)
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return nil
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extracted files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiresChecksums(t *testing.T) {
+	sha := strings.Repeat("a1", 20)
+	tests := []struct {
+		name string
+		cfg  TemplateSourceConfig
+		want bool
+	}{
+		{"dotfiles por defecto", TemplateSourceConfig{URL: DotfilesURL}, false},
+		{"git con rama", TemplateSourceConfig{URL: "https://example.com/plantillas.git", Ref: "main"}, true},
+		{"git sin ref", TemplateSourceConfig{URL: "git@example.com:plantillas.git"}, true},
+		{"git fijado a commit", TemplateSourceConfig{URL: "https://example.com/plantillas.git", Ref: sha}, false},
+		{"git con SHA abreviado", TemplateSourceConfig{URL: "https://example.com/plantillas.git", Ref: sha[:7]}, true},
+		{"tarball por HTTP", TemplateSourceConfig{URL: "https://example.com/plantillas.tar.gz"}, true},
+		{"tarball local", TemplateSourceConfig{URL: "/tmp/plantillas.tar.gz"}, false},
+		{"directorio local", TemplateSourceConfig{URL: "/tmp/plantillas"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewTemplateSource(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := source.RequiresChecksums(); got != tt.want {
+				t.Errorf("RequiresChecksums = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
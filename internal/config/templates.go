@@ -0,0 +1,263 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"orgmprop/assets"
+	"orgmprop/internal/logger"
+)
+
+// TemplateFiles are the config files with an embedded default
+var TemplateFiles = []string{
+	"template.css",
+	"propuesta.yaml",
+	"html_template.yaml",
+	"presupuesto.yaml",
+	"presupuesto.example.json",
+	"presupuesto.html.tmpl",
+	"logo.svg",
+}
+
+// diffContext is the number of unchanged lines shown around a change
+const diffContext = 3
+
+// FileDiff is the difference between a config file and its embedded default
+type FileDiff struct {
+	File string
+	// Missing is true when the user has no copy of the file
+	Missing bool
+	// Diff is a unified diff from the embedded to the user version; empty
+	// when both are equal
+	Diff string
+}
+
+// isTemplateFile reports whether name is one of TemplateFiles
+func isTemplateFile(name string) bool {
+	for _, file := range TemplateFiles {
+		if file == name {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFromEmbeddedAssets copies missing files from embedded assets and
+// stamps them for future upgrades
+func copyFromEmbeddedAssets(missingFiles []string) error {
+	logger.Debug("Copiando archivos embebidos: %v", missingFiles)
+
+	if err := os.MkdirAll(ConfigDir, 0755); err != nil {
+		return fmt.Errorf("error creando directorio de configuración: %w", err)
+	}
+
+	for _, file := range missingFiles {
+		data, err := assets.FS.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("archivo embebido no encontrado: %s", file)
+		}
+
+		if err := os.WriteFile(filepath.Join(ConfigDir, file), data, 0644); err != nil {
+			return fmt.Errorf("error escribiendo %s: %w", file, err)
+		}
+		if err := stampTemplate(file, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResetConfigFile restores a config file to the embedded default, keeping
+// the previous version as <file>.bak
+func ResetConfigFile(name string) error {
+	if !isTemplateFile(name) {
+		return fmt.Errorf("archivo desconocido: %s (disponibles: %s)", name, strings.Join(TemplateFiles, ", "))
+	}
+
+	path := GetConfigFilePath(name)
+	if data, err := os.ReadFile(path); err == nil {
+		if err := os.WriteFile(path+".bak", data, 0644); err != nil {
+			return fmt.Errorf("error respaldando %s: %w", name, err)
+		}
+		logger.Debug("Respaldo guardado en: %s.bak", path)
+	}
+
+	return copyFromEmbeddedAssets([]string{name})
+}
+
+// DiffConfigFiles compares the user's text templates with the embedded
+// defaults of this binary
+func DiffConfigFiles() ([]FileDiff, error) {
+	var diffs []FileDiff
+	for _, file := range TemplateFiles {
+		// The logo is binary for practical purposes
+		if filepath.Ext(file) == ".svg" {
+			continue
+		}
+
+		embedded, err := assets.FS.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("archivo embebido no encontrado: %s", file)
+		}
+
+		user, err := os.ReadFile(GetConfigFilePath(file))
+		if os.IsNotExist(err) {
+			diffs = append(diffs, FileDiff{File: file, Missing: true})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo %s: %w", file, err)
+		}
+
+		diffs = append(diffs, FileDiff{
+			File: file,
+			Diff: unifiedDiff("embebido/"+file, "usuario/"+file, string(embedded), string(user)),
+		})
+	}
+
+	return diffs, nil
+}
+
+// diffOp is a line of a diff: ' ' kept, '-' removed or '+' added
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff returns a unified diff between two texts, empty when equal
+func unifiedDiff(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+
+	// Group changes with their context into hunks
+	for start := 0; start < len(ops); {
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		hunkStart := max(start-diffContext, 0)
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			// Stop when the unchanged run is longer than both contexts
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				break
+			}
+			end = run
+		}
+		hunkEnd := min(end+diffContext, len(ops))
+
+		fromLine, toLine := 1, 1
+		for _, op := range ops[:hunkStart] {
+			if op.kind != '+' {
+				fromLine++
+			}
+			if op.kind != '-' {
+				toLine++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, op := range ops[hunkStart:hunkEnd] {
+			if op.kind != '+' {
+				fromCount++
+			}
+			if op.kind != '-' {
+				toCount++
+			}
+		}
+
+		// An empty side is numbered after the line preceding it, as diff -u does
+		if fromCount == 0 {
+			fromLine--
+		}
+		if toCount == 0 {
+			toLine--
+		}
+
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount)
+		for _, op := range ops[hunkStart:hunkEnd] {
+			fmt.Fprintf(&b, "%c%s\n", op.kind, op.line)
+		}
+
+		start = hunkEnd
+	}
+
+	return b.String()
+}
+
+// splitLines splits text into lines without the trailing newline
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// lcsTable returns the table whose [i][j] entry is the length of the
+// longest common subsequence of from[i:] and to[j:]
+func lcsTable(from, to []string) [][]int {
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	return lcs
+}
+
+// diffLines computes a line diff from the longest common subsequence
+func diffLines(from, to []string) []diffOp {
+	lcs := lcsTable(from, to)
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			ops = append(ops, diffOp{' ', from[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', from[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		ops = append(ops, diffOp{'-', from[i]})
+	}
+	for ; j < len(to); j++ {
+		ops = append(ops, diffOp{'+', to[j]})
+	}
+
+	return ops
+}
@@ -0,0 +1,75 @@
+package config
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{
+			name: "iguales",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name: "línea cambiada",
+			from: "a\nb\nc\n",
+			to:   "a\nB\nc\n",
+			want: "--- viejo\n+++ nuevo\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "línea agregada al final",
+			from: "a\n",
+			to:   "a\nb\n",
+			want: "--- viejo\n+++ nuevo\n@@ -1,1 +1,2 @@\n a\n+b\n",
+		},
+		{
+			name: "desde vacío",
+			from: "",
+			to:   "a\n",
+			want: "--- viejo\n+++ nuevo\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			name: "hasta vacío",
+			from: "a\nb\n",
+			to:   "",
+			want: "--- viejo\n+++ nuevo\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "sin salto de línea final",
+			from: "a\nb",
+			to:   "a\nc",
+			want: "--- viejo\n+++ nuevo\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+		},
+		{
+			name: "contexto recortado",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:   "1\n2\n3\n4\n5\n6\n7\nX\n",
+			want: "--- viejo\n+++ nuevo\n@@ -5,4 +5,4 @@\n 5\n 6\n 7\n-8\n+X\n",
+		},
+		{
+			name: "dos hunks",
+			from: "a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			to:   "A\n1\n2\n3\n4\n5\n6\n7\nB\n",
+			want: "--- viejo\n+++ nuevo\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+		},
+		{
+			name: "cambios cercanos en un hunk",
+			from: "a\n1\n2\nb\n",
+			to:   "A\n1\n2\nB\n",
+			want: "--- viejo\n+++ nuevo\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n-b\n+B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("viejo", "nuevo", tt.from, tt.to); got != tt.want {
+				t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// DefaultTenantName is the tenant used when none is selected
+const DefaultTenantName = "orgm"
+
+// Tenant is a company that issues proposals and budgets. Its fields match
+// the datos.tenant block of presupuesto.json.
+type Tenant struct {
+	Logo            string `yaml:"logo" json:"logo"`
+	QRCode          string `yaml:"qr_code" json:"qr_code"`
+	RNC             string `yaml:"rnc" json:"rnc"`
+	RazonSocial     string `yaml:"razon_social" json:"razon_social"`
+	NombreComercial string `yaml:"nombre_comercial" json:"nombre_comercial"`
+	Direccion       string `yaml:"direccion" json:"direccion"`
+	Ubicacion       string `yaml:"ubicacion" json:"ubicacion"`
+	// LogoPropuesta is the logo URL of proposals; empty uses Logo
+	LogoPropuesta string `yaml:"logo_propuesta,omitempty" json:"-"`
+}
+
+// tenantNamePattern keeps profile names usable as YAML keys and in
+// ORGMPROP_TENANTS__<name>__<field> variables
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_]*$`)
+
+// DefaultTenant is the company data shipped with orgmprop
+var DefaultTenant = Tenant{
+	Logo:            "https://r2.or-gm.com/orgm.png",
+	QRCode:          "https://r2.or-gm.com/qr_code.png",
+	RNC:             "131-91523-1",
+	RazonSocial:     "ORGM EIRL",
+	NombreComercial: "ORGM",
+	Direccion:       "Av. 27 de febrero #506,",
+	Ubicacion:       "Santo Domingo, DN",
+	LogoPropuesta:   "https://r2.or-gm.com/orgm.svg",
+}
+
+// ProposalLogo returns the logo URL used in proposals
+func (t Tenant) ProposalLogo() string {
+	if t.LogoPropuesta != "" {
+		return t.LogoPropuesta
+	}
+	return t.Logo
+}
+
+// TenantNames returns the configured tenant names, sorted, including the
+// default tenant
+func (c *Config) TenantNames() []string {
+	names := []string{}
+	if _, ok := c.Tenants[DefaultTenantName]; !ok {
+		names = append(names, DefaultTenantName)
+	}
+	for name := range c.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ActiveTenant returns the selected tenant name and profile. An unknown or
+// empty selection falls back to the default tenant.
+func (c *Config) ActiveTenant() (string, Tenant) {
+	name := c.Tenant
+	if name == "" {
+		name = DefaultTenantName
+	}
+	if tenant, ok := c.Tenants[name]; ok {
+		return name, tenant
+	}
+	return DefaultTenantName, c.defaultTenant()
+}
+
+// defaultTenant returns the default tenant, which may be overridden in config
+func (c *Config) defaultTenant() Tenant {
+	if tenant, ok := c.Tenants[DefaultTenantName]; ok {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// ValidateTenantName checks that name can be used as a tenant profile name
+func ValidateTenantName(name string) error {
+	if !tenantNamePattern.MatchString(name) {
+		return fmt.Errorf("nombre de perfil inválido %q: usa minúsculas, números o '_'", name)
+	}
+	return nil
+}
+
+// SetTenant adds or replaces a tenant profile
+func (c *Config) SetTenant(name string, tenant Tenant) {
+	if c.Tenants == nil {
+		c.Tenants = make(map[string]Tenant)
+	}
+	c.Tenants[name] = tenant
+}
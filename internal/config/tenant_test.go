@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestValidateTenantName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"dapec", true},
+		{"orgm_2", true},
+		{"new", true},
+		{"", false},
+		{"Dapec", false},
+		{"mi empresa", false},
+		{"_dapec", false},
+		{"da-pec", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateTenantName(tt.name); (err == nil) != tt.valid {
+			t.Errorf("ValidateTenantName(%q) = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"orgmprop/assets"
+	"orgmprop/internal/logger"
+)
+
+// TemplatesStateDir keeps the stamps and the embedded base of every
+// installed template, inside ConfigDir
+const TemplatesStateDir = ".plantillas"
+
+// templateStampsFileName is the stamp manifest inside TemplatesStateDir
+const templateStampsFileName = "sellos.json"
+
+// Upgrade outcomes of a template
+const (
+	UpgradeCurrent   = "actualizado"
+	UpgradeReplaced  = "reemplazado"
+	UpgradeMerged    = "combinado"
+	UpgradeConflicts = "combinado con conflictos resueltos"
+	UpgradeInstalled = "instalado"
+	UpgradeNoBase    = "personalizado sin versión base"
+)
+
+// Conflict resolutions
+const (
+	ResolveUser = "usuario"
+	ResolveNew  = "nuevo"
+	ResolveBoth = "ambos"
+)
+
+// TemplateStamp records the embedded template an installed copy came from
+type TemplateStamp struct {
+	Version string    `json:"version"`
+	Hash    string    `json:"hash"`
+	Fecha   time.Time `json:"fecha"`
+}
+
+// MergeConflict is a region changed both by the user and by the new template
+type MergeConflict struct {
+	File string
+	Base []string
+	User []string
+	New  []string
+}
+
+// ConflictResolver picks ResolveUser, ResolveNew or ResolveBoth for a conflict
+type ConflictResolver func(conflict MergeConflict) (string, error)
+
+// TemplateUpgrade is the outcome of upgrading one template
+type TemplateUpgrade struct {
+	File      string
+	Result    string
+	Conflicts int
+}
+
+var (
+	previousHashesOnce sync.Once
+	// previousHashes maps each template to the hashes of its previous
+	// embedded versions and the TemplatesVersion they shipped in
+	previousHashes map[string]map[string]string
+)
+
+// previousTemplateVersion returns the earlier TemplatesVersion whose embedded
+// file had the given hash, so unstamped copies can be matched to a base
+func previousTemplateVersion(file, hash string) (string, bool) {
+	previousHashesOnce.Do(func() {
+		previousHashes = map[string]map[string]string{}
+		data, err := assets.GetTemplateHashes()
+		if err == nil {
+			err = json.Unmarshal(data, &previousHashes)
+		}
+		if err != nil {
+			logger.Warn("Error leyendo hashes de plantillas anteriores: %v", err)
+		}
+	})
+
+	version, ok := previousHashes[file][hash]
+	return version, ok
+}
+
+// templateHash returns the hex SHA-256 of a template
+func templateHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// templateStatePath returns a path inside TemplatesStateDir
+func templateStatePath(name string) string {
+	return filepath.Join(ConfigDir, TemplatesStateDir, name)
+}
+
+// loadTemplateStamps reads the stamp manifest; missing means no stamps
+func loadTemplateStamps() (map[string]TemplateStamp, error) {
+	stamps := map[string]TemplateStamp{}
+
+	data, err := os.ReadFile(templateStatePath(templateStampsFileName))
+	if os.IsNotExist(err) {
+		return stamps, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo sellos de plantillas: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &stamps); err != nil {
+		return nil, fmt.Errorf("error parseando sellos de plantillas: %w", err)
+	}
+	return stamps, nil
+}
+
+// saveTemplateStamps writes the stamp manifest
+func saveTemplateStamps(stamps map[string]TemplateStamp) error {
+	if err := os.MkdirAll(templateStatePath(""), 0755); err != nil {
+		return fmt.Errorf("error creando directorio de plantillas: %w", err)
+	}
+
+	data, err := json.MarshalIndent(stamps, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializando sellos de plantillas: %w", err)
+	}
+
+	if err := os.WriteFile(templateStatePath(templateStampsFileName), data, 0644); err != nil {
+		return fmt.Errorf("error guardando sellos de plantillas: %w", err)
+	}
+	return nil
+}
+
+// stampTemplate records that file was installed from the embedded version,
+// keeping a copy as the base of future merges
+func stampTemplate(file string, embedded []byte) error {
+	stamps, err := loadTemplateStamps()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(templateStatePath(""), 0755); err != nil {
+		return fmt.Errorf("error creando directorio de plantillas: %w", err)
+	}
+	if err := os.WriteFile(templateStatePath(file), embedded, 0644); err != nil {
+		return fmt.Errorf("error guardando base de %s: %w", file, err)
+	}
+
+	stamps[file] = TemplateStamp{
+		Version: assets.TemplatesVersion,
+		Hash:    templateHash(embedded),
+		Fecha:   time.Now(),
+	}
+	return saveTemplateStamps(stamps)
+}
+
+// unstampTemplate forgets the stamp of a file that no longer comes from the
+// embedded templates, such as one installed from the template source
+func unstampTemplate(file string) error {
+	stamps, err := loadTemplateStamps()
+	if err != nil {
+		return err
+	}
+	if _, ok := stamps[file]; !ok {
+		return nil
+	}
+
+	delete(stamps, file)
+	os.Remove(templateStatePath(file))
+	return saveTemplateStamps(stamps)
+}
+
+// OutdatedTemplates returns the installed templates whose stamp differs from
+// the templates embedded in this binary, and unstamped copies identical to a
+// previous embedded version. Other unstamped copies are skipped: they cannot
+// be upgraded, only reviewed with config diff.
+func OutdatedTemplates() ([]string, error) {
+	stamps, err := loadTemplateStamps()
+	if err != nil {
+		return nil, err
+	}
+
+	var outdated []string
+	for _, file := range TemplateFiles {
+		if _, err := os.Stat(GetConfigFilePath(file)); err != nil {
+			continue
+		}
+
+		embedded, err := assets.FS.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("archivo embebido no encontrado: %s", file)
+		}
+
+		if stamp, ok := stamps[file]; ok && stamp.Hash != templateHash(embedded) {
+			outdated = append(outdated, file)
+		} else if !ok {
+			user, err := os.ReadFile(GetConfigFilePath(file))
+			if err != nil {
+				return nil, err
+			}
+			if _, known := previousTemplateVersion(file, templateHash(user)); known {
+				outdated = append(outdated, file)
+			}
+		}
+	}
+
+	return outdated, nil
+}
+
+// UpgradeTemplates brings the installed templates up to the embedded ones.
+// Unchanged copies are replaced; customized copies get a three-way merge of
+// the base they were installed from, the user's copy and the new template,
+// with conflicts decided by resolve. The previous copy is kept as <file>.bak.
+func UpgradeTemplates(resolve ConflictResolver) ([]TemplateUpgrade, error) {
+	logger.Debug("Actualizando plantillas a la versión %s", assets.TemplatesVersion)
+
+	stamps, err := loadTemplateStamps()
+	if err != nil {
+		return nil, err
+	}
+
+	var upgrades []TemplateUpgrade
+	for _, file := range TemplateFiles {
+		upgrade, err := upgradeTemplate(file, stamps[file], resolve)
+		if err != nil {
+			return upgrades, fmt.Errorf("error actualizando %s: %w", file, err)
+		}
+		logger.Debug("Plantilla %s: %s", file, upgrade.Result)
+		upgrades = append(upgrades, upgrade)
+	}
+
+	return upgrades, nil
+}
+
+// upgradeTemplate upgrades a single template
+func upgradeTemplate(file string, stamp TemplateStamp, resolve ConflictResolver) (TemplateUpgrade, error) {
+	upgrade := TemplateUpgrade{File: file}
+
+	embedded, err := assets.FS.ReadFile(file)
+	if err != nil {
+		return upgrade, fmt.Errorf("archivo embebido no encontrado")
+	}
+	newHash := templateHash(embedded)
+
+	path := GetConfigFilePath(file)
+	user, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		upgrade.Result = UpgradeInstalled
+		return upgrade, installTemplate(file, embedded)
+	}
+	if err != nil {
+		return upgrade, err
+	}
+
+	if stamp.Hash == newHash {
+		upgrade.Result = UpgradeCurrent
+		return upgrade, nil
+	}
+
+	userHash := templateHash(user)
+	if userHash == newHash {
+		upgrade.Result = UpgradeCurrent
+		return upgrade, stampTemplate(file, embedded)
+	}
+
+	// Without the base it was installed from there is nothing to merge
+	// against, unless the copy is an unchanged previous version; config diff
+	// and config reset handle the rest
+	base, err := os.ReadFile(templateStatePath(file))
+	if stamp.Hash == "" || err != nil || templateHash(base) != stamp.Hash {
+		if version, ok := previousTemplateVersion(file, userHash); ok {
+			logger.Debug("%s sin sello coincide con la versión %s", file, version)
+			upgrade.Result = UpgradeReplaced
+			return upgrade, replaceTemplate(file, user, embedded, embedded)
+		}
+		upgrade.Result = UpgradeNoBase
+		return upgrade, nil
+	}
+
+	if userHash == stamp.Hash {
+		upgrade.Result = UpgradeReplaced
+		return upgrade, replaceTemplate(file, user, embedded, embedded)
+	}
+
+	// The logo is not merged line by line
+	if filepath.Ext(file) == ".svg" {
+		upgrade.Result = UpgradeNoBase
+		return upgrade, nil
+	}
+
+	merged, conflicts := mergeLines(splitLines(string(base)), splitLines(string(user)), splitLines(string(embedded)))
+	result := make([]string, 0, len(merged))
+	for _, chunk := range merged {
+		if chunk.conflict == nil {
+			result = append(result, chunk.lines...)
+			continue
+		}
+
+		chunk.conflict.File = file
+		choice, err := resolve(*chunk.conflict)
+		if err != nil {
+			return upgrade, err
+		}
+		switch choice {
+		case ResolveUser:
+			result = append(result, chunk.conflict.User...)
+		case ResolveNew:
+			result = append(result, chunk.conflict.New...)
+		case ResolveBoth:
+			result = append(result, chunk.conflict.User...)
+			result = append(result, chunk.conflict.New...)
+		default:
+			return upgrade, fmt.Errorf("resolución desconocida: %s", choice)
+		}
+	}
+
+	upgrade.Result = UpgradeMerged
+	upgrade.Conflicts = conflicts
+	if conflicts > 0 {
+		upgrade.Result = UpgradeConflicts
+	}
+
+	content := strings.Join(result, "\n")
+	if len(result) > 0 {
+		content += "\n"
+	}
+	return upgrade, replaceTemplate(file, user, []byte(content), embedded)
+}
+
+// installTemplate writes a missing template and stamps it
+func installTemplate(file string, embedded []byte) error {
+	if err := os.WriteFile(GetConfigFilePath(file), embedded, 0644); err != nil {
+		return err
+	}
+	return stampTemplate(file, embedded)
+}
+
+// replaceTemplate backs up the user's copy, writes the upgraded content and
+// stamps it with the embedded template it is now based on
+func replaceTemplate(file string, previous, content, embedded []byte) error {
+	path := GetConfigFilePath(file)
+	if err := os.WriteFile(path+".bak", previous, 0644); err != nil {
+		return fmt.Errorf("error respaldando: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return err
+	}
+	return stampTemplate(file, embedded)
+}
+
+// mergeChunk is a resolved region of a merge, or a conflict
+type mergeChunk struct {
+	lines    []string
+	conflict *MergeConflict
+}
+
+// matchLines maps each line of from that is part of the longest common
+// subsequence to its line in to
+func matchLines(from, to []string) map[int]int {
+	lcs := lcsTable(from, to)
+	matches := map[int]int{}
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			matches[i] = j
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
+
+// mergeLines runs a diff3 merge of the user and updated changes over base and
+// returns the merged chunks and the number of conflicts
+func mergeLines(base, user, updated []string) ([]mergeChunk, int) {
+	userMatches := matchLines(base, user)
+	newMatches := matchLines(base, updated)
+
+	var chunks []mergeChunk
+	conflicts := 0
+	i, a, b := 0, 0, 0
+	for {
+		// Lines unchanged in all three versions
+		if i < len(base) {
+			if ua, ok := userMatches[i]; ok && ua == a {
+				if nb, ok := newMatches[i]; ok && nb == b {
+					chunks = append(chunks, mergeChunk{lines: []string{base[i]}})
+					i, a, b = i+1, a+1, b+1
+					continue
+				}
+			}
+		}
+
+		// Find the next line of base kept by both sides
+		k, ua, nb := len(base), len(user), len(updated)
+		for candidate := i; candidate < len(base); candidate++ {
+			u, uok := userMatches[candidate]
+			n, nok := newMatches[candidate]
+			if uok && nok {
+				k, ua, nb = candidate, u, n
+				break
+			}
+		}
+
+		baseChunk, userChunk, newChunk := base[i:k], user[a:ua], updated[b:nb]
+		switch {
+		case len(baseChunk) == 0 && len(userChunk) == 0 && len(newChunk) == 0:
+		case equalLines(userChunk, baseChunk):
+			chunks = append(chunks, mergeChunk{lines: newChunk})
+		case equalLines(newChunk, baseChunk), equalLines(userChunk, newChunk):
+			chunks = append(chunks, mergeChunk{lines: userChunk})
+		default:
+			conflicts++
+			chunks = append(chunks, mergeChunk{conflict: &MergeConflict{Base: baseChunk, User: userChunk, New: newChunk}})
+		}
+
+		if k == len(base) {
+			break
+		}
+		i, a, b = k, ua, nb
+	}
+
+	return chunks, conflicts
+}
+
+// equalLines reports whether two line slices are equal
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
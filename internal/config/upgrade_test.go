@@ -0,0 +1,200 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"orgmprop/assets"
+)
+
+// renderMerge flattens merged chunks, writing a conflict as
+// "<user|new>" with its lines joined by commas
+func renderMerge(chunks []mergeChunk) []string {
+	var lines []string
+	for _, chunk := range chunks {
+		if chunk.conflict == nil {
+			lines = append(lines, chunk.lines...)
+			continue
+		}
+		lines = append(lines, "<"+strings.Join(chunk.conflict.User, ",")+"|"+strings.Join(chunk.conflict.New, ",")+">")
+	}
+	return lines
+}
+
+func TestMergeLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		user      string
+		updated   string
+		want      string
+		conflicts int
+	}{
+		{
+			name:    "sin cambios",
+			base:    "a b c",
+			user:    "a b c",
+			updated: "a b c",
+			want:    "a b c",
+		},
+		{
+			name:    "solo el usuario",
+			base:    "a b c",
+			user:    "a B c",
+			updated: "a b c",
+			want:    "a B c",
+		},
+		{
+			name:    "solo la plantilla nueva",
+			base:    "a b c",
+			user:    "a b c",
+			updated: "a b C",
+			want:    "a b C",
+		},
+		{
+			name:    "regiones distintas",
+			base:    "a b c d e",
+			user:    "A b c d e",
+			updated: "a b c d E",
+			want:    "A b c d E",
+		},
+		{
+			name:    "mismo cambio en ambos",
+			base:    "a b c",
+			user:    "a X c",
+			updated: "a X c",
+			want:    "a X c",
+		},
+		{
+			name:    "líneas agregadas por ambos",
+			base:    "a b c",
+			user:    "u a b c",
+			updated: "a b c n",
+			want:    "u a b c n",
+		},
+		{
+			name:    "línea borrada por el usuario",
+			base:    "a b c",
+			user:    "a c",
+			updated: "a b c",
+			want:    "a c",
+		},
+		{
+			name:      "conflicto",
+			base:      "a b c",
+			user:      "a X c",
+			updated:   "a Y c",
+			want:      "a <X|Y> c",
+			conflicts: 1,
+		},
+		{
+			name:      "conflicto con borrado",
+			base:      "a b c",
+			user:      "a c",
+			updated:   "a Y c",
+			want:      "a <|Y> c",
+			conflicts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, conflicts := mergeLines(strings.Fields(tt.base), strings.Fields(tt.user), strings.Fields(tt.updated))
+			if got := renderMerge(chunks); !reflect.DeepEqual(got, strings.Fields(tt.want)) {
+				t.Errorf("mergeLines = %q, want %q", got, strings.Fields(tt.want))
+			}
+			if conflicts != tt.conflicts {
+				t.Errorf("conflicts = %d, want %d", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestPreviousTemplateHashes(t *testing.T) {
+	previousTemplateVersion("", "")
+
+	current, err := strconv.Atoi(assets.TemplatesVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	known := map[string]bool{}
+	for _, file := range TemplateFiles {
+		known[file] = true
+	}
+	for file, hashes := range previousHashes {
+		if !known[file] {
+			t.Errorf("template_hashes.json lists unknown template %s", file)
+			continue
+		}
+		embedded, err := assets.FS.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version, ok := hashes[templateHash(embedded)]; ok {
+			t.Errorf("template_hashes.json lists the current %s as version %s", file, version)
+		}
+		for hash, version := range hashes {
+			if n, err := strconv.Atoi(version); err != nil || n >= current {
+				t.Errorf("%s hash %s has version %s, want before %s", file, hash, version, assets.TemplatesVersion)
+			}
+		}
+	}
+}
+
+func TestUpgradeTemplateUnstamped(t *testing.T) {
+	const file = "template.css"
+	const previous = "body { color: black; }\n"
+
+	embedded, err := assets.FS.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousTemplateVersion("", "")
+	hashes := previousHashes[file]
+	previousHashes[file] = map[string]string{templateHash([]byte(previous)): "1"}
+	defer func() { previousHashes[file] = hashes }()
+
+	previousDir := ConfigDir
+	defer func() { ConfigDir = previousDir }()
+
+	tests := []struct {
+		name     string
+		user     string
+		want     string
+		wantFile string
+	}{
+		{"versión anterior sin cambios", previous, UpgradeReplaced, string(embedded)},
+		{"versión anterior personalizada", previous + "h1 { color: red; }\n", UpgradeNoBase, previous + "h1 { color: red; }\n"},
+		{"versión actual", string(embedded), UpgradeCurrent, string(embedded)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ConfigDir = t.TempDir()
+			if err := os.WriteFile(GetConfigFilePath(file), []byte(tt.user), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			upgrade, err := upgradeTemplate(file, TemplateStamp{}, nil)
+			if err != nil {
+				t.Fatalf("upgradeTemplate: %v", err)
+			}
+			if upgrade.Result != tt.want {
+				t.Errorf("Result = %q, want %q", upgrade.Result, tt.want)
+			}
+
+			got, err := os.ReadFile(GetConfigFilePath(file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantFile {
+				t.Errorf("file = %q, want %q", got, tt.wantFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/logger"
+	"orgmprop/internal/project"
+	"orgmprop/internal/ui"
+)
+
+// AttachableFiles lists the files of the Recibido folder of the current
+// project that can be attached
+func AttachableFiles() ([]string, error) {
+	projectDir, err := project.CurrentProjectDir()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := project.ListRecibidoFiles(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var supported []string
+	for _, file := range files {
+		if ai.IsSupportedAttachment(file) {
+			supported = append(supported, file)
+		}
+	}
+	return supported, nil
+}
+
+// LoadAttachments loads files by their path inside the Recibido folder of the
+// current project. Absolute paths and paths leaving the folder are rejected.
+func LoadAttachments(names []string) ([]ai.Attachment, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	projectDir, err := project.CurrentProjectDir()
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := make([]ai.Attachment, 0, len(names))
+	for _, name := range names {
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("adjunto fuera de la carpeta Recibido: %s", name)
+		}
+		attachment, err := ai.LoadAttachment(filepath.Join(projectDir, "Recibido", name), name)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+// attachmentNames returns the names recorded for a set of attachments
+func attachmentNames(attachments []ai.Attachment) []string {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(attachments))
+	for i, attachment := range attachments {
+		names[i] = attachment.Name
+	}
+	return names
+}
+
+// SelectAttachments shows a file picker over the Recibido folder of the
+// current project and loads the selected files. Returns nil when the folder
+// has no supported files or nothing is selected.
+func SelectAttachments() ([]ai.Attachment, error) {
+	files, err := AttachableFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		logger.Debug("No hay archivos adjuntables en Recibido")
+		return nil, nil
+	}
+
+	selected, err := ui.MultiSelect(
+		"Adjuntar archivos de Recibido",
+		"PDF, imágenes, texto y CSV. Espacio para marcar, Enter para continuar",
+		files,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadAttachments(selected)
+}
@@ -0,0 +1,554 @@
+package generator
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/config"
+	"orgmprop/internal/ledger"
+	"orgmprop/internal/logger"
+	"orgmprop/internal/project"
+	"orgmprop/internal/ui"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BatchStateDir keeps the submitted async batches inside ConfigDir, so an
+// interrupted wait can be resumed
+const BatchStateDir = "lotes"
+
+// BatchItem is a manifest entry: a project folder and its description file
+type BatchItem struct {
+	// Proyecto is the project folder, absolute or relative to the base folder
+	Proyecto string `yaml:"proyecto"`
+	// Descripcion is the description file, absolute or relative to the manifest
+	Descripcion string `yaml:"descripcion"`
+}
+
+// BatchOptions controls how a batch is run
+type BatchOptions struct {
+	// Workers limits concurrent generations; 0 uses batch_workers from config
+	Workers int
+	// Async submits every request through the provider's batch API
+	Async bool
+	// OnStatus receives progress messages
+	OnStatus func(string)
+}
+
+// BatchResult is the outcome of one entry of a batch
+type BatchResult struct {
+	Project      string
+	Output       string
+	Error        string
+	Warning      string
+	Duration     time.Duration
+	InputTokens  int64
+	OutputTokens int64
+}
+
+// BatchState is an async batch whose results were not saved yet
+type BatchState struct {
+	ID     string    `json:"id"`
+	Modelo string    `json:"modelo"`
+	Fecha  time.Time `json:"fecha"`
+	// Entries maps the request IDs of the batch to their manifest items
+	Entries []BatchStateEntry `json:"entradas"`
+}
+
+// BatchStateEntry is a submitted request of an async batch
+type BatchStateEntry struct {
+	ID   string    `json:"id"`
+	Item BatchItem `json:"item"`
+}
+
+// LoadBatchManifest reads a CSV or YAML manifest. CSV files have the columns
+// proyecto,descripcion with an optional header; YAML files hold a list of
+// items with those keys. Relative description paths are resolved against the
+// manifest directory.
+func LoadBatchManifest(path string) ([]BatchItem, error) {
+	logger.Debug("Cargando manifiesto de lote: %s", path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo manifiesto: %w", err)
+	}
+
+	var items []BatchItem
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		items, err = parseCSVManifest(string(data))
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &items)
+	default:
+		return nil, fmt.Errorf("formato de manifiesto no soportado: %s (usa .csv o .yaml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parseando manifiesto: %w", err)
+	}
+
+	baseDir := filepath.Dir(path)
+	for i, item := range items {
+		if item.Proyecto == "" || item.Descripcion == "" {
+			return nil, fmt.Errorf("entrada %d del manifiesto incompleta: se requieren proyecto y descripcion", i+1)
+		}
+		if !filepath.IsAbs(item.Descripcion) {
+			items[i].Descripcion = filepath.Join(baseDir, item.Descripcion)
+		}
+	}
+
+	logger.Debug("Manifiesto con %d entradas", len(items))
+	return items, nil
+}
+
+// parseCSVManifest parses proyecto,descripcion rows, skipping a header row
+func parseCSVManifest(data string) ([]BatchItem, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var items []BatchItem
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(items) == 0 && strings.EqualFold(record[0], "proyecto") {
+			continue
+		}
+		items = append(items, BatchItem{Proyecto: record[0], Descripcion: record[1]})
+	}
+
+	return items, nil
+}
+
+// batchJob is a manifest entry ready to be generated
+type batchJob struct {
+	// id identifies the request within an async batch
+	id        string
+	item      BatchItem
+	project   string
+	ofertaDir string
+	req       ai.Request
+	tenant    config.Tenant
+	// provider is the AI provider the request is sent to
+	provider string
+}
+
+// RunBatch generates a presupuesto.json in the Oferta folder of every
+// manifest entry and returns one result per entry. A failing entry does not
+// stop the others. With Async, failing to submit or to wait for the batch is
+// returned as an error; an interrupted wait can be resumed with ResumeBatch.
+func RunBatch(ctx context.Context, items []BatchItem, opts BatchOptions) ([]BatchResult, error) {
+	logger.Debug("Iniciando lote de %d presupuestos", len(items))
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error cargando configuración: %w", err)
+	}
+
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, results := newBatchJobs(cfg, items, func(i int) string { return fmt.Sprintf("presupuesto-%d", i) })
+
+	if opts.Async {
+		batchProvider, ok := provider.(ai.BatchProvider)
+		if !ok {
+			return nil, fmt.Errorf("el proveedor %s no admite la API de lotes", cfg.GetProvider())
+		}
+		return results, runAsyncBatch(ctx, batchProvider, jobs, results, opts.OnStatus)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = cfg.GetBatchWorkers()
+	}
+	runWorkerPool(ctx, cfg, provider, jobs, results, workers, opts.OnStatus)
+
+	return results, nil
+}
+
+// ResumeBatch waits for an async batch whose wait was interrupted, using the
+// state saved when it was submitted, and saves its budgets
+func ResumeBatch(ctx context.Context, batchID string, opts BatchOptions) ([]BatchResult, error) {
+	logger.Debug("Reanudando lote %s", batchID)
+
+	state, err := loadBatchState(batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error cargando configuración: %w", err)
+	}
+
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	batchProvider, ok := provider.(ai.BatchProvider)
+	if !ok {
+		return nil, fmt.Errorf("el proveedor %s no admite la API de lotes", cfg.GetProvider())
+	}
+
+	items := make([]BatchItem, len(state.Entries))
+	for i, entry := range state.Entries {
+		items[i] = entry.Item
+	}
+	jobs, results := newBatchJobs(cfg, items, func(i int) string { return state.Entries[i].ID })
+
+	return results, awaitAsyncBatch(ctx, batchProvider, state, jobs, results, opts.OnStatus)
+}
+
+// PendingBatches returns the async batches whose results were not saved yet
+func PendingBatches() ([]BatchState, error) {
+	entries, err := os.ReadDir(config.GetConfigFilePath(BatchStateDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo lotes pendientes: %w", err)
+	}
+
+	var states []BatchState
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		state, err := loadBatchState(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			logger.Warn("%v", err)
+			continue
+		}
+		states = append(states, *state)
+	}
+	return states, nil
+}
+
+// batchStatePath returns the state file of an async batch
+func batchStatePath(batchID string) string {
+	return filepath.Join(config.GetConfigFilePath(BatchStateDir), batchID+".json")
+}
+
+// saveBatchState records a submitted async batch
+func saveBatchState(state *BatchState) error {
+	if err := os.MkdirAll(config.GetConfigFilePath(BatchStateDir), 0755); err != nil {
+		return fmt.Errorf("error creando directorio de lotes: %w", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializando lote: %w", err)
+	}
+
+	if err := os.WriteFile(batchStatePath(state.ID), data, 0644); err != nil {
+		return fmt.Errorf("error guardando lote: %w", err)
+	}
+	return nil
+}
+
+// loadBatchState reads the state of a submitted async batch
+func loadBatchState(batchID string) (*BatchState, error) {
+	if batchID == "" || strings.ContainsAny(batchID, `/\`) {
+		return nil, fmt.Errorf("ID de lote inválido: %q", batchID)
+	}
+
+	data, err := os.ReadFile(batchStatePath(batchID))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("lote %s no encontrado entre los lotes pendientes", batchID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo lote %s: %w", batchID, err)
+	}
+
+	var state BatchState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parseando lote %s: %w", batchID, err)
+	}
+	return &state, nil
+}
+
+// newBatchJobs builds the jobs of the items, with one result per item. Items
+// that cannot be generated get a nil job and the error in their result.
+func newBatchJobs(cfg *config.Config, items []BatchItem, id func(i int) string) ([]*batchJob, []BatchResult) {
+	results := make([]BatchResult, len(items))
+	jobs := make([]*batchJob, len(items))
+	for i, item := range items {
+		results[i] = BatchResult{Project: item.Proyecto}
+
+		job, err := newBatchJob(cfg, item)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		job.id = id(i)
+		jobs[i] = job
+		results[i].Project = job.project
+	}
+	return jobs, results
+}
+
+// newBatchJob resolves the Oferta folder and builds the request of an entry
+func newBatchJob(cfg *config.Config, item BatchItem) (*batchJob, error) {
+	projectDir := item.Proyecto
+	if !filepath.IsAbs(projectDir) {
+		if cfg.BaseFolder == "" {
+			return nil, fmt.Errorf("carpeta base no configurada. Ejecuta 'orgmprop config folder'")
+		}
+		projectDir = filepath.Join(cfg.BaseFolder, projectDir)
+	}
+
+	projectDir, ofertaDir := project.SplitOfertaPath(projectDir)
+
+	if _, err := os.Stat(projectDir); err != nil {
+		return nil, fmt.Errorf("carpeta del proyecto no encontrada: %s", projectDir)
+	}
+	if err := os.MkdirAll(ofertaDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creando carpeta Oferta: %w", err)
+	}
+
+	descripcion, err := os.ReadFile(item.Descripcion)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo descripción: %w", err)
+	}
+
+	req, err := newPresupuestoRequest(cfg, string(descripcion), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, tenant := cfg.ActiveTenant()
+
+	return &batchJob{
+		item:      item,
+		project:   filepath.Base(projectDir),
+		ofertaDir: ofertaDir,
+		req:       req,
+		tenant:    tenant,
+		provider:  cfg.GetProvider(),
+	}, nil
+}
+
+// runWorkerPool generates the jobs with at most workers concurrent requests
+func runWorkerPool(ctx context.Context, cfg *config.Config, provider ai.Provider, jobs []*batchJob, results []BatchResult, workers int, onStatus func(string)) {
+	logger.Debug("Generando lote con %d trabajadores", workers)
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				job := jobs[i]
+				if onStatus != nil {
+					onStatus(fmt.Sprintf("Generando %s...", job.project))
+				}
+
+				start := time.Now()
+				reqCtx, cancel := withRequestTimeout(ctx, cfg)
+				resp, err := provider.Generate(reqCtx, job.req)
+				cancel()
+
+				results[i].Duration = time.Since(start)
+				finishBatchJob(job, provider.Model(), resp, err, false, &results[i])
+			}
+		}()
+	}
+
+	for i, job := range jobs {
+		if job == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			results[i].Error = fmt.Sprintf("no iniciado: %v", ctx.Err())
+			continue
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// runAsyncBatch submits every job in a single provider batch, records it
+// so the wait can be resumed, and waits for its results
+func runAsyncBatch(ctx context.Context, provider ai.BatchProvider, jobs []*batchJob, results []BatchResult, onStatus func(string)) error {
+	state := &BatchState{Modelo: provider.Model(), Fecha: time.Now()}
+	var reqs []ai.BatchRequest
+	for _, job := range jobs {
+		if job == nil {
+			continue
+		}
+		reqs = append(reqs, ai.BatchRequest{ID: job.id, Request: job.req})
+		state.Entries = append(state.Entries, BatchStateEntry{ID: job.id, Item: job.item})
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	batchID, err := provider.SubmitBatch(ctx, reqs)
+	if err != nil {
+		return err
+	}
+	state.ID = batchID
+	if err := saveBatchState(state); err != nil {
+		logger.Warn("No se pudo registrar el lote %s; no se podrá reanudar: %v", batchID, err)
+	}
+
+	return awaitAsyncBatch(ctx, provider, state, jobs, results, onStatus)
+}
+
+// awaitAsyncBatch waits for a submitted batch and saves the budget of every
+// job. The batch state is removed once all its results are saved; an
+// interrupted wait keeps it for ResumeBatch, and entries whose results could
+// not be saved stay in it.
+func awaitAsyncBatch(ctx context.Context, provider ai.BatchProvider, state *BatchState, jobs []*batchJob, results []BatchResult, onStatus func(string)) error {
+	var reqs []ai.BatchRequest
+	byID := map[string]int{}
+	for i, job := range jobs {
+		if job == nil {
+			continue
+		}
+		reqs = append(reqs, ai.BatchRequest{ID: job.id, Request: job.req})
+		byID[job.id] = i
+	}
+
+	start := time.Now()
+	batchResults, err := provider.AwaitBatch(ctx, state.ID, reqs, onStatus)
+	if err != nil {
+		return fmt.Errorf("%w (reanuda con 'orgmprop batch --reanudar %s')", err, state.ID)
+	}
+	elapsed := time.Since(start)
+
+	saved := map[string]bool{}
+	for _, batchResult := range batchResults {
+		i, ok := byID[batchResult.ID]
+		if !ok {
+			logger.Debug("Resultado de lote sin trabajo: %s", batchResult.ID)
+			continue
+		}
+		results[i].Duration = elapsed
+		finishBatchJob(jobs[i], state.Modelo, batchResult.Response, batchResult.Err, true, &results[i])
+		saved[batchResult.ID] = true
+	}
+
+	// Results of entries that could not be rebuilt, or that the batch did
+	// not return, are still in the provider; only those entries are kept
+	var pending []BatchStateEntry
+	for _, entry := range state.Entries {
+		if !saved[entry.ID] {
+			pending = append(pending, entry)
+		}
+	}
+	if len(pending) > 0 {
+		state.Entries = pending
+		if err := saveBatchState(state); err != nil {
+			logger.Warn("No se pudo actualizar el registro del lote %s: %v", state.ID, err)
+		}
+		logger.Warn("%d presupuesto(s) del lote %s sin guardar; corrige sus entradas y reanuda con 'orgmprop batch --reanudar %s'", len(pending), state.ID, state.ID)
+		return nil
+	}
+
+	if err := os.Remove(batchStatePath(state.ID)); err != nil && !os.IsNotExist(err) {
+		logger.Warn("No se pudo eliminar el registro del lote %s: %v", state.ID, err)
+	}
+	return nil
+}
+
+// finishBatchJob records usage and saves the budget of a finished job
+func finishBatchJob(job *batchJob, model string, resp *ai.Response, err error, lote bool, result *BatchResult) {
+	// Failed requests may still have been billed
+	usage, billed := ai.UsageOf(err)
+	if resp != nil {
+		usage, billed = resp.Usage, true
+	}
+	if billed {
+		recordEntry(ledger.Entry{
+			Fecha:     time.Now(),
+			Proyecto:  job.project,
+			Tipo:      ai.KindPresupuesto,
+			Proveedor: job.provider,
+			Modelo:    model,
+			Lote:      lote,
+			Usage:     usage,
+		})
+		result.InputTokens = usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+		result.OutputTokens = usage.OutputTokens
+	}
+
+	// The model output is kept even when the job failed
+	raw, hasRaw := ai.RawOf(err)
+	if resp != nil {
+		raw, hasRaw = rawOutput(resp), true
+	}
+	if hasRaw && raw != "" {
+		if err := saveRawResponse(job.ofertaDir, raw); err != nil {
+			logger.Warn("No se pudo guardar la respuesta original de %s: %v", job.project, err)
+		}
+	}
+
+	if err != nil {
+		logger.Error("Error generando presupuesto de %s: %v", job.project, err)
+		result.Error = err.Error()
+		return
+	}
+
+	if resp.StopReason == "max_tokens" {
+		result.Warning = "respuesta truncada por max_tokens; aumenta max_tokens.presupuesto"
+		logger.Warn("Presupuesto de %s truncado por max_tokens; aumenta max_tokens.presupuesto", job.project)
+	}
+
+	jsonData, repairs, err := formatPresupuestoResponse(resp, job.tenant)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	presupuestoUsage := &PresupuestoUsage{
+		Modelo:       model,
+		Fecha:        time.Now(),
+		Uso:          resp.Usage,
+		Reparaciones: repairs,
+	}
+	if err := SavePresupuestoTo(job.ofertaDir, jsonData, presupuestoUsage); err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	result.Output = filepath.Join(job.ofertaDir, "presupuesto.json")
+	logger.Debug("Presupuesto de %s guardado en: %s", job.project, result.Output)
+}
+
+// BatchRows converts batch results for ui.ShowBatchReport
+func BatchRows(results []BatchResult) []ui.BatchResult {
+	rows := make([]ui.BatchResult, len(results))
+	for i, result := range results {
+		rows[i] = ui.BatchResult{
+			Project:      result.Project,
+			Output:       result.Output,
+			Error:        result.Error,
+			Warning:      result.Warning,
+			Duration:     result.Duration,
+			InputTokens:  result.InputTokens,
+			OutputTokens: result.OutputTokens,
+		}
+	}
+	return rows
+}
@@ -0,0 +1,207 @@
+package generator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/config"
+)
+
+func TestLoadBatchManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []BatchItem
+		wantErr string
+	}{
+		{
+			name:    "CSV con encabezado",
+			file:    "lote.csv",
+			content: "proyecto,descripcion\nobra-a,a.txt\nobra-b, /abs/b.txt\n",
+			want:    []BatchItem{{"obra-a", "a.txt"}, {"obra-b", "/abs/b.txt"}},
+		},
+		{
+			name:    "CSV sin encabezado y con comentarios",
+			file:    "lote.CSV",
+			content: "# pendientes\nobra-a,a.txt\n",
+			want:    []BatchItem{{"obra-a", "a.txt"}},
+		},
+		{
+			name:    "CSV con comillas",
+			file:    "lote.csv",
+			content: "\"obra, fase 2\",\"desc/a b.txt\"\n",
+			want:    []BatchItem{{"obra, fase 2", "desc/a b.txt"}},
+		},
+		{
+			name:    "CSV con columnas de más",
+			file:    "lote.csv",
+			content: "obra-a,a.txt,extra\n",
+			wantErr: "error parseando manifiesto",
+		},
+		{
+			name:    "CSV con entrada incompleta",
+			file:    "lote.csv",
+			content: "obra-a,\n",
+			wantErr: "entrada 1 del manifiesto incompleta",
+		},
+		{
+			name:    "YAML",
+			file:    "lote.yaml",
+			content: "- proyecto: obra-a\n  descripcion: a.txt\n- proyecto: /abs/obra-b\n  descripcion: /abs/b.txt\n",
+			want:    []BatchItem{{"obra-a", "a.txt"}, {"/abs/obra-b", "/abs/b.txt"}},
+		},
+		{
+			name:    "YML sin descripción",
+			file:    "lote.yml",
+			content: "- proyecto: obra-a\n- proyecto: obra-b\n  descripcion: b.txt\n",
+			wantErr: "entrada 1 del manifiesto incompleta",
+		},
+		{
+			name:    "YAML que no es una lista",
+			file:    "lote.yaml",
+			content: "proyecto: obra-a\n",
+			wantErr: "error parseando manifiesto",
+		},
+		{
+			name:    "formato no soportado",
+			file:    "lote.json",
+			content: "[]",
+			wantErr: "formato de manifiesto no soportado",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadBatchManifest(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadBatchManifest error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadBatchManifest: %v", err)
+			}
+
+			// Relative descriptions are resolved against the manifest
+			want := make([]BatchItem, len(tt.want))
+			for i, item := range tt.want {
+				want[i] = item
+				if !filepath.IsAbs(item.Descripcion) {
+					want[i].Descripcion = filepath.Join(dir, item.Descripcion)
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadBatchManifest = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// stubBatchProvider returns fixed results for any batch
+type stubBatchProvider struct {
+	*ai.FakeClient
+	results []ai.BatchResult
+}
+
+func (p *stubBatchProvider) SubmitBatch(ctx context.Context, reqs []ai.BatchRequest) (string, error) {
+	return "lote-1", nil
+}
+
+func (p *stubBatchProvider) AwaitBatch(ctx context.Context, batchID string, reqs []ai.BatchRequest, onStatus func(string)) ([]ai.BatchResult, error) {
+	return p.results, nil
+}
+
+func TestAwaitAsyncBatchPending(t *testing.T) {
+	example, err := os.ReadFile("testdata/presupuesto.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := &ai.Response{Text: string(example)}
+
+	tests := []struct {
+		name        string
+		rebuilt     []bool
+		returned    []string
+		wantPending []string
+	}{
+		{
+			name:     "todos guardados",
+			rebuilt:  []bool{true, true},
+			returned: []string{"a", "b"},
+		},
+		{
+			name:        "entrada sin reconstruir",
+			rebuilt:     []bool{true, false},
+			returned:    []string{"a", "b"},
+			wantPending: []string{"b"},
+		},
+		{
+			name:        "resultado no devuelto",
+			rebuilt:     []bool{true, true},
+			returned:    []string{"a"},
+			wantPending: []string{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeProvider(t, "testdata")
+
+			state := &BatchState{ID: "lote-1", Modelo: ai.FakeModel}
+			jobs := make([]*batchJob, len(tt.rebuilt))
+			for i, id := range []string{"a", "b"} {
+				state.Entries = append(state.Entries, BatchStateEntry{ID: id, Item: BatchItem{Proyecto: id, Descripcion: id + ".txt"}})
+				if tt.rebuilt[i] {
+					jobs[i] = &batchJob{id: id, project: id, ofertaDir: t.TempDir(), provider: config.ProviderFake}
+				}
+			}
+			if err := saveBatchState(state); err != nil {
+				t.Fatal(err)
+			}
+
+			provider := &stubBatchProvider{FakeClient: ai.NewFakeClient("testdata")}
+			for _, id := range tt.returned {
+				provider.results = append(provider.results, ai.BatchResult{ID: id, Response: response})
+			}
+
+			results := make([]BatchResult, len(jobs))
+			if err := awaitAsyncBatch(context.Background(), provider, state, jobs, results, nil); err != nil {
+				t.Fatalf("awaitAsyncBatch: %v", err)
+			}
+			if results[0].Output == "" {
+				t.Errorf("result a = %+v, want a saved budget", results[0])
+			}
+
+			saved, err := loadBatchState(state.ID)
+			if len(tt.wantPending) == 0 {
+				if err == nil {
+					t.Errorf("state kept with %v, want it removed", saved.Entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("state removed, want entries %v: %v", tt.wantPending, err)
+			}
+			var pending []string
+			for _, entry := range saved.Entries {
+				pending = append(pending, entry.ID)
+			}
+			if !reflect.DeepEqual(pending, tt.wantPending) {
+				t.Errorf("pending entries = %v, want %v", pending, tt.wantPending)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/config"
+	"orgmprop/internal/ledger"
+	"orgmprop/internal/logger"
+	"orgmprop/internal/ui"
+)
+
+// Files written by a model comparison in the Oferta folder
+const (
+	ComparisonFileName      = "propuesta.comparacion.json"
+	ComparisonIndexFileName = "propuesta.comparacion.html"
+)
+
+// unsafeFileChars matches characters not allowed in variant file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ComparisonVariant is the draft of one model in a comparison
+type ComparisonVariant struct {
+	Modelo    string        `json:"modelo"`
+	Archivo   string        `json:"archivo,omitempty"`
+	Duracion  time.Duration `json:"duracion"`
+	Costo     float64       `json:"costo"`
+	ConPrecio bool          `json:"con_precio"`
+	Error     string        `json:"error,omitempty"`
+	Data      *ProposalData `json:"data,omitempty"`
+}
+
+// Comparison holds the drafts of the same proposal by several models
+type Comparison struct {
+	Titulo    string              `json:"titulo"`
+	Subtitulo string              `json:"subtitulo"`
+	Fecha     time.Time           `json:"fecha"`
+	Variantes []ComparisonVariant `json:"variantes"`
+}
+
+// CompareProposal generates the same proposal with each model concurrently,
+// writing propuesta.<model>.html for every draft plus an index page that shows
+// them side by side. Models that fail are kept in the comparison with their
+// error. onStatus is called from the model goroutines, one call at a time.
+func CompareProposal(ctx context.Context, title, subtitle, prompt string, attachments []ai.Attachment, models []string, onStatus func(string)) (*Comparison, error) {
+	models = uniqueModels(models)
+	logger.Debug("Comparando propuesta con %d modelos", len(models))
+
+	if len(models) < 2 {
+		return nil, fmt.Errorf("se requieren al menos dos modelos para comparar")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error cargando configuración: %w", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo directorio actual: %w", err)
+	}
+
+	comparison := &Comparison{
+		Titulo:    title,
+		Subtitulo: subtitle,
+		Fecha:     time.Now(),
+		Variantes: make([]ComparisonVariant, len(models)),
+	}
+
+	var statusMu sync.Mutex
+	status := func(message string) {
+		if onStatus == nil {
+			return
+		}
+		statusMu.Lock()
+		defer statusMu.Unlock()
+		onStatus(message)
+	}
+
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func(i int, model string) {
+			defer wg.Done()
+
+			status(fmt.Sprintf("Generando con %s...", model))
+
+			variant := ComparisonVariant{Modelo: model}
+			start := time.Now()
+			partial := &partialCollector{variant: variantName(model)}
+			data, htmlContent, err := generateProposal(ctx, cfg.WithModel(model), title, subtitle, prompt, attachments, partial)
+			variant.Duracion = time.Since(start)
+
+			if err != nil {
+				logger.Error("Error generando variante con %s: %v", model, err)
+				variant.Error = err.Error()
+			} else {
+				variant.Data = data
+				if data.Uso != nil {
+					variant.Costo, variant.ConPrecio = ledger.Cost(cfg, cfg.GetProvider(), model, *data.Uso)
+				}
+				variant.Archivo = variantFileName(model)
+				if err := os.WriteFile(filepath.Join(cwd, variant.Archivo), []byte(htmlContent), 0644); err != nil {
+					variant.Error = fmt.Sprintf("error guardando HTML: %v", err)
+				}
+			}
+
+			status(fmt.Sprintf("%s terminado en %s", model, variant.Duracion.Round(time.Second)))
+			comparison.Variantes[i] = variant
+		}(i, model)
+	}
+	wg.Wait()
+
+	// Assets are shared by every variant
+	if _, err := copyLogo(cwd); err != nil {
+		logger.Warn("Error copiando logo: %v", err)
+	}
+	if err := copyCSS(cwd); err != nil {
+		logger.Warn("Error copiando CSS: %v", err)
+	}
+
+	if err := saveComparison(cwd, comparison); err != nil {
+		return nil, err
+	}
+
+	return comparison, nil
+}
+
+// PromoteVariant copies the chosen draft to propuesta.html and records its
+// model in propuesta.json
+func PromoteVariant(model string) error {
+	logger.Debug("Promoviendo variante de %s", model)
+
+	comparison, err := LoadComparison()
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range comparison.Variantes {
+		if variant.Modelo != model {
+			continue
+		}
+		if variant.Error != "" || variant.Data == nil {
+			return fmt.Errorf("la variante de %s no se generó: %s", model, variant.Error)
+		}
+
+		htmlContent, err := os.ReadFile(variant.Archivo)
+		if err != nil {
+			return fmt.Errorf("error leyendo %s: %w", variant.Archivo, err)
+		}
+
+		return SaveProposal(variant.Data, string(htmlContent))
+	}
+
+	return fmt.Errorf("modelo %s no encontrado en la comparación", model)
+}
+
+// LoadComparison loads the last comparison from the current directory
+func LoadComparison() (*Comparison, error) {
+	data, err := os.ReadFile(ComparisonFileName)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", ComparisonFileName, err)
+	}
+
+	var comparison Comparison
+	if err := json.Unmarshal(data, &comparison); err != nil {
+		return nil, fmt.Errorf("error parseando %s: %w", ComparisonFileName, err)
+	}
+
+	return &comparison, nil
+}
+
+// ComparisonOptions converts the variants for ui.ShowComparisonSelector
+func (c *Comparison) ComparisonOptions() []ui.ComparisonOption {
+	options := make([]ui.ComparisonOption, len(c.Variantes))
+	for i, variant := range c.Variantes {
+		options[i] = ui.ComparisonOption{
+			Model:    variant.Modelo,
+			Duration: variant.Duracion,
+			Cost:     variant.Costo,
+			Priced:   variant.ConPrecio,
+			Error:    variant.Error,
+		}
+	}
+	return options
+}
+
+// variantFileName returns propuesta.<model>.html with a file-safe model name
+func variantFileName(model string) string {
+	return fmt.Sprintf("propuesta.%s.html", variantName(model))
+}
+
+// variantName returns the model as used in the file names of its variant
+func variantName(model string) string {
+	return unsafeFileChars.ReplaceAllString(model, "_")
+}
+
+// uniqueModels drops blank models and repeated ones, including models whose
+// variant files would share a name, keeping the first
+func uniqueModels(models []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, model := range models {
+		model = strings.TrimSpace(model)
+		if model == "" {
+			continue
+		}
+		name := variantName(model)
+		if seen[name] {
+			logger.Warn("Modelo repetido en la comparación, se omite: %s", model)
+			continue
+		}
+		seen[name] = true
+		unique = append(unique, model)
+	}
+	return unique
+}
+
+// saveComparison writes the comparison metadata and index page
+func saveComparison(dir string, comparison *Comparison) error {
+	data, err := json.MarshalIndent(comparison, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializando comparación: %w", err)
+	}
+
+	jsonPath := filepath.Join(dir, ComparisonFileName)
+	if err := os.WriteFile(jsonPath, data, 0644); err != nil {
+		return fmt.Errorf("error guardando comparación: %w", err)
+	}
+	logger.Debug("Comparación guardada en: %s", jsonPath)
+
+	indexPath := filepath.Join(dir, ComparisonIndexFileName)
+	file, err := os.Create(indexPath)
+	if err != nil {
+		return fmt.Errorf("error creando índice de comparación: %w", err)
+	}
+	defer file.Close()
+
+	if err := comparisonIndexTemplate.Execute(file, comparison); err != nil {
+		return fmt.Errorf("error generando índice de comparación: %w", err)
+	}
+	logger.Debug("Índice de comparación guardado en: %s", indexPath)
+
+	return nil
+}
+
+// comparisonIndexTemplate shows every variant side by side in iframes
+var comparisonIndexTemplate = template.Must(template.New("comparacion").Funcs(template.FuncMap{
+	"seconds": func(d time.Duration) string { return fmt.Sprintf("%.1f s", d.Seconds()) },
+}).Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<title>Comparación: {{.Titulo}}</title>
+<style>
+  body { margin: 0; font-family: sans-serif; background: #f4f6f8; }
+  header { padding: 12px 20px; background: #1f3b57; color: #fff; }
+  .variantes { display: flex; gap: 12px; padding: 12px; height: calc(100vh - 90px); }
+  .variante { flex: 1; display: flex; flex-direction: column; min-width: 0; background: #fff; border: 1px solid #d0d7de; }
+  .meta { padding: 8px 12px; border-bottom: 1px solid #d0d7de; font-size: 14px; }
+  .meta strong { display: block; }
+  .error { color: #b42318; padding: 12px; }
+  iframe { flex: 1; border: 0; width: 100%; }
+</style>
+</head>
+<body>
+<header>
+  <h1 style="margin:0;font-size:20px">{{.Titulo}}</h1>
+  <div>{{.Subtitulo}}</div>
+</header>
+<div class="variantes">
+{{range .Variantes}}
+  <div class="variante">
+    <div class="meta">
+      <strong>{{.Modelo}}</strong>
+      {{seconds .Duracion}}{{if .ConPrecio}} · US$ {{printf "%.4f" .Costo}}{{end}}{{if .Data}}{{with .Data.Uso}} · {{.InputTokens}} / {{.OutputTokens}} tokens{{end}}{{end}}
+    </div>
+    {{if .Error}}<div class="error">{{.Error}}</div>{{else}}<iframe src="{{.Archivo}}"></iframe>{{end}}
+  </div>
+{{end}}
+</div>
+</body>
+</html>
+`))
@@ -0,0 +1,50 @@
+package generator
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompareProposal(t *testing.T) {
+	useFakeProvider(t, "testdata")
+
+	// onStatus must never run twice at once
+	var inside, overlaps, calls int32
+	onStatus := func(string) {
+		if atomic.AddInt32(&inside, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&inside, -1)
+	}
+
+	models := []string{"modelo-a", "modelo-b", "modelo-a", "modelo-c"}
+	comparison, err := CompareProposal(context.Background(), "Título", "Subtítulo", "Instalación eléctrica", nil, models, onStatus)
+	if err != nil {
+		t.Fatalf("CompareProposal: %v", err)
+	}
+
+	if len(comparison.Variantes) != 3 {
+		t.Fatalf("variants = %d, want 3 without the repeated model", len(comparison.Variantes))
+	}
+	for _, variant := range comparison.Variantes {
+		if variant.Error != "" {
+			t.Errorf("variant %s failed: %s", variant.Modelo, variant.Error)
+			continue
+		}
+		if _, err := os.Stat(variant.Archivo); err != nil {
+			t.Errorf("variant %s file: %v", variant.Modelo, err)
+		}
+	}
+
+	if calls != 6 {
+		t.Errorf("onStatus calls = %d, want 6", calls)
+	}
+	if overlaps > 0 {
+		t.Errorf("onStatus ran concurrently %d times", overlaps)
+	}
+}
@@ -0,0 +1,31 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"orgmprop/internal/config"
+	"orgmprop/internal/ui"
+)
+
+// SettingRows converts settings for ui.ShowSettings
+func SettingRows(settings []config.Setting) []ui.Setting {
+	rows := make([]ui.Setting, len(settings))
+	for i, setting := range settings {
+		source := setting.Source
+		switch setting.Source {
+		case config.SourceUser, config.SourceProject:
+			source = fmt.Sprintf("%s (%s)", setting.Source, setting.Origin)
+		case config.SourceEnv:
+			source = fmt.Sprintf("%s (%s%s)", setting.Source, config.EnvPrefix, strings.ToUpper(strings.ReplaceAll(setting.Key, ".", "__")))
+		}
+		rows[i] = ui.Setting{Key: setting.Key, Value: setting.Value, Source: source}
+	}
+	return rows
+}
+
+// PromptPassphrase asks for the passphrase of credenciales.enc; it is the
+// config.PassphrasePrompt of interactive commands
+func PromptPassphrase(prompt string) (string, error) {
+	return ui.InputPassword(prompt, "")
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"orgmprop/internal/config"
+	"orgmprop/internal/logger"
+)
+
+// NotifyInterrupt returns a context that is cancelled on Ctrl+C (SIGINT) or
+// SIGTERM. The command layer passes it to GenerateProposal and
+// GeneratePresupuesto; call stop once the generation is done.
+func NotifyInterrupt(parent context.Context) (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+}
+
+// withRequestTimeout applies the configured per-request deadline to ctx
+func withRequestTimeout(ctx context.Context, cfg *config.Config) (context.Context, context.CancelFunc) {
+	timeout := cfg.RequestTimeout
+	if timeout == 0 {
+		timeout = config.DefaultRequestTimeout
+	}
+	if timeout < 0 {
+		return context.WithCancel(ctx)
+	}
+
+	logger.Debug("Límite de tiempo por solicitud: %s", timeout)
+	return context.WithTimeout(ctx, timeout)
+}
+
+// partialCollector accumulates streamed chunks so they survive a cancellation
+type partialCollector struct {
+	output     strings.Builder
+	onProgress func(string)
+	// variant goes in the partial file names, so concurrent generations of
+	// the same kind do not overwrite each other
+	variant string
+}
+
+// onChunk records a chunk and forwards it to the caller's progress callback
+func (p *partialCollector) onChunk(chunk string) {
+	p.output.WriteString(chunk)
+	if p.onProgress != nil {
+		p.onProgress(chunk)
+	}
+}
+
+// partialName returns the prefix of the partial files of a generation
+func (p *partialCollector) partialName(kind string) string {
+	if p.variant == "" {
+		return kind
+	}
+	return kind + "." + p.variant
+}
+
+// savePartial keeps the prompt and partial output of an interrupted
+// generation in the current directory (the project's Oferta folder)
+func savePartial(name, prompt, output string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error obteniendo directorio actual: %w", err)
+	}
+
+	promptPath := filepath.Join(cwd, name+"_parcial_prompt.txt")
+	if err := os.WriteFile(promptPath, []byte(prompt), 0644); err != nil {
+		return fmt.Errorf("error guardando prompt parcial: %w", err)
+	}
+	logger.Debug("Prompt de generación interrumpida guardado en: %s", promptPath)
+
+	if output == "" {
+		return nil
+	}
+
+	outputPath := filepath.Join(cwd, name+"_parcial.txt")
+	if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
+		return fmt.Errorf("error guardando salida parcial: %w", err)
+	}
+	logger.Debug("Salida parcial guardada en: %s", outputPath)
+
+	return nil
+}
+
+// handleInterrupted saves what was generated so far when ctx was cancelled
+// or timed out, and returns the error to report to the caller
+func handleInterrupted(ctx context.Context, kind, prompt string, partial *partialCollector, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+
+	name := partial.partialName(kind)
+	logger.Warn("Generación de %s interrumpida: %v", name, ctx.Err())
+	if saveErr := savePartial(name, prompt, partial.output.String()); saveErr != nil {
+		logger.Error("Error guardando generación interrumpida: %v", saveErr)
+		return fmt.Errorf("generación interrumpida: %w", ctx.Err())
+	}
+
+	return fmt.Errorf("generación interrumpida, prompt y salida parcial guardados en %s_parcial*.txt: %w", name, ctx.Err())
+}
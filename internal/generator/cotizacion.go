@@ -0,0 +1,136 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"orgmprop/assets"
+	"orgmprop/internal/config"
+	"orgmprop/internal/logger"
+	"orgmprop/internal/presupuesto"
+)
+
+// CotizacionTemplateFileName is the html/template that renders presupuesto.json
+const CotizacionTemplateFileName = "presupuesto.html.tmpl"
+
+// CotizacionFileName is the printable cotización written next to presupuesto.json
+const CotizacionFileName = "presupuesto.html"
+
+// cotizacionView is the data available to the cotización template
+type cotizacionView struct {
+	Datos      presupuesto.Datos
+	Items      []presupuesto.Item
+	Indirectos []presupuesto.Item
+	Totales    presupuesto.Totales
+	Notas      []string
+	// Logo is the file name of the logo next to the HTML, if any
+	Logo string
+}
+
+// cotizacionFuncs are the formatting functions of the cotización template
+var cotizacionFuncs = template.FuncMap{
+	"monto": presupuesto.FormatMonto,
+	"cantidad": func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	},
+	"porcentaje": func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64) + "%"
+	},
+}
+
+// RenderCotizacion renders a cotización with the template from config or
+// embedded assets. The output only depends on the document, the template and
+// the logo file name. The totals of doc are recalculated in place first, so
+// the numbers shown always add up.
+func RenderCotizacion(doc *presupuesto.Presupuesto, logo string) ([]byte, error) {
+	tmpl, err := getCotizacionTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	totales, discrepancies := doc.Recalcular()
+	if len(discrepancies) > 0 {
+		logger.Warn("%d valor(es) de presupuesto.json no cuadran; la cotización muestra los recalculados ('orgmprop presupuesto recalcular' los corrige en el archivo)", len(discrepancies))
+	}
+
+	view := cotizacionView{
+		Datos:      doc.Datos,
+		Items:      doc.Presupuesto.Presupuesto,
+		Indirectos: doc.Presupuesto.Indirectos,
+		Totales:    totales,
+		Notas:      doc.Notas.Lista(),
+		Logo:       logo,
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, view); err != nil {
+		return nil, fmt.Errorf("error generando cotización: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SaveCotizacion renders the presupuesto.json of dir, or the current
+// directory when dir is empty, into presupuesto.html, copying the logo and
+// template.css next to it. It returns the path of the HTML.
+func SaveCotizacion(dir string) (string, error) {
+	if dir == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("error obteniendo directorio actual: %w", err)
+		}
+		dir = cwd
+	}
+
+	doc, err := presupuesto.Load(filepath.Join(dir, presupuesto.FileName))
+	if err != nil {
+		return "", err
+	}
+
+	logo, err := copyLogo(dir)
+	if err != nil {
+		logger.Warn("Error copiando logo: %v", err)
+	}
+	if err := copyCSS(dir); err != nil {
+		logger.Warn("Error copiando CSS: %v", err)
+	}
+
+	html, err := RenderCotizacion(doc, logo)
+	if err != nil {
+		return "", err
+	}
+
+	htmlPath := filepath.Join(dir, CotizacionFileName)
+	if err := os.WriteFile(htmlPath, html, 0644); err != nil {
+		return "", fmt.Errorf("error guardando HTML: %w", err)
+	}
+
+	logger.Debug("Cotización guardada en: %s", htmlPath)
+	return htmlPath, nil
+}
+
+// getCotizacionTemplate parses presupuesto.html.tmpl from config or embedded assets
+func getCotizacionTemplate() (*template.Template, error) {
+	configPath := config.GetConfigFilePath(CotizacionTemplateFileName)
+	data, err := os.ReadFile(configPath)
+	source := configPath
+	if err == nil {
+		logger.Debug("Plantilla de cotización cargada desde config: %s", configPath)
+	} else {
+		data, err = assets.GetCotizacionTemplate()
+		if err != nil {
+			return nil, fmt.Errorf("error obteniendo plantilla de cotización embebida: %w", err)
+		}
+		source = CotizacionTemplateFileName + " (embebido)"
+		logger.Debug("Plantilla de cotización cargada desde assets embebidos")
+	}
+
+	tmpl, err := template.New(CotizacionTemplateFileName).Funcs(cotizacionFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error en la plantilla %s: %w", source, err)
+	}
+	return tmpl, nil
+}
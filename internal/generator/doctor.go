@@ -0,0 +1,398 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/config"
+	"orgmprop/internal/presupuesto"
+	"orgmprop/internal/project"
+	"orgmprop/internal/ui"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severities of a doctor finding
+const (
+	SeverityOK      = "ok"
+	SeverityWarning = "aviso"
+	SeverityError   = "error"
+)
+
+// pingTimeout bounds the API ping of Diagnose
+const pingTimeout = 30 * time.Second
+
+// Finding is the result of a doctor check
+type Finding struct {
+	Check    string
+	Severity string
+	Message  string
+	// Hint tells how to fix a warning or error
+	Hint string
+}
+
+// Diagnose checks the configuration, base folder, config files and, with
+// ping, the AI provider, returning a finding for every check
+func Diagnose(ctx context.Context, ping bool) []Finding {
+	var findings []Finding
+
+	cfg, err := config.Load()
+	if err != nil {
+		findings = append(findings, Finding{
+			Check:    "config.yaml",
+			Severity: SeverityError,
+			Message:  err.Error(),
+			Hint:     fmt.Sprintf("Corrige la sintaxis YAML de %s; 'orgmprop config show' indica de dónde viene cada valor", config.ConfigFile),
+		})
+		cfg = &config.Config{}
+	} else {
+		findings = append(findings, Finding{Check: "config.yaml", Severity: SeverityOK, Message: "configuración válida"})
+	}
+
+	findings = append(findings, checkUnknownKeys()...)
+	findings = append(findings, checkProvider(cfg)...)
+	findings = append(findings, checkTenant(cfg))
+	findings = append(findings, checkBaseFolder(cfg.BaseFolder))
+	findings = append(findings, checkConfigFiles()...)
+	findings = append(findings, checkTemplateYAML("propuesta.yaml"), checkTemplateYAML("html_template.yaml"))
+	findings = append(findings, checkPresupuestoYAML()...)
+	findings = append(findings, checkCotizacionTemplate())
+	findings = append(findings, checkLogo())
+	findings = append(findings, checkFolderJSON())
+
+	if ping {
+		findings = append(findings, pingProvider(ctx, cfg))
+	}
+
+	return findings
+}
+
+// checkUnknownKeys reports settings that Config does not define, usually typos
+func checkUnknownKeys() []Finding {
+	unknown, err := config.UnknownKeys()
+	if err != nil {
+		return nil
+	}
+
+	findings := make([]Finding, len(unknown))
+	for i, key := range unknown {
+		findings[i] = Finding{
+			Check:    "config.yaml",
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("opción desconocida '%s' en %s; se ignora", key.Key, key.Origin),
+			Hint:     "Revisa si está mal escrita; 'orgmprop config show' lista las opciones válidas",
+		}
+	}
+	return findings
+}
+
+// checkProvider checks the provider, model and credentials
+func checkProvider(cfg *config.Config) []Finding {
+	provider := cfg.GetProvider()
+	check := "proveedor"
+
+	switch provider {
+	case config.ProviderAnthropic:
+		// Only probe where the key is: doctor never runs api_key_command or
+		// asks for the passphrase of credenciales.enc
+		if _, err := cfg.APIKeySource(); err != nil {
+			return []Finding{{
+				Check:    "api key",
+				Severity: SeverityError,
+				Message:  err.Error(),
+				Hint:     "Ejecuta 'orgmprop config apikey' o define ORGMPROP_ANTHROPIC_API_KEY",
+			}}
+		}
+	case config.ProviderOpenAI:
+		if cfg.OpenAIModel == "" {
+			return []Finding{{
+				Check:    check,
+				Severity: SeverityError,
+				Message:  "modelo OpenAI no configurado",
+				Hint:     "Define 'openai_model' en config.yaml",
+			}}
+		}
+	case config.ProviderFake:
+	default:
+		return []Finding{{
+			Check:    check,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("proveedor de IA desconocido: %s", provider),
+			Hint:     fmt.Sprintf("Ejecuta 'orgmprop config provider' (disponibles: %s)", strings.Join(config.AvailableProviders(), ", ")),
+		}}
+	}
+
+	model := cfg.ActiveModel()
+	if provider == config.ProviderAnthropic && model != "" {
+		if _, ok := config.LookupModel(provider, model); !ok {
+			return []Finding{{
+				Check:    "modelo",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("el modelo %s no está en el catálogo", model),
+				Hint:     "Ejecuta 'orgmprop config model' para elegir un modelo disponible",
+			}}
+		}
+	}
+
+	return []Finding{{Check: check, Severity: SeverityOK, Message: fmt.Sprintf("%s listo", provider)}}
+}
+
+// checkTenant checks that the selected tenant exists
+func checkTenant(cfg *config.Config) Finding {
+	name, _ := cfg.ActiveTenant()
+	if cfg.Tenant != "" && cfg.Tenant != name {
+		return Finding{
+			Check:    "empresa",
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("la empresa %q no existe, se usa %q", cfg.Tenant, name),
+			Hint:     "Ejecuta 'orgmprop config tenant' para seleccionarla o crearla",
+		}
+	}
+	return Finding{Check: "empresa", Severity: SeverityOK, Message: name}
+}
+
+// checkBaseFolder checks that the base folder exists and is writable
+func checkBaseFolder(baseFolder string) Finding {
+	check := "carpeta base"
+	hint := "Ejecuta 'orgmprop config folder'"
+
+	if baseFolder == "" {
+		return Finding{Check: check, Severity: SeverityError, Message: "carpeta base no configurada", Hint: hint}
+	}
+
+	info, err := os.Stat(baseFolder)
+	if os.IsNotExist(err) {
+		return Finding{
+			Check:    check,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("%s no existe", baseFolder),
+			Hint:     fmt.Sprintf("Crea la carpeta con 'mkdir -p %s' o elige otra con 'orgmprop config folder'", baseFolder),
+		}
+	}
+	if err != nil {
+		return Finding{Check: check, Severity: SeverityError, Message: err.Error(), Hint: hint}
+	}
+	if !info.IsDir() {
+		return Finding{Check: check, Severity: SeverityError, Message: fmt.Sprintf("%s no es una carpeta", baseFolder), Hint: hint}
+	}
+
+	probe, err := os.CreateTemp(baseFolder, ".orgmprop-doctor-")
+	if err != nil {
+		return Finding{
+			Check:    check,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("%s no tiene permisos de escritura", baseFolder),
+			Hint:     fmt.Sprintf("Revisa los permisos con 'ls -ld %s'", baseFolder),
+		}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	return Finding{Check: check, Severity: SeverityOK, Message: baseFolder}
+}
+
+// checkConfigFiles reports the config files replaced by embedded defaults
+func checkConfigFiles() []Finding {
+	missing := config.ListMissingConfigFiles()
+	if len(missing) == 0 {
+		return []Finding{{Check: "archivos", Severity: SeverityOK, Message: "todos los archivos de configuración existen"}}
+	}
+
+	findings := make([]Finding, len(missing))
+	for i, file := range missing {
+		findings[i] = Finding{
+			Check:    file,
+			Severity: SeverityWarning,
+			Message:  "no existe, se usa el original embebido",
+			Hint:     fmt.Sprintf("Ejecuta 'orgmprop templates sync' u 'orgmprop config reset %s'", file),
+		}
+	}
+	return findings
+}
+
+// checkTemplateYAML checks that a user YAML template parses
+func checkTemplateYAML(file string) Finding {
+	data, err := os.ReadFile(config.GetConfigFilePath(file))
+	if err != nil {
+		return Finding{Check: file, Severity: SeverityOK, Message: "se usa el original embebido"}
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return Finding{
+			Check:    file,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("YAML inválido: %v", err),
+			Hint:     fmt.Sprintf("Corrige el archivo o restablécelo con 'orgmprop config reset %s'", file),
+		}
+	}
+
+	return Finding{Check: file, Severity: SeverityOK, Message: "YAML válido"}
+}
+
+// checkPresupuestoYAML checks presupuesto.yaml and its example
+func checkPresupuestoYAML() []Finding {
+	file := "presupuesto.yaml"
+	resetHint := fmt.Sprintf("Corrige el archivo o restablécelo con 'orgmprop config reset %s'", file)
+
+	data, err := getPresupuestoYAML()
+	if err != nil {
+		return []Finding{{Check: file, Severity: SeverityError, Message: err.Error(), Hint: resetHint}}
+	}
+
+	presupuestoYAML, ejemploJSON, err := parsePresupuestoYAML(data)
+	if err != nil {
+		return []Finding{{Check: file, Severity: SeverityError, Message: err.Error(), Hint: resetHint}}
+	}
+
+	var findings []Finding
+	if strings.TrimSpace(presupuestoYAML.System) == "" {
+		findings = append(findings, Finding{Check: file, Severity: SeverityError, Message: "falta el campo 'system'", Hint: resetHint})
+	}
+	if !strings.Contains(presupuestoYAML.UserTemplate, "{descripcion_proyecto}") {
+		findings = append(findings, Finding{
+			Check:    file,
+			Severity: SeverityWarning,
+			Message:  "'user_template' no contiene {descripcion_proyecto}; la descripción no se enviará",
+			Hint:     "Agrega {descripcion_proyecto} a 'user_template'",
+		})
+	}
+
+	// The example is what the model imitates, so it should match the
+	// cotización format and add up
+	if doc, problems, err := presupuesto.Parse([]byte(ejemploJSON)); err != nil {
+		findings = append(findings, Finding{
+			Check:    file,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("el ejemplo no se puede leer como cotización: %v", err),
+			Hint:     fmt.Sprintf("Corrige el ejemplo (campo ejemplo o %s)", PresupuestoExampleFileName),
+		})
+	} else {
+		for _, problem := range problems {
+			findings = append(findings, Finding{
+				Check:    file,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("el ejemplo no sigue el formato de cotización: %s", problem),
+				Hint:     fmt.Sprintf("Corrige el ejemplo (campo ejemplo o %s)", PresupuestoExampleFileName),
+			})
+		}
+		if discrepancies := doc.Discrepancias(); len(discrepancies) > 0 {
+			findings = append(findings, Finding{
+				Check:    file,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("los totales del ejemplo no cuadran (%d valores, por ejemplo %s); el modelo copiará el error", len(discrepancies), discrepancies[0]),
+				Hint:     "Corrige los totales del ejemplo: cada línea es precio × cantidad sin ITBIS y un ítem suma sus children",
+			})
+		}
+	}
+
+	if len(findings) == 0 {
+		findings = append(findings, Finding{Check: file, Severity: SeverityOK, Message: "YAML y ejemplo válidos"})
+	}
+	return findings
+}
+
+// checkCotizacionTemplate checks that the cotización HTML template parses
+func checkCotizacionTemplate() Finding {
+	if _, err := getCotizacionTemplate(); err != nil {
+		return Finding{
+			Check:    CotizacionTemplateFileName,
+			Severity: SeverityError,
+			Message:  err.Error(),
+			Hint:     fmt.Sprintf("Corrige la plantilla o restablécela con 'orgmprop config reset %s'", CotizacionTemplateFileName),
+		}
+	}
+	return Finding{Check: CotizacionTemplateFileName, Severity: SeverityOK, Message: "plantilla válida"}
+}
+
+// checkLogo warns when logo.png silently takes precedence over logo.svg
+func checkLogo() Finding {
+	_, svgErr := os.Stat(config.GetConfigFilePath("logo.svg"))
+	_, pngErr := os.Stat(config.GetConfigFilePath("logo.png"))
+	if svgErr == nil && pngErr == nil {
+		return Finding{
+			Check:    "logo",
+			Severity: SeverityWarning,
+			Message:  "existen logo.png y logo.svg; las propuestas usan logo.png",
+			Hint:     fmt.Sprintf("Elimina %s para usar logo.svg", config.GetConfigFilePath("logo.png")),
+		}
+	}
+	if pngErr == nil {
+		return Finding{Check: "logo", Severity: SeverityOK, Message: "logo.png"}
+	}
+	return Finding{Check: "logo", Severity: SeverityOK, Message: "logo.svg"}
+}
+
+// checkFolderJSON validates folder.json against project.FolderStructure
+func checkFolderJSON() Finding {
+	path := config.GetConfigFilePath("folder.json")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Finding{Check: "folder.json", Severity: SeverityOK, Message: "no existe, se usa la estructura por defecto"}
+	}
+	if err != nil {
+		return Finding{Check: "folder.json", Severity: SeverityError, Message: err.Error(), Hint: fmt.Sprintf("Revisa los permisos de %s", path)}
+	}
+
+	if err := project.ValidateFolderStructure(data); err != nil {
+		return Finding{
+			Check:    "folder.json",
+			Severity: SeverityError,
+			Message:  err.Error(),
+			Hint:     `Usa el formato {"tipos": {"Proyectos": {"carpetas": [..., "Oferta"]}}}`,
+		}
+	}
+
+	return Finding{Check: "folder.json", Severity: SeverityOK, Message: "estructura válida"}
+}
+
+// pingProvider lists the provider's models, which costs no tokens, and
+// checks that the active model is available. The model cache is left as is
+// and the API key is not prompted for.
+func pingProvider(ctx context.Context, cfg *config.Config) Finding {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	models, err := ai.ListModels(ctx, cfg)
+	if err != nil {
+		return Finding{
+			Check:    "api",
+			Severity: SeverityError,
+			Message:  err.Error(),
+			Hint:     "Revisa la conexión y la API key ('orgmprop config apikey')",
+		}
+	}
+
+	model := cfg.ActiveModel()
+	catalog := &config.ModelCatalog{Provider: cfg.GetProvider(), Models: models}
+	if model != "" && cfg.GetProvider() != config.ProviderFake {
+		if _, ok := catalog.Lookup(model); !ok {
+			return Finding{
+				Check:    "api",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("la API responde, pero el modelo %s no está disponible", model),
+				Hint:     "Ejecuta 'orgmprop config model'",
+			}
+		}
+	}
+
+	return Finding{Check: "api", Severity: SeverityOK, Message: fmt.Sprintf("%s responde (%d modelos)", cfg.GetProvider(), len(models))}
+}
+
+// FindingRows converts findings for ui.ShowFindings
+func FindingRows(findings []Finding) []ui.Finding {
+	rows := make([]ui.Finding, len(findings))
+	for i, finding := range findings {
+		rows[i] = ui.Finding{
+			Check:   finding.Check,
+			Level:   finding.Severity,
+			Message: finding.Message,
+			Hint:    finding.Hint,
+		}
+	}
+	return rows
+}
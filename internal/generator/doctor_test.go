@@ -0,0 +1,70 @@
+package generator
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"orgmprop/assets"
+	"orgmprop/internal/config"
+)
+
+func TestCheckPresupuestoYAMLExample(t *testing.T) {
+	embedded, err := assets.GetPresupuestoExample()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		example     string
+		want        string
+		wantMessage string
+	}{
+		{name: "ejemplo embebido", want: SeverityOK},
+		{name: "ejemplo que no es objeto", example: "[]", want: SeverityError, wantMessage: "no se puede leer como cotización"},
+		{
+			name:        "ejemplo con campo desconocido",
+			example:     strings.Replace(string(embedded), `"datos": {`, `"datos": {"extra": 1,`, 1),
+			want:        SeverityWarning,
+			wantMessage: "datos.extra: campo desconocido",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeProvider(t, "testdata")
+			if tt.example != "" {
+				if err := os.WriteFile(config.GetConfigFilePath(PresupuestoExampleFileName), []byte(tt.example), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			findings := checkPresupuestoYAML()
+			if len(findings) != 1 {
+				t.Fatalf("findings = %+v, want one", findings)
+			}
+			if findings[0].Severity != tt.want || !strings.Contains(findings[0].Message, tt.wantMessage) {
+				t.Errorf("finding = %+v, want %s containing %q", findings[0], tt.want, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestPingProviderLeavesCache(t *testing.T) {
+	useFakeProvider(t, "testdata")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finding := pingProvider(context.Background(), cfg)
+	if finding.Severity != SeverityOK {
+		t.Errorf("finding = %+v, want %s", finding, SeverityOK)
+	}
+	if _, err := os.Stat(config.ModelCatalogFilePath(config.ProviderFake)); !os.IsNotExist(err) {
+		t.Errorf("pingProvider wrote the model cache (stat error %v)", err)
+	}
+}
@@ -75,90 +75,79 @@ type ProposalData struct {
 	Prompt    string    `json:"prompt"`
 	Modelo    string    `json:"modelo"`
 	Fecha     time.Time `json:"fecha"`
+	Uso       *ai.Usage `json:"uso,omitempty"`
+	Adjuntos  []string  `json:"adjuntos,omitempty"`
 }
 
-// GenerateProposal generates a complete proposal
-func GenerateProposal(title, subtitle, prompt string, onProgress func(string)) (*ProposalData, string, error) {
+// GenerateProposal generates a complete proposal, grounded in the attached
+// client files. Cancelling ctx stops the generation and keeps the prompt and
+// partial output in the current directory.
+func GenerateProposal(ctx context.Context, title, subtitle, prompt string, attachments []ai.Attachment, onProgress func(string)) (*ProposalData, string, error) {
 	logger.Debug("Iniciando generación de propuesta: %s", title)
 
-	// Get API key
-	apiKey, err := config.GetAPIKey()
+	cfg, err := config.Load()
 	if err != nil {
-		return nil, "", fmt.Errorf("error obteniendo API key: %w", err)
+		return nil, "", fmt.Errorf("error cargando configuración: %w", err)
 	}
 
-	// Get model
-	model, err := config.GetModel()
-	if err != nil {
-		logger.Warn("Error obteniendo modelo, usando default: %v", err)
-		model = config.DefaultModel
-	}
+	return generateProposal(ctx, cfg, title, subtitle, prompt, attachments, &partialCollector{onProgress: onProgress})
+}
 
-	// Get prompt instructions
-	promptInstructions, err := getPromptInstructions()
+// generateProposal generates a proposal with the provider and model of cfg,
+// streaming into partial when it has a progress callback
+func generateProposal(ctx context.Context, cfg *config.Config, title, subtitle, prompt string, attachments []ai.Attachment, partial *partialCollector) (*ProposalData, string, error) {
+	// Create AI provider
+	provider, err := newProvider(cfg)
 	if err != nil {
-		return nil, "", fmt.Errorf("error obteniendo instrucciones de prompt: %w", err)
+		return nil, "", err
 	}
 
-	// Get HTML template instructions
-	htmlInstructions, err := getHTMLInstructions()
+	// Build prompts
+	systemPrompt, err := proposalSystemPrompt(cfg)
 	if err != nil {
-		return nil, "", fmt.Errorf("error obteniendo instrucciones HTML: %w", err)
+		return nil, "", err
 	}
+	userPrompt := proposalUserPrompt(title, subtitle, prompt)
 
-	// Build system prompt
-	systemPrompt := fmt.Sprintf(`%s
-
----
-
-%s
-
----
-
-IMPORTANTE: 
-- Genera el HTML completo directamente desde el prompt del usuario.
-- Usa el contenido generado según las reglas de prompt/propuesta.yaml.
-- Formatea ese contenido en HTML usando la estructura de html/propuesta.yaml.
-- NO incluyas CSS embebido ni etiquetas <style>. Usa un <link rel="stylesheet" href="template.css">.
-- El HTML debe ser completo y listo para usar.
-- NO uses markdown, solo HTML puro.
-- NO incluyas bloques de código markdown.
-- Asume que los assets (template.css, logo.svg/png) estarán en el mismo directorio que el HTML generado.`, promptInstructions, htmlInstructions)
-
-	// Build user prompt
-	userPrompt := fmt.Sprintf(`Título: %s
-Subtítulo: %s
+	req := newRequest(cfg, ai.KindPropuesta, systemPrompt, userPrompt)
+	req.Attachments = attachments
 
-Prompt del usuario:
-%s`, title, subtitle, prompt)
-
-	// Create AI client
-	client := ai.NewClient(apiKey, model)
+	ctx, cancel := withRequestTimeout(ctx, cfg)
+	defer cancel()
 
 	// Generate HTML
 	logger.Debug("Generando HTML con IA...")
-	var htmlContent string
-	if onProgress != nil {
-		htmlContent, err = client.GenerateProposalStream(context.Background(), systemPrompt, userPrompt, onProgress)
+	var resp *ai.Response
+	if partial.onProgress != nil {
+		resp, err = provider.GenerateStream(ctx, req, partial.onChunk)
 	} else {
-		htmlContent, err = client.GenerateProposal(context.Background(), systemPrompt, userPrompt)
+		resp, err = provider.Generate(ctx, req)
 	}
 
 	if err != nil {
+		recordFailedUsage(ai.KindPropuesta, cfg.GetProvider(), provider.Model(), err)
+		err = handleInterrupted(ctx, ai.KindPropuesta, userPrompt, partial, err)
 		return nil, "", fmt.Errorf("error generando HTML: %w", err)
 	}
 
+	recordUsage(ai.KindPropuesta, cfg.GetProvider(), provider.Model(), resp.Usage)
+	if resp.StopReason == "max_tokens" {
+		logger.Warn("La respuesta sigue truncada por max_tokens; aumenta max_tokens.propuesta o max_continuations")
+	}
+
 	// Create proposal data
 	proposalData := &ProposalData{
 		Titulo:    title,
 		Subtitulo: subtitle,
 		Prompt:    prompt,
-		Modelo:    model,
+		Modelo:    provider.Model(),
 		Fecha:     time.Now(),
+		Uso:       &resp.Usage,
+		Adjuntos:  attachmentNames(attachments),
 	}
 
 	logger.Debug("Propuesta generada exitosamente")
-	return proposalData, htmlContent, nil
+	return proposalData, resp.Text, nil
 }
 
 // SaveProposal saves the proposal data and HTML to the current directory
@@ -191,7 +180,7 @@ func SaveProposal(data *ProposalData, htmlContent string) error {
 	logger.Debug("HTML guardado en: %s", htmlPath)
 
 	// Copy logo
-	if err := copyLogo(cwd); err != nil {
+	if _, err := copyLogo(cwd); err != nil {
 		logger.Warn("Error copiando logo: %v", err)
 	}
 
@@ -224,9 +213,14 @@ func LoadProposal() (*ProposalData, error) {
 	return &proposal, nil
 }
 
-// RegenerateProposal regenerates an existing proposal
-func RegenerateProposal(data *ProposalData, onProgress func(string)) (string, error) {
-	_, htmlContent, err := GenerateProposal(data.Titulo, data.Subtitulo, data.Prompt, onProgress)
+// RegenerateProposal regenerates an existing proposal with the same attachments
+func RegenerateProposal(ctx context.Context, data *ProposalData, onProgress func(string)) (string, error) {
+	attachments, err := LoadAttachments(data.Adjuntos)
+	if err != nil {
+		return "", err
+	}
+
+	_, htmlContent, err := GenerateProposal(ctx, data.Titulo, data.Subtitulo, data.Prompt, attachments, onProgress)
 	if err != nil {
 		return "", err
 	}
@@ -234,6 +228,92 @@ func RegenerateProposal(data *ProposalData, onProgress func(string)) (string, er
 	return htmlContent, nil
 }
 
+// newProvider creates the AI provider selected in the configuration
+func newProvider(cfg *config.Config) (ai.Provider, error) {
+	// The passphrase of credenciales.enc, if any, is asked for here and not
+	// once the generation is running
+	if cfg.GetProvider() == config.ProviderAnthropic {
+		if err := cfg.UnlockAPIKey(PromptPassphrase); err != nil {
+			return nil, fmt.Errorf("error obteniendo API key: %w", err)
+		}
+	}
+
+	provider, err := ai.NewProvider(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creando proveedor de IA: %w", err)
+	}
+
+	return provider, nil
+}
+
+// newRequest builds a generation request with the configured token limits
+func newRequest(cfg *config.Config, kind, systemPrompt, userPrompt string) ai.Request {
+	req := ai.Request{
+		Kind:             kind,
+		SystemPrompt:     systemPrompt,
+		UserPrompt:       userPrompt,
+		MaxTokens:        cfg.MaxTokensFor(kind),
+		MaxOutputTokens:  cfg.ModelMaxOutputTokens(),
+		MaxContinuations: cfg.GetMaxContinuations(),
+	}
+
+	// Rough estimate of 4 characters per token, only used to warn early
+	if info, ok := config.LookupModel(cfg.GetProvider(), cfg.ActiveModel()); ok && info.ContextWindow > 0 {
+		estimated := int64(len(systemPrompt)+len(userPrompt))/4 + req.MaxTokens
+		if estimated > info.ContextWindow {
+			logger.Warn("La solicitud (~%d tokens) podría exceder la ventana de contexto de %s (%d tokens)", estimated, info.ID, info.ContextWindow)
+		}
+	}
+
+	return req
+}
+
+// proposalSystemPrompt builds the system prompt from propuesta.yaml,
+// html_template.yaml and the active tenant
+func proposalSystemPrompt(cfg *config.Config) (string, error) {
+	// Get prompt instructions
+	promptInstructions, err := getPromptInstructions()
+	if err != nil {
+		return "", fmt.Errorf("error obteniendo instrucciones de prompt: %w", err)
+	}
+
+	// Get HTML template instructions
+	htmlInstructions, err := getHTMLInstructions()
+	if err != nil {
+		return "", fmt.Errorf("error obteniendo instrucciones HTML: %w", err)
+	}
+
+	_, tenant := cfg.ActiveTenant()
+
+	// Build system prompt
+	return fmt.Sprintf(`%s
+
+---
+
+%s
+
+---
+
+IMPORTANTE: 
+- Genera el HTML completo directamente desde el prompt del usuario.
+- Usa el contenido generado según las reglas de prompt/propuesta.yaml.
+- Formatea ese contenido en HTML usando la estructura de html/propuesta.yaml.
+- NO incluyas CSS embebido ni etiquetas <style>. Usa un <link rel="stylesheet" href="template.css">.
+- El HTML debe ser completo y listo para usar.
+- NO uses markdown, solo HTML puro.
+- NO incluyas bloques de código markdown.
+- Asume que los assets (template.css, logo.svg/png) estarán en el mismo directorio que el HTML generado.`, promptInstructions, htmlInstructions) + proposalTenantPrompt(tenant), nil
+}
+
+// proposalUserPrompt builds the user prompt of a new proposal
+func proposalUserPrompt(title, subtitle, prompt string) string {
+	return fmt.Sprintf(`Título: %s
+Subtítulo: %s
+
+Prompt del usuario:
+%s`, title, subtitle, prompt)
+}
+
 // getPromptInstructions returns the prompt instructions from config or embedded assets
 func getPromptInstructions() (string, error) {
 	// First try to load from config directory
@@ -272,8 +352,8 @@ func getHTMLInstructions() (string, error) {
 	return string(data), nil
 }
 
-// copyLogo copies the logo to the target directory
-func copyLogo(targetDir string) error {
+// copyLogo copies the logo to the target directory, returning its file name
+func copyLogo(targetDir string) (string, error) {
 	// First try to load from config directory
 	configPath := config.GetConfigFilePath("logo.svg")
 	var logoData []byte
@@ -286,7 +366,7 @@ func copyLogo(targetDir string) error {
 		// Fall back to embedded assets
 		logoData, err = assets.GetLogo()
 		if err != nil {
-			return fmt.Errorf("error obteniendo logo embebido: %w", err)
+			return "", fmt.Errorf("error obteniendo logo embebido: %w", err)
 		}
 		logger.Debug("Logo cargado desde assets embebidos")
 	}
@@ -302,11 +382,11 @@ func copyLogo(targetDir string) error {
 	// Save logo to target directory
 	targetPath := filepath.Join(targetDir, "logo"+logoExt)
 	if err := os.WriteFile(targetPath, logoData, 0644); err != nil {
-		return fmt.Errorf("error guardando logo: %w", err)
+		return "", fmt.Errorf("error guardando logo: %w", err)
 	}
 
 	logger.Debug("Logo guardado en: %s", targetPath)
-	return nil
+	return filepath.Base(targetPath), nil
 }
 
 // copyCSS copies the CSS to the target directory
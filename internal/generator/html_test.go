@@ -0,0 +1,126 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/config"
+	"orgmprop/internal/ledger"
+)
+
+// useFakeProvider points the configuration at a temporary directory with the
+// fake provider reading fixturesDir, and runs the test from an empty
+// working directory
+func useFakeProvider(t *testing.T, fixturesDir string) {
+	t.Helper()
+
+	fixturesDir, err := filepath.Abs(fixturesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousDir, previousFile := config.ConfigDir, config.ConfigFile
+	config.SetConfigDir(t.TempDir())
+	t.Setenv(config.EnvPrefix+"PROVIDER", config.ProviderFake)
+	t.Setenv(config.EnvPrefix+"FAKE_FIXTURES_DIR", fixturesDir)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		config.ConfigDir, config.ConfigFile = previousDir, previousFile
+		os.Chdir(cwd)
+	})
+}
+
+// writeFixtures creates a fixtures directory holding the given files
+func writeFixtures(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGenerateProposal(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixtures string
+		stream   bool
+		cancel   bool
+		wantErr  error
+		wantHTML string
+	}{
+		{name: "sin streaming", fixtures: "testdata", wantHTML: "<h1>Propuesta de prueba</h1>"},
+		{name: "con streaming", fixtures: "testdata", stream: true, wantHTML: "<h1>Propuesta de prueba</h1>"},
+		{name: "sin fixture", wantErr: errors.New("fixture no encontrado")},
+		{name: "cancelada", fixtures: "testdata", stream: true, cancel: true, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixtures := tt.fixtures
+			if fixtures == "" {
+				fixtures = writeFixtures(t, nil)
+			}
+			useFakeProvider(t, fixtures)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			var chunks []string
+			var onProgress func(string)
+			if tt.stream {
+				onProgress = func(chunk string) { chunks = append(chunks, chunk) }
+			}
+
+			data, html, err := GenerateProposal(ctx, "Título", "Subtítulo", "Instalación eléctrica", nil, onProgress)
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("GenerateProposal succeeded, want error %v", tt.wantErr)
+				}
+				if !errors.Is(err, tt.wantErr) && !strings.Contains(err.Error(), tt.wantErr.Error()) {
+					t.Fatalf("GenerateProposal error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateProposal: %v", err)
+			}
+
+			if strings.Contains(html, "```") || !strings.Contains(html, tt.wantHTML) {
+				t.Errorf("html = %q, want it to contain %q without code fences", html, tt.wantHTML)
+			}
+			if data.Titulo != "Título" || data.Modelo != ai.FakeModel || data.Uso == nil {
+				t.Errorf("data = %+v, want title, fake model and usage", data)
+			}
+			if tt.stream && len(chunks) == 0 {
+				t.Error("onProgress was never called")
+			}
+
+			entries, err := ledger.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Tipo != ai.KindPropuesta || entries[0].Proveedor != config.ProviderFake {
+				t.Errorf("ledger = %+v, want one propuesta entry of the fake provider", entries)
+			}
+		})
+	}
+}
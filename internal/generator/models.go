@@ -0,0 +1,25 @@
+package generator
+
+import (
+	"orgmprop/internal/config"
+	"orgmprop/internal/ui"
+)
+
+// ModelOptions converts a catalog into the options of ui.ShowModelSelector
+func ModelOptions(catalog *config.ModelCatalog) []ui.ModelOption {
+	options := make([]ui.ModelOption, len(catalog.Models))
+	for i, model := range catalog.Models {
+		options[i] = ui.ModelOption{
+			ID:              model.ID,
+			DisplayName:     model.DisplayName,
+			ContextWindow:   model.ContextWindow,
+			MaxOutputTokens: model.MaxOutputTokens,
+		}
+		if model.Price != nil {
+			options[i].InputPrice = model.Price.Input
+			options[i].OutputPrice = model.Price.Output
+			options[i].Priced = true
+		}
+	}
+	return options
+}
@@ -3,9 +3,11 @@ package generator
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -13,6 +15,8 @@ import (
 	"orgmprop/internal/ai"
 	"orgmprop/internal/config"
 	"orgmprop/internal/logger"
+	"orgmprop/internal/presupuesto"
+	"orgmprop/internal/ui"
 
 	"gopkg.in/yaml.v3"
 )
@@ -36,81 +40,224 @@ type PresupuestoYAML struct {
 		} `yaml:"schema"`
 	} `yaml:"output_format"`
 	NotasTecnicas string `yaml:"notas_tecnicas"`
+	// Ejemplo is the JSON5 example; empty uses presupuesto.example.json
+	Ejemplo string `yaml:"ejemplo"`
 }
 
-// GeneratePresupuesto generates a budget JSON using the presupuesto.yaml prompt
-func GeneratePresupuesto(descripcionProyecto string, onProgress func(string)) ([]byte, error) {
+// PresupuestoExampleFileName holds the example cotización when presupuesto.yaml
+// has no ejemplo field
+const PresupuestoExampleFileName = "presupuesto.example.json"
+
+// PresupuestoRawFileName holds the unprocessed model response, saved next to
+// presupuesto.json on every generation
+const PresupuestoRawFileName = "presupuesto.raw.txt"
+
+// PresupuestoUsage is the token usage sidecar stored next to presupuesto.json
+type PresupuestoUsage struct {
+	Modelo string    `json:"modelo"`
+	Fecha  time.Time `json:"fecha"`
+	Uso    ai.Usage  `json:"uso"`
+	// Adjuntos lists the Recibido files sent with the description
+	Adjuntos []string `json:"adjuntos,omitempty"`
+	// Reparaciones lists the fixes applied to the JSON of the response
+	Reparaciones []string `json:"reparaciones,omitempty"`
+}
+
+// GeneratePresupuesto generates a budget JSON using the presupuesto.yaml prompt,
+// grounded in the attached client files. Cancelling ctx stops the generation
+// and keeps the prompt and partial output in the current directory.
+func GeneratePresupuesto(ctx context.Context, descripcionProyecto string, attachments []ai.Attachment, onProgress func(string)) ([]byte, *PresupuestoUsage, error) {
 	logger.Debug("Iniciando generación de presupuesto")
 
-	// Get API key
-	apiKey, err := config.GetAPIKey()
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error cargando configuración: %w", err)
+	}
+
+	// Create AI provider
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := newPresupuestoRequest(cfg, descripcionProyecto, attachments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := withRequestTimeout(ctx, cfg)
+	defer cancel()
+
+	// Generate JSON
+	logger.Debug("Generando JSON con IA...")
+	var resp *ai.Response
+	partial := &partialCollector{onProgress: onProgress}
+	if onProgress != nil {
+		resp, err = provider.GenerateStream(ctx, req, partial.onChunk)
+	} else {
+		resp, err = provider.Generate(ctx, req)
+	}
+
 	if err != nil {
-		return nil, fmt.Errorf("error obteniendo API key: %w", err)
+		// A rejected tool call was still billed, and its output is kept
+		recordFailedUsage(ai.KindPresupuesto, cfg.GetProvider(), provider.Model(), err)
+		if raw, ok := ai.RawOf(err); ok {
+			saveRawInCurrentDir(raw)
+			err = fmt.Errorf("%w (respuesta completa en %s)", err, PresupuestoRawFileName)
+		}
+		err = handleInterrupted(ctx, ai.KindPresupuesto, descripcionProyecto, partial, err)
+		return nil, nil, fmt.Errorf("error generando JSON: %w", err)
+	}
+
+	recordUsage(ai.KindPresupuesto, cfg.GetProvider(), provider.Model(), resp.Usage)
+	if resp.StopReason == "max_tokens" {
+		logger.Warn("La respuesta sigue truncada por max_tokens; aumenta max_tokens.presupuesto o max_continuations")
 	}
 
-	// Get model
-	model, err := config.GetModel()
+	saveRawInCurrentDir(rawOutput(resp))
+
+	_, tenant := cfg.ActiveTenant()
+	formattedJSON, repairs, err := formatPresupuestoResponse(resp, tenant)
 	if err != nil {
-		logger.Warn("Error obteniendo modelo, usando default: %v", err)
-		model = config.DefaultModel
+		return nil, nil, err
+	}
+
+	usage := &PresupuestoUsage{
+		Modelo:       provider.Model(),
+		Fecha:        time.Now(),
+		Uso:          resp.Usage,
+		Adjuntos:     attachmentNames(attachments),
+		Reparaciones: repairs,
 	}
 
+	logger.Debug("Presupuesto generado exitosamente")
+	return formattedJSON, usage, nil
+}
+
+// newPresupuestoRequest builds the generation request for a project description
+func newPresupuestoRequest(cfg *config.Config, descripcionProyecto string, attachments []ai.Attachment) (ai.Request, error) {
 	// Load presupuesto YAML
 	yamlData, err := getPresupuestoYAML()
 	if err != nil {
-		return nil, fmt.Errorf("error obteniendo presupuesto YAML: %w", err)
+		return ai.Request{}, fmt.Errorf("error obteniendo presupuesto YAML: %w", err)
 	}
 
 	// Parse YAML and extract JSON example
-	systemPrompt, userTemplate, ejemploJSON, err := parsePresupuestoYAML(yamlData)
+	presupuestoYAML, ejemploJSON, err := parsePresupuestoYAML(yamlData)
 	if err != nil {
-		return nil, fmt.Errorf("error parseando presupuesto YAML: %w", err)
+		return ai.Request{}, fmt.Errorf("error parseando presupuesto YAML: %w", err)
 	}
-
-	// Build user prompt by replacing variables
+	_, tenant := cfg.ActiveTenant()
+	systemPrompt := presupuestoYAML.System + presupuestoTenantPrompt(tenant)
+
+	// Build user prompt by replacing variables. The part before the project
+	// description (with the example) is the same on every request, so it is
+	// sent as a cached prefix.
+	cachedPrefix, userTemplate := splitUserTemplate(presupuestoYAML.UserTemplate)
+	cachedPrefix = strings.ReplaceAll(cachedPrefix, "{ejemplo_json}", ejemploJSON)
 	userPrompt := strings.ReplaceAll(userTemplate, "{descripcion_proyecto}", descripcionProyecto)
 	userPrompt = strings.ReplaceAll(userPrompt, "{ejemplo_json}", ejemploJSON)
 
 	logger.Debug("System prompt length: %d", len(systemPrompt))
+	logger.Debug("Cached prefix length: %d", len(cachedPrefix))
 	logger.Debug("User prompt length: %d", len(userPrompt))
 
-	// Create AI client
-	client := ai.NewClient(apiKey, model)
+	req := newRequest(cfg, ai.KindPresupuesto, systemPrompt, userPrompt)
+	req.CachedPrefix = cachedPrefix
+	req.Attachments = attachments
+	req.Tool = presupuestoYAML.tool()
 
-	// Generate JSON
-	logger.Debug("Generando JSON con IA...")
-	var jsonContent string
-	if onProgress != nil {
-		jsonContent, err = client.GenerateProposalStream(context.Background(), systemPrompt, userPrompt, onProgress)
+	return req, nil
+}
+
+// formatPresupuestoResponse extracts the budget JSON from a response, repairs
+// it when needed, fills in the tenant and formats it with indentation. It
+// returns the repairs applied, to be recorded with the usage.
+func formatPresupuestoResponse(resp *ai.Response, tenant config.Tenant) ([]byte, []string, error) {
+	jsonContent := resp.Text
+
+	// Tool input is already JSON validated against the schema; free text
+	// needs its code fences and surrounding prose removed
+	if resp.ToolInput != nil {
+		jsonContent = string(resp.ToolInput)
 	} else {
-		jsonContent, err = client.GenerateProposal(context.Background(), systemPrompt, userPrompt)
+		logger.Debug("Respuesta de IA antes de limpiar (primeros 200 chars): %s", jsonContent[:min(200, len(jsonContent))])
+		jsonContent = cleanJSONResponse(jsonContent, resp.StopReason == "max_tokens")
+		logger.Debug("JSON después de limpiar (primeros 200 chars): %s", jsonContent[:min(200, len(jsonContent))])
 	}
 
+	// Trailing commas, comments, smart quotes and truncated tails are fixed
+	// before validating
+	repaired, repairs, err := presupuesto.RepairJSON(jsonContent)
+	for _, repair := range repairs {
+		logger.Warn("JSON del presupuesto reparado: %s", repair)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error generando JSON: %w", err)
+		logger.Error("JSON inválido generado. Error: %v", err)
+		return nil, repairs, fmt.Errorf("error validando JSON generado (respuesta completa en %s): %w", PresupuestoRawFileName, err)
 	}
-
-	// Clean and validate JSON
-	logger.Debug("Respuesta de IA antes de limpiar (primeros 200 chars): %s", jsonContent[:min(200, len(jsonContent))])
-	jsonContent = cleanJSONResponse(jsonContent)
-	logger.Debug("JSON después de limpiar (primeros 200 chars): %s", jsonContent[:min(200, len(jsonContent))])
 	
 	// Validate JSON
 	var jsonData map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonContent), &jsonData); err != nil {
+	if err := json.Unmarshal(repaired, &jsonData); err != nil {
 		logger.Error("JSON inválido generado. Error: %v", err)
-		logger.Error("Contenido recibido (primeros 500 chars): %s", jsonContent[:min(500, len(jsonContent))])
-		return nil, fmt.Errorf("error validando JSON generado: %w", err)
+		return nil, repairs, fmt.Errorf("error validando JSON generado (respuesta completa en %s): %w", PresupuestoRawFileName, err)
 	}
 
+	// The company data comes from the selected tenant, not the model
+	applyTenant(jsonData, tenant)
+
 	// Format JSON with indentation
 	formattedJSON, err := json.MarshalIndent(jsonData, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("error formateando JSON: %w", err)
+		return nil, repairs, fmt.Errorf("error formateando JSON: %w", err)
 	}
 
-	logger.Debug("Presupuesto generado exitosamente")
-	return formattedJSON, nil
+	// Fields outside the cotización format are kept, but reported, as are
+	// the totals the model got wrong
+	if doc, problems, err := presupuesto.Parse(formattedJSON); err == nil {
+		for _, problem := range problems {
+			logger.Warn("Presupuesto generado: %s", problem)
+		}
+		if discrepancies := doc.Discrepancias(); len(discrepancies) > 0 {
+			for _, discrepancy := range discrepancies {
+				logger.Warn("Total incorrecto del modelo: %s", discrepancy)
+			}
+			logger.Warn("%d valor(es) no cuadran; ejecuta 'orgmprop presupuesto recalcular' para corregirlos", len(discrepancies))
+		}
+	}
+
+	return formattedJSON, repairs, nil
+}
+
+// rawOutput returns the unprocessed model output of a response
+func rawOutput(resp *ai.Response) string {
+	if resp.ToolInput != nil {
+		return string(resp.ToolInput)
+	}
+	return resp.Text
+}
+
+// saveRawInCurrentDir keeps the raw output in the current directory (the
+// project's Oferta folder) even when it cannot be used
+func saveRawInCurrentDir(raw string) {
+	if cwd, err := os.Getwd(); err != nil {
+		logger.Warn("No se pudo guardar la respuesta original: %v", err)
+	} else if err := saveRawResponse(cwd, raw); err != nil {
+		logger.Warn("No se pudo guardar la respuesta original: %v", err)
+	}
+}
+
+// saveRawResponse keeps the unprocessed model output as presupuesto.raw.txt
+// in dir, so a budget that fails validation can be inspected or fixed by hand
+func saveRawResponse(dir string, raw string) error {
+	rawPath := filepath.Join(dir, PresupuestoRawFileName)
+	if err := os.WriteFile(rawPath, []byte(raw), 0644); err != nil {
+		return fmt.Errorf("error guardando respuesta original: %w", err)
+	}
+
+	logger.Debug("Respuesta original guardada en: %s", rawPath)
+	return nil
 }
 
 // PresupuestoPromptData represents the prompt data stored in a text file
@@ -173,8 +320,9 @@ func LoadPresupuestoPrompt() (string, error) {
 	return string(data), nil
 }
 
-// SavePresupuesto saves the budget JSON to the current directory
-func SavePresupuesto(jsonData []byte) error {
+// SavePresupuesto saves the budget JSON, and its usage sidecar when known, to
+// the current directory
+func SavePresupuesto(jsonData []byte, usage *PresupuestoUsage) error {
 	logger.Debug("Guardando presupuesto en directorio actual")
 
 	// Get current directory
@@ -183,16 +331,65 @@ func SavePresupuesto(jsonData []byte) error {
 		return fmt.Errorf("error obteniendo directorio actual: %w", err)
 	}
 
+	return SavePresupuestoTo(cwd, jsonData, usage)
+}
+
+// SavePresupuestoTo saves the budget JSON, and its usage sidecar when known,
+// to an Oferta folder
+func SavePresupuestoTo(dir string, jsonData []byte, usage *PresupuestoUsage) error {
 	// Save JSON
-	jsonPath := filepath.Join(cwd, "presupuesto.json")
+	jsonPath := filepath.Join(dir, "presupuesto.json")
 	if err := os.WriteFile(jsonPath, jsonData, 0644); err != nil {
 		return fmt.Errorf("error guardando JSON: %w", err)
 	}
 
 	logger.Debug("Presupuesto guardado en: %s", jsonPath)
+
+	if usage == nil {
+		return nil
+	}
+
+	// Save usage sidecar
+	usagePath := filepath.Join(dir, "presupuesto.uso.json")
+	usageData, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializando uso: %w", err)
+	}
+
+	if err := os.WriteFile(usagePath, usageData, 0644); err != nil {
+		return fmt.Errorf("error guardando uso: %w", err)
+	}
+
+	logger.Debug("Uso de tokens guardado en: %s", usagePath)
 	return nil
 }
 
+// TotalRows converts totals for ui.ShowRecalculation
+func TotalRows(totales presupuesto.Totales, datos presupuesto.Datos) []ui.TotalRow {
+	rows := []ui.TotalRow{
+		{Label: "Costos directos", Amount: presupuesto.FormatMonto(totales.Directos)},
+		{Label: "Indirectos", Amount: presupuesto.FormatMonto(totales.Indirectos)},
+		{Label: "Subtotal", Amount: presupuesto.FormatMonto(totales.Subtotal)},
+	}
+	if totales.Descuento != 0 {
+		rows = append(rows, ui.TotalRow{Label: fmt.Sprintf("Descuento (%g%%)", datos.DescuentoPorcentaje), Amount: "-" + presupuesto.FormatMonto(totales.Descuento)})
+	}
+	rows = append(rows, ui.TotalRow{Label: fmt.Sprintf("ITBIS (%g%%)", datos.ItbisPorcentaje), Amount: presupuesto.FormatMonto(totales.ITBIS)})
+	if totales.Retencion != 0 {
+		rows = append(rows, ui.TotalRow{Label: fmt.Sprintf("Retención (%g%%)", datos.RetencionPorcentaje), Amount: "-" + presupuesto.FormatMonto(totales.Retencion)})
+	}
+	return append(rows, ui.TotalRow{Label: "Total", Amount: presupuesto.FormatMonto(totales.Total)})
+}
+
+// DiscrepancyRows converts discrepancies for ui.ShowRecalculation
+func DiscrepancyRows(discrepancies []presupuesto.Discrepancy) []string {
+	rows := make([]string, len(discrepancies))
+	for i, discrepancy := range discrepancies {
+		rows[i] = discrepancy.String()
+	}
+	return rows
+}
+
 // getPresupuestoYAML returns the presupuesto YAML from config or embedded assets
 func getPresupuestoYAML() ([]byte, error) {
 	// First try to load from config directory
@@ -212,42 +409,141 @@ func getPresupuestoYAML() ([]byte, error) {
 	return data, nil
 }
 
-// parsePresupuestoYAML parses the YAML file and extracts system prompt, user template, and JSON example
-func parsePresupuestoYAML(data []byte) (systemPrompt, userTemplate, ejemploJSON string, err error) {
-	// Convert to string for processing
-	content := string(data)
+// legacyExampleMarker separated the JSON example from the YAML in
+// presupuesto.yaml files before the ejemplo field
+const legacyExampleMarker = "aqui debajo dejo la cotizaicon de ejmeplo:"
 
-	// Find the marker for the JSON example
-	marker := "aqui debajo dejo la cotizaicon de ejmeplo:"
-	markerIndex := strings.Index(content, marker)
-	if markerIndex == -1 {
-		return "", "", "", fmt.Errorf("marcador de ejemplo JSON no encontrado")
-	}
+// exampleFieldPattern finds a block scalar ejemplo field
+var exampleFieldPattern = regexp.MustCompile(`(?m)^ejemplo:[ \t]*[|>][-+0-9]*[ \t]*$`)
 
-	// Split content: YAML part and JSON part
-	yamlPart := content[:markerIndex]
-	jsonPart := content[markerIndex+len(marker):]
+// parsePresupuestoYAML parses the YAML file and returns the prompt definition
+// and the JSON example, normalized from JSON5. The example is the ejemplo
+// field, the text after the legacy marker or presupuesto.example.json.
+func parsePresupuestoYAML(data []byte) (presupuestoYAML *PresupuestoYAML, ejemploJSON string, err error) {
+	// Convert to string for processing
+	content := string(data)
 
-	// Parse YAML part
 	var yamlData PresupuestoYAML
-	if err := yaml.Unmarshal([]byte(yamlPart), &yamlData); err != nil {
-		return "", "", "", fmt.Errorf("error parseando YAML: %w", err)
+	var ejemplo string
+	source := "presupuesto.yaml"
+	// lineOffset and columnOffset place example errors in the source file
+	lineOffset, columnOffset := 0, 0
+
+	if markerIndex := strings.Index(content, legacyExampleMarker); markerIndex != -1 {
+		logger.Debug("Ejemplo JSON leído después del marcador de presupuesto.yaml")
+		if err := yaml.Unmarshal([]byte(content[:markerIndex]), &yamlData); err != nil {
+			return nil, "", fmt.Errorf("error parseando YAML: %w", err)
+		}
+		ejemplo = content[markerIndex+len(legacyExampleMarker):]
+		lineOffset = strings.Count(content[:markerIndex], "\n")
+	} else {
+		if err := yaml.Unmarshal(data, &yamlData); err != nil {
+			return nil, "", fmt.Errorf("error parseando YAML: %w", err)
+		}
+		ejemplo = yamlData.Ejemplo
+
+		if strings.TrimSpace(ejemplo) != "" {
+			if loc := exampleFieldPattern.FindStringIndex(content); loc != nil {
+				lineOffset = strings.Count(content[:loc[1]], "\n") + 1
+				columnOffset = blockIndent(content[loc[1]:])
+			}
+		} else {
+			ejemplo, source, err = getPresupuestoExample()
+			if err != nil {
+				return nil, "", err
+			}
+		}
 	}
 
-	// Extract JSON example (clean it)
-	ejemploJSON = strings.TrimSpace(jsonPart)
-	// Remove leading/trailing whitespace and newlines
-	ejemploJSON = strings.Trim(ejemploJSON, "\n\r\t ")
+	normalized, err := presupuesto.ParseJSON5([]byte(ejemplo))
+	if err != nil {
+		var syntaxErr *presupuesto.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			syntaxErr.Line += lineOffset
+			syntaxErr.Column += columnOffset
+		}
+		return nil, "", fmt.Errorf("ejemplo JSON inválido en %s: %w", source, err)
+	}
+	ejemploJSON = string(normalized)
 
 	logger.Debug("System prompt extraído, longitud: %d", len(yamlData.System))
 	logger.Debug("User template extraído, longitud: %d", len(yamlData.UserTemplate))
-	logger.Debug("Ejemplo JSON extraído, longitud: %d", len(ejemploJSON))
+	logger.Debug("Ejemplo JSON extraído de %s, longitud: %d", source, len(ejemploJSON))
+
+	return &yamlData, ejemploJSON, nil
+}
+
+// blockIndent returns the indentation of the first non-empty line of a YAML
+// block scalar
+func blockIndent(block string) int {
+	for _, line := range strings.Split(strings.TrimPrefix(block, "\n"), "\n") {
+		if trimmed := strings.TrimLeft(line, " "); trimmed != "" {
+			return len(line) - len(trimmed)
+		}
+	}
+	return 0
+}
 
-	return yamlData.System, yamlData.UserTemplate, ejemploJSON, nil
+// getPresupuestoExample returns presupuesto.example.json from config or
+// embedded assets, and where it came from
+func getPresupuestoExample() (string, string, error) {
+	configPath := config.GetConfigFilePath(PresupuestoExampleFileName)
+	if data, err := os.ReadFile(configPath); err == nil {
+		logger.Debug("Ejemplo de presupuesto cargado desde config: %s", configPath)
+		return string(data), configPath, nil
+	}
+
+	data, err := assets.GetPresupuestoExample()
+	if err != nil {
+		return "", "", fmt.Errorf("error obteniendo ejemplo de presupuesto embebido: %w", err)
+	}
+
+	logger.Debug("Ejemplo de presupuesto cargado desde assets embebidos")
+	return string(data), PresupuestoExampleFileName + " (embebido)", nil
 }
 
-// cleanJSONResponse cleans up the JSON response from the AI
-func cleanJSONResponse(response string) string {
+// splitUserTemplate splits the user template before {descripcion_proyecto},
+// returning the stable prefix and the rest. The prefix is empty when the
+// description comes first.
+func splitUserTemplate(template string) (prefix, rest string) {
+	index := strings.Index(template, "{descripcion_proyecto}")
+	if index <= 0 {
+		return "", template
+	}
+	return template[:index], template[index:]
+}
+
+// presupuestoToolName is the tool the model must call with the budget
+const presupuestoToolName = "guardar_presupuesto"
+
+// tool turns output_format.schema into the tool used for structured output.
+// Returns nil when the YAML has no schema, falling back to free text JSON.
+func (p *PresupuestoYAML) tool() *ai.Tool {
+	schema := p.OutputFormat.Schema
+	if len(schema.Properties) == 0 {
+		logger.Debug("Presupuesto YAML sin output_format.schema, usando respuesta de texto")
+		return nil
+	}
+
+	inputSchema := map[string]interface{}{
+		"type":       "object",
+		"properties": schema.Properties,
+	}
+	if len(schema.Required) > 0 {
+		inputSchema["required"] = schema.Required
+	}
+
+	return &ai.Tool{
+		Name:        presupuestoToolName,
+		Description: "Guarda el presupuesto generado. Llama esta herramienta con la cotización completa siguiendo el ejemplo.",
+		InputSchema: inputSchema,
+	}
+}
+
+// cleanJSONResponse cleans up the JSON response from the AI. A truncated
+// response keeps everything after its first bracket, so presupuesto.RepairJSON
+// can close it instead of losing the tail after the last complete bracket.
+func cleanJSONResponse(response string, truncated bool) string {
 	// Remove markdown code fences if present
 	response = strings.TrimSpace(response)
 	
@@ -278,6 +574,9 @@ func cleanJSONResponse(response string) string {
 		// No JSON found, return as is (will fail validation)
 		return response
 	}
+	if truncated {
+		return response[startIndex:]
+	}
 	
 	// Find the last '}' or ']' which should be the end of JSON
 	endIndex := -1
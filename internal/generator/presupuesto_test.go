@@ -0,0 +1,90 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/config"
+)
+
+func TestGeneratePresupuesto(t *testing.T) {
+	example, err := os.ReadFile("testdata/presupuesto.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		fixture string
+		stream  bool
+		cancel  bool
+		wantErr error
+	}{
+		{name: "sin streaming", fixture: string(example)},
+		{name: "con streaming", fixture: string(example), stream: true},
+		{name: "no cumple el esquema", fixture: `{"datos": "texto"}`, wantErr: errors.New("fixture inválido")},
+		{name: "cancelada", fixture: string(example), cancel: true, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeProvider(t, writeFixtures(t, map[string]string{ai.KindPresupuesto + ".txt": tt.fixture}))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			var onProgress func(string)
+			if tt.stream {
+				onProgress = func(string) {}
+			}
+
+			jsonData, usage, err := GeneratePresupuesto(ctx, "Instalación eléctrica de un local", nil, onProgress)
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("GeneratePresupuesto succeeded, want error %v", tt.wantErr)
+				}
+				if !errors.Is(err, tt.wantErr) && !strings.Contains(err.Error(), tt.wantErr.Error()) {
+					t.Fatalf("GeneratePresupuesto error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GeneratePresupuesto: %v", err)
+			}
+
+			if usage.Modelo != ai.FakeModel {
+				t.Errorf("usage.Modelo = %q, want %q", usage.Modelo, ai.FakeModel)
+			}
+
+			var doc struct {
+				Datos struct {
+					Tenant struct {
+						RazonSocial string `json:"razon_social"`
+					} `json:"tenant"`
+				} `json:"datos"`
+			}
+			if err := json.Unmarshal(jsonData, &doc); err != nil {
+				t.Fatalf("generated JSON: %v", err)
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, tenant := cfg.ActiveTenant(); doc.Datos.Tenant.RazonSocial != tenant.RazonSocial {
+				t.Errorf("tenant razon_social = %q, want %q", doc.Datos.Tenant.RazonSocial, tenant.RazonSocial)
+			}
+
+			if _, err := os.Stat(PresupuestoRawFileName); err != nil {
+				t.Errorf("raw output not saved: %v", err)
+			}
+		})
+	}
+}
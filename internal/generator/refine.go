@@ -0,0 +1,369 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/config"
+	"orgmprop/internal/logger"
+)
+
+// ConversationFileName is the refinement conversation stored in the Oferta folder
+const ConversationFileName = "propuesta.conversacion.json"
+
+// refineToolName is the tool the model must call with its edits
+const refineToolName = "editar_propuesta"
+
+// omittedVersion replaces superseded HTML versions in the history sent to the model
+const omittedVersion = "[Versión anterior del documento omitida; la versión vigente es la más reciente]"
+
+// ConversationTurn is a single turn of a refinement conversation
+type ConversationTurn struct {
+	Rol       string    `json:"rol"`
+	Contenido string    `json:"contenido"`
+	Resumen   string    `json:"resumen,omitempty"`
+	Fecha     time.Time `json:"fecha"`
+	Modelo    string    `json:"modelo,omitempty"`
+	Uso       *ai.Usage `json:"uso,omitempty"`
+}
+
+// Conversation is the history of a proposal: the original prompt, every
+// refinement request and the HTML returned for each one
+type Conversation struct {
+	Titulo    string             `json:"titulo"`
+	Subtitulo string             `json:"subtitulo"`
+	Turnos    []ConversationTurn `json:"turnos"`
+}
+
+// Refinement is the result of a refinement turn, ready to be saved
+type Refinement struct {
+	Proposal     *ProposalData
+	HTML         string
+	Resumen      string
+	Ediciones    int
+	Conversation *Conversation
+}
+
+// proposalEdit replaces one exact fragment of the current HTML
+type proposalEdit struct {
+	Buscar     string `json:"buscar"`
+	Reemplazar string `json:"reemplazar"`
+}
+
+// refineInput is the input of the editar_propuesta tool
+type refineInput struct {
+	Resumen   string         `json:"resumen"`
+	Ediciones []proposalEdit `json:"ediciones"`
+}
+
+// RefineProposal asks the model for targeted edits to the proposal in the
+// current directory and applies them. Earlier turns are loaded from
+// propuesta.conversacion.json, or seeded from propuesta.json and
+// propuesta.html on the first refinement.
+func RefineProposal(ctx context.Context, instruction string, onProgress func(string)) (*Refinement, error) {
+	logger.Debug("Iniciando refinamiento de propuesta")
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error cargando configuración: %w", err)
+	}
+
+	proposal, err := LoadProposal()
+	if err != nil {
+		return nil, err
+	}
+
+	currentHTML, err := loadProposalHTML()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, err := LoadConversation(proposal, currentHTML)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create AI provider
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	systemPrompt, err := proposalSystemPrompt(cfg)
+	if err != nil {
+		return nil, err
+	}
+	systemPrompt += `
+
+---
+
+MODO REFINAMIENTO:
+- El documento ya existe; su versión vigente es la última respuesta del asistente.
+- Aplica solo los cambios que pide el usuario, sin reescribir el documento.
+- Llama la herramienta editar_propuesta con ediciones puntuales de buscar y reemplazar.
+- Cada "buscar" debe copiarse exactamente del HTML vigente y aparecer una sola vez; incluye contexto suficiente para que sea único.
+- Las ediciones se aplican en orden; mantén la estructura HTML válida.`
+
+	req := newRequest(cfg, ai.KindRefinamiento, systemPrompt, instruction)
+	req.History = conversation.history(currentHTML)
+	req.Tool = refineTool(currentHTML)
+
+	ctx, cancel := withRequestTimeout(ctx, cfg)
+	defer cancel()
+
+	logger.Debug("Solicitando ediciones con IA, %d turnos previos", len(req.History))
+	var resp *ai.Response
+	partial := &partialCollector{onProgress: onProgress}
+	if onProgress != nil {
+		resp, err = provider.GenerateStream(ctx, req, partial.onChunk)
+	} else {
+		resp, err = provider.Generate(ctx, req)
+	}
+
+	if err != nil {
+		recordFailedUsage(ai.KindRefinamiento, cfg.GetProvider(), provider.Model(), err)
+		err = handleInterrupted(ctx, ai.KindRefinamiento, instruction, partial, err)
+		return nil, fmt.Errorf("error refinando propuesta: %w", err)
+	}
+
+	recordUsage(ai.KindRefinamiento, cfg.GetProvider(), provider.Model(), resp.Usage)
+
+	var input refineInput
+	if err := json.Unmarshal(resp.ToolInput, &input); err != nil {
+		return nil, fmt.Errorf("error leyendo ediciones: %w", err)
+	}
+
+	htmlContent, err := applyEdits(currentHTML, input.Ediciones)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("%d ediciones aplicadas: %s", len(input.Ediciones), input.Resumen)
+
+	now := time.Now()
+	conversation.Turnos = append(conversation.Turnos,
+		ConversationTurn{Rol: ai.RoleUser, Contenido: instruction, Fecha: now},
+		ConversationTurn{
+			Rol:       ai.RoleAssistant,
+			Contenido: htmlContent,
+			Resumen:   input.Resumen,
+			Fecha:     now,
+			Modelo:    provider.Model(),
+			Uso:       &resp.Usage,
+		},
+	)
+
+	// The proposal keeps the total usage of every generation that shaped it
+	if proposal.Uso == nil {
+		proposal.Uso = &ai.Usage{}
+	}
+	proposal.Uso.Add(resp.Usage)
+	proposal.Modelo = provider.Model()
+
+	return &Refinement{
+		Proposal:     proposal,
+		HTML:         htmlContent,
+		Resumen:      input.Resumen,
+		Ediciones:    len(input.Ediciones),
+		Conversation: conversation,
+	}, nil
+}
+
+// SaveRefinement saves the refined proposal and its conversation to the
+// current directory
+func SaveRefinement(refinement *Refinement) error {
+	if err := SaveProposal(refinement.Proposal, refinement.HTML); err != nil {
+		return err
+	}
+
+	return SaveConversation(refinement.Conversation)
+}
+
+// LoadConversation loads the refinement conversation from the current
+// directory. Without one, it starts from the proposal prompt and HTML.
+func LoadConversation(proposal *ProposalData, currentHTML string) (*Conversation, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo directorio actual: %w", err)
+	}
+
+	path := filepath.Join(cwd, ConversationFileName)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var conversation Conversation
+		if err := json.Unmarshal(data, &conversation); err != nil {
+			return nil, fmt.Errorf("error parseando %s: %w", ConversationFileName, err)
+		}
+		logger.Debug("Conversación cargada: %d turnos", len(conversation.Turnos))
+		return &conversation, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error leyendo %s: %w", ConversationFileName, err)
+	}
+
+	logger.Debug("Conversación no encontrada, iniciando desde propuesta.json")
+	return &Conversation{
+		Titulo:    proposal.Titulo,
+		Subtitulo: proposal.Subtitulo,
+		Turnos: []ConversationTurn{
+			{
+				Rol:       ai.RoleUser,
+				Contenido: proposalUserPrompt(proposal.Titulo, proposal.Subtitulo, proposal.Prompt),
+				Fecha:     proposal.Fecha,
+			},
+			{
+				Rol:       ai.RoleAssistant,
+				Contenido: currentHTML,
+				Fecha:     proposal.Fecha,
+				Modelo:    proposal.Modelo,
+				Uso:       proposal.Uso,
+			},
+		},
+	}, nil
+}
+
+// SaveConversation saves the refinement conversation to the current directory
+func SaveConversation(conversation *Conversation) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error obteniendo directorio actual: %w", err)
+	}
+
+	data, err := json.MarshalIndent(conversation, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializando conversación: %w", err)
+	}
+
+	path := filepath.Join(cwd, ConversationFileName)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error guardando conversación: %w", err)
+	}
+
+	logger.Debug("Conversación guardada en: %s", path)
+	return nil
+}
+
+// history converts the conversation into model turns. Only the latest HTML is
+// sent in full, and it is read from disk so manual edits are respected.
+func (c *Conversation) history(currentHTML string) []ai.Message {
+	lastAssistant := -1
+	for i, turn := range c.Turnos {
+		if turn.Rol == ai.RoleAssistant {
+			lastAssistant = i
+		}
+	}
+
+	messages := make([]ai.Message, 0, len(c.Turnos))
+	for i, turn := range c.Turnos {
+		content := turn.Contenido
+		if turn.Rol == ai.RoleAssistant {
+			content = omittedVersion
+			if turn.Resumen != "" {
+				content += "\nCambios realizados: " + turn.Resumen
+			}
+			if i == lastAssistant {
+				content = currentHTML
+			}
+		}
+		messages = append(messages, ai.Message{Role: turn.Rol, Content: content})
+	}
+
+	return messages
+}
+
+// refineTool returns the editar_propuesta tool; its validator rejects edits
+// that do not apply cleanly to the current HTML, so they can be repaired
+func refineTool(currentHTML string) *ai.Tool {
+	return &ai.Tool{
+		Name:        refineToolName,
+		Description: "Aplica ediciones puntuales de buscar y reemplazar al HTML vigente de la propuesta.",
+		InputSchema: map[string]interface{}{
+			"type":     "object",
+			"required": []string{"resumen", "ediciones"},
+			"properties": map[string]interface{}{
+				"resumen": map[string]interface{}{
+					"type":        "string",
+					"description": "Resumen breve de los cambios realizados",
+				},
+				"ediciones": map[string]interface{}{
+					"type":        "array",
+					"description": "Ediciones a aplicar en orden",
+					"items": map[string]interface{}{
+						"type":     "object",
+						"required": []string{"buscar", "reemplazar"},
+						"properties": map[string]interface{}{
+							"buscar": map[string]interface{}{
+								"type":        "string",
+								"description": "Fragmento exacto del HTML vigente, único en el documento",
+							},
+							"reemplazar": map[string]interface{}{
+								"type":        "string",
+								"description": "Texto que reemplaza al fragmento",
+							},
+						},
+					},
+				},
+			},
+		},
+		Validate: func(raw json.RawMessage) error {
+			var input refineInput
+			if err := json.Unmarshal(raw, &input); err != nil {
+				return err
+			}
+			_, err := applyEdits(currentHTML, input.Ediciones)
+			return err
+		},
+	}
+}
+
+// applyEdits applies each edit in order, requiring its search text to appear
+// exactly once in the document at that point
+func applyEdits(html string, edits []proposalEdit) (string, error) {
+	if len(edits) == 0 {
+		return "", fmt.Errorf("no se recibieron ediciones")
+	}
+
+	var problems []string
+	for i, edit := range edits {
+		if edit.Buscar == "" {
+			problems = append(problems, fmt.Sprintf("edición %d: 'buscar' está vacío", i+1))
+			continue
+		}
+
+		switch count := strings.Count(html, edit.Buscar); count {
+		case 1:
+			html = strings.Replace(html, edit.Buscar, edit.Reemplazar, 1)
+		case 0:
+			problems = append(problems, fmt.Sprintf("edición %d: el texto a buscar no existe en el documento", i+1))
+		default:
+			problems = append(problems, fmt.Sprintf("edición %d: el texto a buscar aparece %d veces, agrega contexto", i+1, count))
+		}
+	}
+
+	if len(problems) > 0 {
+		return "", fmt.Errorf("ediciones inválidas: %s", strings.Join(problems, "; "))
+	}
+
+	return html, nil
+}
+
+// loadProposalHTML reads propuesta.html from the current directory
+func loadProposalHTML() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("error obteniendo directorio actual: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(cwd, "propuesta.html"))
+	if err != nil {
+		return "", fmt.Errorf("error leyendo propuesta.html: %w", err)
+	}
+
+	return string(data), nil
+}
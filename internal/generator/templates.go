@@ -0,0 +1,22 @@
+package generator
+
+import (
+	"strings"
+
+	"orgmprop/internal/config"
+	"orgmprop/internal/ui"
+)
+
+// TemplateChangeRows converts sync changes for ui.ShowTemplateChanges
+func TemplateChangeRows(changes []config.TemplateChange) []ui.TemplateChange {
+	rows := make([]ui.TemplateChange, len(changes))
+	for i, change := range changes {
+		rows[i] = ui.TemplateChange{File: change.File, Status: change.Status}
+	}
+	return rows
+}
+
+// ResolveConflictTUI asks the user how to resolve a merge conflict
+func ResolveConflictTUI(conflict config.MergeConflict) (string, error) {
+	return ui.ResolveMergeConflict(conflict.File, strings.Join(conflict.User, "\n"), strings.Join(conflict.New, "\n"))
+}
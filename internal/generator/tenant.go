@@ -0,0 +1,157 @@
+package generator
+
+import (
+	"fmt"
+
+	"orgmprop/internal/config"
+	"orgmprop/internal/logger"
+	"orgmprop/internal/ui"
+)
+
+// proposalTenantPrompt returns the system prompt section with the company
+// that issues the proposal
+func proposalTenantPrompt(tenant config.Tenant) string {
+	return fmt.Sprintf(`
+
+---
+
+EMPRESA CONSULTORA (reemplaza cualquier empresa o logo por defecto indicado arriba):
+- Empresa consultora: %s
+- Razón social: %s
+- RNC: %s
+- Dirección: %s %s
+- Logo: %s`, tenant.NombreComercial, tenant.RazonSocial, tenant.RNC, tenant.Direccion, tenant.Ubicacion, tenant.ProposalLogo())
+}
+
+// presupuestoTenantPrompt returns the system prompt section with the values
+// of the datos.tenant block
+func presupuestoTenantPrompt(tenant config.Tenant) string {
+	return fmt.Sprintf(`
+
+DATOS DEL TENANT (usar siempre estos valores en datos.tenant, en lugar de los del ejemplo):
+- logo: %q
+- qr_code: %q
+- rnc: %q
+- razon_social: %q
+- nombre_comercial: %q
+- direccion: %q
+- ubicacion: %q`, tenant.Logo, tenant.QRCode, tenant.RNC, tenant.RazonSocial, tenant.NombreComercial, tenant.Direccion, tenant.Ubicacion)
+}
+
+// applyTenant overwrites the datos.tenant block of a budget with the tenant
+// profile, so the company data never depends on the model
+func applyTenant(presupuesto map[string]interface{}, tenant config.Tenant) {
+	datos, ok := presupuesto["datos"].(map[string]interface{})
+	if !ok {
+		logger.Warn("Presupuesto sin bloque datos; no se aplicaron los datos del tenant")
+		return
+	}
+
+	datos["tenant"] = map[string]interface{}{
+		"logo":             tenant.Logo,
+		"qr_code":          tenant.QRCode,
+		"rnc":              tenant.RNC,
+		"razon_social":     tenant.RazonSocial,
+		"nombre_comercial": tenant.NombreComercial,
+		"direccion":        tenant.Direccion,
+		"ubicacion":        tenant.Ubicacion,
+	}
+}
+
+// ConfigureTenantTUI runs the tenant selector of config tenant: it switches
+// the active tenant, adds a profile or edits the current one, and saves the
+// configuration. It reports whether anything changed.
+func ConfigureTenantTUI(cfg *config.Config) (bool, error) {
+	current, tenant := cfg.ActiveTenant()
+
+	choice, err := ui.ShowTenantSelector(cfg.TenantNames(), current)
+	if err != nil {
+		return false, err
+	}
+
+	switch choice.Action {
+	case ui.TenantSelect:
+		if choice.Name == current {
+			return false, nil
+		}
+		cfg.Tenant = choice.Name
+
+	case ui.TenantNew:
+		form := &ui.TenantForm{}
+		if err := ui.NewTenantForm(form, tenantNameValidator(cfg, "")); err != nil {
+			return false, err
+		}
+		cfg.SetTenant(form.Name, TenantFromForm(form))
+		cfg.Tenant = form.Name
+
+	case ui.TenantEdit:
+		form := TenantFormOf(current, tenant)
+		if err := ui.NewTenantForm(form, tenantNameValidator(cfg, current)); err != nil {
+			return false, err
+		}
+		// A renamed profile replaces the old one; the default stays available
+		if form.Name != current && current != config.DefaultTenantName {
+			delete(cfg.Tenants, current)
+		}
+		cfg.SetTenant(form.Name, TenantFromForm(form))
+		cfg.Tenant = form.Name
+
+	default:
+		return false, nil
+	}
+
+	if err := config.Save(cfg); err != nil {
+		return false, err
+	}
+	logger.Info("Empresa activa: %s", cfg.Tenant)
+	return true, nil
+}
+
+// tenantNameValidator checks the name of a new profile, or of the profile
+// current when editing: it must be valid and must not replace another one
+func tenantNameValidator(cfg *config.Config, current string) func(string) error {
+	return func(name string) error {
+		// Profiles written by hand keep their name even if it is not valid
+		if current != "" && name == current {
+			return nil
+		}
+		if err := config.ValidateTenantName(name); err != nil {
+			return err
+		}
+		for _, existing := range cfg.TenantNames() {
+			if name == existing {
+				return fmt.Errorf("ya existe un perfil llamado %q", name)
+			}
+		}
+		return nil
+	}
+}
+
+// TenantFormOf fills a ui.TenantForm with a tenant profile
+func TenantFormOf(name string, tenant config.Tenant) *ui.TenantForm {
+	return &ui.TenantForm{
+		Name:            name,
+		NombreComercial: tenant.NombreComercial,
+		RazonSocial:     tenant.RazonSocial,
+		RNC:             tenant.RNC,
+		Direccion:       tenant.Direccion,
+		Ubicacion:       tenant.Ubicacion,
+		Logo:            tenant.Logo,
+		LogoPropuesta:   tenant.LogoPropuesta,
+		QRCode:          tenant.QRCode,
+	}
+}
+
+// TenantFromForm converts a filled ui.TenantForm into a tenant profile
+func TenantFromForm(form *ui.TenantForm) config.Tenant {
+	return config.Tenant{
+		Logo:            form.Logo,
+		QRCode:          form.QRCode,
+		RNC:             form.RNC,
+		RazonSocial:     form.RazonSocial,
+		NombreComercial: form.NombreComercial,
+		Direccion:       form.Direccion,
+		Ubicacion:       form.Ubicacion,
+		LogoPropuesta:   form.LogoPropuesta,
+	}
+}
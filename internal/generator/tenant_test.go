@@ -0,0 +1,41 @@
+package generator
+
+import (
+	"testing"
+
+	"orgmprop/internal/config"
+)
+
+func TestTenantNameValidator(t *testing.T) {
+	cfg := &config.Config{Tenants: map[string]config.Tenant{
+		"dapec":     {NombreComercial: "DAPEC"},
+		"A Mano":    {NombreComercial: "Escrito a mano"},
+		"consultor": {NombreComercial: "Consultor"},
+	}}
+
+	tests := []struct {
+		name    string
+		current string
+		input   string
+		wantErr bool
+	}{
+		{"nuevo perfil", "", "nuevo", false},
+		{"nuevo con nombre existente", "", "dapec", true},
+		{"nuevo con nombre del perfil por defecto", "", config.DefaultTenantName, true},
+		{"nuevo con nombre inválido", "", "Con Espacios", true},
+		{"editar sin renombrar", "dapec", "dapec", false},
+		{"editar perfil escrito a mano", "A Mano", "A Mano", false},
+		{"renombrar a nombre libre", "dapec", "dapec_srl", false},
+		{"renombrar a perfil existente", "dapec", "consultor", true},
+		{"renombrar al perfil por defecto", "dapec", config.DefaultTenantName, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tenantNameValidator(cfg, tt.current)(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
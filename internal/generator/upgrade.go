@@ -0,0 +1,15 @@
+package generator
+
+import (
+	"orgmprop/internal/config"
+	"orgmprop/internal/ui"
+)
+
+// TemplateUpgradeRows converts upgrade outcomes for ui.ShowTemplateUpgrades
+func TemplateUpgradeRows(upgrades []config.TemplateUpgrade) []ui.TemplateUpgrade {
+	rows := make([]ui.TemplateUpgrade, len(upgrades))
+	for i, upgrade := range upgrades {
+		rows[i] = ui.TemplateUpgrade{File: upgrade.File, Result: upgrade.Result, Conflicts: upgrade.Conflicts}
+	}
+	return rows
+}
@@ -0,0 +1,65 @@
+package generator
+
+import (
+	"path/filepath"
+	"time"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/ledger"
+	"orgmprop/internal/logger"
+	"orgmprop/internal/project"
+	"orgmprop/internal/ui"
+)
+
+// recordUsage appends a generation of the current project to the cost ledger
+func recordUsage(kind, provider, model string, usage ai.Usage) {
+	recordEntry(ledger.Entry{
+		Fecha:     time.Now(),
+		Proyecto:  currentProjectName(),
+		Tipo:      kind,
+		Proveedor: provider,
+		Modelo:    model,
+		Usage:     usage,
+	})
+}
+
+// recordFailedUsage records the tokens billed before a generation failed or
+// was interrupted, if any
+func recordFailedUsage(kind, provider, model string, err error) {
+	if usage, ok := ai.UsageOf(err); ok {
+		recordUsage(kind, provider, model, usage)
+	}
+}
+
+// recordEntry appends an entry to the cost ledger, logging failures
+func recordEntry(entry ledger.Entry) {
+	if err := ledger.Append(entry); err != nil {
+		logger.Warn("Error registrando costos: %v", err)
+	}
+}
+
+// CostRows converts ledger summaries for ui.ShowCostSummaries
+func CostRows(summaries []ledger.Summary) []ui.CostSummary {
+	rows := make([]ui.CostSummary, len(summaries))
+	for i, summary := range summaries {
+		rows[i] = ui.CostSummary{
+			Key:          summary.Key,
+			Generations:  summary.Generations,
+			InputTokens:  summary.InputTokens,
+			OutputTokens: summary.OutputTokens,
+			Cost:         summary.Cost,
+			Unpriced:     summary.Unpriced,
+		}
+	}
+	return rows
+}
+
+// currentProjectName returns the project of the current directory, which is
+// normally the project's Oferta folder
+func currentProjectName() string {
+	projectDir, err := project.CurrentProjectDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(projectDir)
+}
@@ -0,0 +1,198 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"orgmprop/internal/ai"
+	"orgmprop/internal/config"
+	"orgmprop/internal/logger"
+)
+
+// LedgerFileName is the append-only cost ledger inside the config directory
+const LedgerFileName = "costos.jsonl"
+
+// Ways of grouping the cost report
+const (
+	GroupByMonth   = "mes"
+	GroupByProject = "proyecto"
+	GroupByModel   = "modelo"
+)
+
+// Entry represents a single generation in the cost ledger
+type Entry struct {
+	Fecha    time.Time `json:"fecha"`
+	Proyecto string    `json:"proyecto"`
+	Tipo     string    `json:"tipo"`
+	// Proveedor is empty in entries written before it was recorded
+	Proveedor string `json:"proveedor,omitempty"`
+	Modelo    string `json:"modelo"`
+	// Lote marks generations made through a batch API, billed at half price
+	Lote bool `json:"lote,omitempty"`
+	ai.Usage
+}
+
+// Summary is the AI spend of a month, project or model
+type Summary struct {
+	Key          string
+	Generations  int
+	InputTokens  int64
+	OutputTokens int64
+	Cost         float64
+	// Unpriced counts generations whose model has no price configured
+	Unpriced int
+}
+
+// appendMu serializes appends from concurrent generations
+var appendMu sync.Mutex
+
+// Append adds an entry to the ledger
+func Append(entry Entry) error {
+	if err := os.MkdirAll(config.ConfigDir, 0755); err != nil {
+		return fmt.Errorf("error creando directorio de configuración: %w", err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error serializando registro de costos: %w", err)
+	}
+
+	appendMu.Lock()
+	defer appendMu.Unlock()
+
+	path := config.GetConfigFilePath(LedgerFileName)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error abriendo registro de costos: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error escribiendo registro de costos: %w", err)
+	}
+
+	logger.Debug("Registro de costos agregado: %s %s %s", entry.Tipo, entry.Proyecto, entry.Modelo)
+	return nil
+}
+
+// Load reads every entry in the ledger
+func Load() ([]Entry, error) {
+	path := config.GetConfigFilePath(LedgerFileName)
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error abriendo registro de costos: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Warn("Línea %d inválida en %s: %v", line, path, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo registro de costos: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Cost returns the price in USD of a generation made with a model of the
+// given provider, and whether the model has a price
+func Cost(cfg *config.Config, provider, model string, usage ai.Usage) (float64, bool) {
+	price, ok := cfg.PriceForProvider(provider, model)
+	if !ok {
+		return 0, false
+	}
+
+	// Cache writes cost 25% more than regular input, cache reads 10% of it
+	cost := float64(usage.InputTokens)*price.Input +
+		float64(usage.OutputTokens)*price.Output +
+		float64(usage.CacheCreationInputTokens)*price.Input*1.25 +
+		float64(usage.CacheReadInputTokens)*price.Input*0.1
+
+	return cost / 1_000_000, true
+}
+
+// Summaries totals the ledger by month, project or model
+func Summaries(group string) ([]Summary, error) {
+	logger.Debug("Calculando resumen de costos por %s", group)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	totals := map[string]*Summary{}
+	for _, entry := range entries {
+		var key string
+		switch group {
+		case GroupByMonth:
+			key = entry.Fecha.Format("2006-01")
+		case GroupByProject:
+			key = entry.Proyecto
+		case GroupByModel:
+			key = entry.Modelo
+		default:
+			return nil, fmt.Errorf("agrupación desconocida: %s", group)
+		}
+
+		summary, ok := totals[key]
+		if !ok {
+			summary = &Summary{Key: key}
+			totals[key] = summary
+		}
+
+		summary.Generations++
+		summary.InputTokens += entry.InputTokens + entry.CacheCreationInputTokens + entry.CacheReadInputTokens
+		summary.OutputTokens += entry.OutputTokens
+
+		cost, priced := Cost(cfg, entry.Proveedor, entry.Modelo, entry.Usage)
+		if entry.Lote {
+			cost /= 2
+		}
+		summary.Cost += cost
+		if !priced {
+			summary.Unpriced++
+		}
+	}
+
+	summaries := make([]Summary, 0, len(totals))
+	for _, summary := range totals {
+		summaries = append(summaries, *summary)
+	}
+
+	// Months newest first, everything else by name
+	sort.Slice(summaries, func(i, j int) bool {
+		if group == GroupByMonth {
+			return summaries[i].Key > summaries[j].Key
+		}
+		return summaries[i].Key < summaries[j].Key
+	})
+
+	return summaries, nil
+}
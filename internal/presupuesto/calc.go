@@ -0,0 +1,219 @@
+package presupuesto
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"orgmprop/internal/logger"
+)
+
+// UnidadPorcentaje marks an indirecto whose precio × cantidad is a
+// percentage of the direct costs
+const UnidadPorcentaje = "%"
+
+// Totales are the amounts derived from the items of a cotización
+type Totales struct {
+	// Directos is the sum of the presupuesto items
+	Directos float64
+	// Indirectos is the sum of the indirectos
+	Indirectos float64
+	// Subtotal is Directos + Indirectos
+	Subtotal  float64
+	Descuento float64
+	// Base is Subtotal minus Descuento, on which taxes are computed
+	Base      float64
+	ITBIS     float64
+	Retencion float64
+	// Total is Base + ITBIS - Retencion
+	Total float64
+}
+
+// Discrepancy is a number of the document that differs from its recalculation
+type Discrepancy struct {
+	Path      string
+	Anterior  float64
+	Calculado float64
+}
+
+// String describes the discrepancy
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%s: %s → %s", d.Path, FormatMonto(d.Anterior), FormatMonto(d.Calculado))
+}
+
+// Round rounds an amount to cents, halves away from zero. The small nudge
+// absorbs binary representation errors such as 1.005 * 100 = 100.49999...
+func Round(amount float64) float64 {
+	return math.Round(amount*100+math.Copysign(1e-7, amount)) / 100
+}
+
+// FormatMonto formats an amount with thousands separators and two decimals,
+// as 15,109.89
+func FormatMonto(amount float64) string {
+	text := fmt.Sprintf("%.2f", math.Abs(Round(amount)))
+	whole, cents, _ := strings.Cut(text, ".")
+
+	var b strings.Builder
+	if amount < 0 && Round(amount) != 0 {
+		b.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String() + "." + cents
+}
+
+// Calcular computes the totals of a cotización without changing it
+func (p *Presupuesto) Calcular() Totales {
+	totales, _ := p.clone().Recalcular()
+	return totales
+}
+
+// Recalcular recomputes every total of the cotización in place and returns
+// the totals and the numbers that changed:
+//   - an item without children totals precio × cantidad
+//   - an item with children totals the sum of its children, and its precio
+//     is that sum divided by cantidad
+//   - a percentage indirecto (unidad "%" or porcentaje) totals that
+//     percentage of the direct costs
+//   - descuento applies to the subtotal, ITBIS and retención to the
+//     discounted base
+func (p *Presupuesto) Recalcular() (Totales, []Discrepancy) {
+	var totales Totales
+	var discrepancies []Discrepancy
+
+	for i := range p.Presupuesto.Presupuesto {
+		path := fmt.Sprintf("presupuesto.presupuesto[%d]", i)
+		totales.Directos += recalcularItem(&p.Presupuesto.Presupuesto[i], path, &discrepancies)
+	}
+	totales.Directos = Round(totales.Directos)
+
+	for i := range p.Presupuesto.Indirectos {
+		path := fmt.Sprintf("presupuesto.indirectos[%d]", i)
+		totales.Indirectos += recalcularIndirecto(&p.Presupuesto.Indirectos[i], totales.Directos, path, &discrepancies)
+	}
+	totales.Indirectos = Round(totales.Indirectos)
+
+	datos := p.Datos
+	totales.Subtotal = Round(totales.Directos + totales.Indirectos)
+	totales.Descuento = Round(totales.Subtotal * datos.DescuentoPorcentaje / 100)
+	totales.Base = Round(totales.Subtotal - totales.Descuento)
+	totales.ITBIS = Round(totales.Base * datos.ItbisPorcentaje / 100)
+	totales.Retencion = Round(totales.Base * datos.RetencionPorcentaje / 100)
+	totales.Total = Round(totales.Base + totales.ITBIS - totales.Retencion)
+
+	return totales, discrepancies
+}
+
+// recalcularItem recomputes an item and its children, returning its total
+func recalcularItem(item *Item, path string, discrepancies *[]Discrepancy) float64 {
+	if len(item.Children) == 0 {
+		setAmount(&item.Total, Round(item.Precio*item.Cantidad), path+".total", discrepancies)
+		return item.Total
+	}
+
+	var sum float64
+	for i := range item.Children {
+		sum += recalcularItem(&item.Children[i], fmt.Sprintf("%s.children[%d]", path, i), discrepancies)
+	}
+	sum = Round(sum)
+
+	setAmount(&item.Total, sum, path+".total", discrepancies)
+	if item.Cantidad != 0 {
+		setAmount(&item.Precio, Round(sum/item.Cantidad), path+".precio", discrepancies)
+	}
+	return item.Total
+}
+
+// recalcularIndirecto recomputes an indirecto over the direct costs,
+// returning its total
+func recalcularIndirecto(item *Item, directos float64, path string, discrepancies *[]Discrepancy) float64 {
+	switch {
+	case item.Porcentaje != nil:
+		total := Round(directos * *item.Porcentaje / 100)
+		setAmount(&item.Total, total, path+".total", discrepancies)
+		if item.Monto != nil {
+			setAmount(item.Monto, total, path+".monto", discrepancies)
+		}
+	case item.Unidad == UnidadPorcentaje:
+		setAmount(&item.Total, Round(directos*item.Precio*item.Cantidad/100), path+".total", discrepancies)
+	case item.Monto != nil && item.Precio == 0 && item.Cantidad == 0:
+		setAmount(&item.Total, Round(*item.Monto), path+".total", discrepancies)
+	default:
+		return recalcularItem(item, path, discrepancies)
+	}
+	return item.Total
+}
+
+// setAmount updates an amount, recording it when it changes by a cent or more
+func setAmount(amount *float64, calculated float64, path string, discrepancies *[]Discrepancy) {
+	if math.Abs(*amount-calculated) >= 0.005 {
+		*discrepancies = append(*discrepancies, Discrepancy{Path: path, Anterior: *amount, Calculado: calculated})
+	}
+	*amount = calculated
+}
+
+// clone copies a cotización deeply enough to recalculate the copy
+func (p *Presupuesto) clone() *Presupuesto {
+	copied := *p
+	copied.Presupuesto.Presupuesto = cloneItems(p.Presupuesto.Presupuesto)
+	copied.Presupuesto.Indirectos = cloneItems(p.Presupuesto.Indirectos)
+	return &copied
+}
+
+// cloneItems deep-copies items so recalculating them leaves the originals
+func cloneItems(items []Item) []Item {
+	if items == nil {
+		return nil
+	}
+	cloned := make([]Item, len(items))
+	for i, item := range items {
+		cloned[i] = item
+		cloned[i].Children = cloneItems(item.Children)
+		if item.Monto != nil {
+			monto := *item.Monto
+			cloned[i].Monto = &monto
+		}
+	}
+	return cloned
+}
+
+// Discrepancias returns the numbers of the cotización that differ from
+// their recalculation, without changing it
+func (p *Presupuesto) Discrepancias() []Discrepancy {
+	_, discrepancies := p.clone().Recalcular()
+	return discrepancies
+}
+
+// RecalcularArchivo recalculates a presupuesto.json in place, keeping the
+// previous version as presupuesto.json.bak when something changes
+func RecalcularArchivo(path string) (Totales, []Discrepancy, error) {
+	doc, err := Load(path)
+	if err != nil {
+		return Totales{}, nil, err
+	}
+
+	totales, discrepancies := doc.Recalcular()
+	if len(discrepancies) == 0 {
+		logger.Debug("Presupuesto sin discrepancias: %s", path)
+		return totales, nil, nil
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return totales, discrepancies, fmt.Errorf("error leyendo %s: %w", path, err)
+	}
+	if err := os.WriteFile(path+".bak", original, 0644); err != nil {
+		return totales, discrepancies, fmt.Errorf("error respaldando %s: %w", path, err)
+	}
+	if err := doc.Save(path); err != nil {
+		return totales, discrepancies, err
+	}
+
+	logger.Debug("Presupuesto recalculado (%d correcciones): %s", len(discrepancies), path)
+	return totales, discrepancies, nil
+}
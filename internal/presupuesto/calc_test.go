@@ -0,0 +1,160 @@
+package presupuesto
+
+import (
+	"testing"
+
+	"orgmprop/assets"
+)
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   float64
+	}{
+		{amount: 0, want: 0},
+		{amount: 1.004, want: 1},
+		{amount: 1.005, want: 1.01},
+		{amount: 2.675, want: 2.68},
+		{amount: 1.015, want: 1.02},
+		{amount: -1.005, want: -1.01},
+		{amount: 1234567.891, want: 1234567.89},
+		{amount: 0.1 + 0.2, want: 0.3},
+	}
+
+	for _, tt := range tests {
+		if got := Round(tt.amount); got != tt.want {
+			t.Errorf("Round(%v) = %v, want %v", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMonto(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{amount: 0, want: "0.00"},
+		{amount: 999.999, want: "1,000.00"},
+		{amount: 15109.885, want: "15,109.89"},
+		{amount: -1234567.5, want: "-1,234,567.50"},
+		{amount: -0.001, want: "0.00"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatMonto(tt.amount); got != tt.want {
+			t.Errorf("FormatMonto(%v) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestRecalcular(t *testing.T) {
+	porcentaje := func(value float64) *float64 { return &value }
+
+	tests := []struct {
+		name          string
+		doc           Presupuesto
+		want          Totales
+		discrepancies []string
+	}{
+		{
+			name: "ítems correctos con ITBIS",
+			doc: Presupuesto{
+				Datos: Datos{ItbisPorcentaje: 18},
+				Presupuesto: Partidas{Presupuesto: []Item{
+					{Cantidad: 2, Precio: 50, Total: 100},
+					{Cantidad: 1, Precio: 100, Total: 100, Children: []Item{
+						{Cantidad: 4, Precio: 25, Total: 100},
+					}},
+				}},
+			},
+			want: Totales{Directos: 200, Subtotal: 200, Base: 200, ITBIS: 36, Total: 236},
+		},
+		{
+			name: "total de línea y padre corregidos",
+			doc: Presupuesto{
+				Presupuesto: Partidas{Presupuesto: []Item{
+					{Cantidad: 2, Precio: 10, Total: 150, Children: []Item{
+						{Cantidad: 3, Precio: 10, Total: 35.4},
+						{Cantidad: 1, Precio: 10, Total: 10},
+					}},
+				}},
+			},
+			want: Totales{Directos: 40, Subtotal: 40, Base: 40, Total: 40},
+			discrepancies: []string{
+				"presupuesto.presupuesto[0].children[0].total",
+				"presupuesto.presupuesto[0].total",
+				"presupuesto.presupuesto[0].precio",
+			},
+		},
+		{
+			name: "indirectos en porcentaje, forma corta y monto fijo",
+			doc: Presupuesto{
+				Presupuesto: Partidas{
+					Presupuesto: []Item{{Cantidad: 1, Precio: 1000, Total: 1000}},
+					Indirectos: []Item{
+						{Unidad: UnidadPorcentaje, Cantidad: 1, Precio: 10, Total: 100},
+						{Porcentaje: porcentaje(5), Total: 0},
+						{Monto: porcentaje(250), Total: 250},
+					},
+				},
+			},
+			want:          Totales{Directos: 1000, Indirectos: 400, Subtotal: 1400, Base: 1400, Total: 1400},
+			discrepancies: []string{"presupuesto.indirectos[1].total"},
+		},
+		{
+			name: "descuento, ITBIS y retención sobre la base",
+			doc: Presupuesto{
+				Datos: Datos{DescuentoPorcentaje: 10, ItbisPorcentaje: 18, RetencionPorcentaje: 2.75},
+				Presupuesto: Partidas{Presupuesto: []Item{
+					{Cantidad: 3, Precio: 333.33, Total: 999.99},
+				}},
+			},
+			want: Totales{Directos: 999.99, Subtotal: 999.99, Descuento: 100, Base: 899.99, ITBIS: 162, Retencion: 24.75, Total: 1037.24},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			totales, discrepancies := tt.doc.Recalcular()
+			if totales != tt.want {
+				t.Errorf("totales = %+v, want %+v", totales, tt.want)
+			}
+
+			var paths []string
+			for _, discrepancy := range discrepancies {
+				paths = append(paths, discrepancy.Path)
+			}
+			if len(paths) != len(tt.discrepancies) {
+				t.Fatalf("discrepancias = %q, want %q", paths, tt.discrepancies)
+			}
+			for i := range paths {
+				if paths[i] != tt.discrepancies[i] {
+					t.Errorf("discrepancia %d = %s, want %s", i, paths[i], tt.discrepancies[i])
+				}
+			}
+
+			if again := tt.doc.Discrepancias(); len(again) != 0 {
+				t.Errorf("tras recalcular quedan discrepancias: %v", again)
+			}
+		})
+	}
+}
+
+// The model copies the example, so its totals must already add up
+func TestExampleHasNoDiscrepancies(t *testing.T) {
+	data, err := assets.GetPresupuestoExample()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, problems, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("el ejemplo no cumple el formato: %v", problems)
+	}
+	for _, discrepancy := range doc.Discrepancias() {
+		t.Errorf("el ejemplo no cuadra: %s", discrepancy)
+	}
+}
@@ -0,0 +1,437 @@
+package presupuesto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// SyntaxError is a JSON5 error with its position
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+// Error returns the error with its line and column
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("línea %d, columna %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ParseJSON5 parses JSON5 (comments, trailing commas, single quoted strings,
+// unquoted keys, hexadecimal and leading or trailing decimal point numbers)
+// and returns the equivalent indented JSON
+func ParseJSON5(data []byte) ([]byte, error) {
+	p := &json5Parser{data: data}
+
+	p.skipSpace()
+	if p.err == nil {
+		p.parseValue()
+	}
+	if p.err == nil {
+		p.skipSpace()
+		if p.err == nil && p.pos < len(p.data) {
+			p.fail("contenido inesperado después del valor")
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, p.out.Bytes(), "", "  "); err != nil {
+		return nil, fmt.Errorf("error formateando JSON: %w", err)
+	}
+	return indented.Bytes(), nil
+}
+
+// json5Parser converts JSON5 to JSON in a single pass
+type json5Parser struct {
+	data []byte
+	pos  int
+	out  bytes.Buffer
+	err  *SyntaxError
+}
+
+// fail records the first error at the current position
+func (p *json5Parser) fail(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	p.err = positionError(p.data, p.pos, fmt.Sprintf(format, args...))
+}
+
+// positionError builds a SyntaxError for a byte offset
+func positionError(data []byte, offset int, msg string) *SyntaxError {
+	offset = min(offset, len(data))
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := utf8.RuneCount(before[bytes.LastIndexByte(before, '\n')+1:]) + 1
+	return &SyntaxError{Line: line, Column: column, Msg: msg}
+}
+
+// peek returns the current byte, or 0 at the end
+func (p *json5Parser) peek() byte {
+	if p.pos >= len(p.data) {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+// skipSpace skips whitespace and comments
+func (p *json5Parser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			p.pos++
+		case c == 0xC2 && p.pos+1 < len(p.data) && p.data[p.pos+1] == 0xA0:
+			// Non-breaking space
+			p.pos += 2
+		case c == '/' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '/':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '/' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '*':
+			end := bytes.Index(p.data[p.pos+2:], []byte("*/"))
+			if end == -1 {
+				p.fail("comentario /* sin cerrar")
+				return
+			}
+			p.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+// parseValue converts any value
+func (p *json5Parser) parseValue() {
+	switch c := p.peek(); {
+	case c == '{':
+		p.parseObject()
+	case c == '[':
+		p.parseArray()
+	case c == '"' || c == '\'':
+		p.parseString()
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		p.parseNumber()
+	case isIdentStart(c):
+		start := p.pos
+		word := p.parseIdentifier()
+		switch word {
+		case "true", "false", "null":
+			p.out.WriteString(word)
+		case "Infinity", "NaN":
+			p.pos = start
+			p.fail("%s no se puede representar en JSON", word)
+		default:
+			p.pos = start
+			p.fail("valor inesperado %q", word)
+		}
+	case c == 0:
+		p.fail("fin inesperado; falta un valor")
+	default:
+		p.fail("carácter inesperado %q", p.currentRune())
+	}
+}
+
+// parseObject converts an object, allowing unquoted keys and a trailing comma
+func (p *json5Parser) parseObject() {
+	p.pos++
+	p.out.WriteByte('{')
+
+	first := true
+	for p.err == nil {
+		p.skipSpace()
+		if p.err != nil {
+			return
+		}
+		if p.peek() == '}' {
+			p.pos++
+			p.out.WriteByte('}')
+			return
+		}
+		if !first {
+			p.out.WriteByte(',')
+		}
+		first = false
+
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			p.parseString()
+		case isIdentStart(c):
+			writeJSONString(&p.out, p.parseIdentifier())
+		case c == 0:
+			p.fail("fin inesperado; falta cerrar un objeto con '}'")
+			return
+		default:
+			p.fail("se esperaba el nombre de un campo, se encontró %q", p.currentRune())
+			return
+		}
+
+		p.skipSpace()
+		if p.err != nil {
+			return
+		}
+		if p.peek() != ':' {
+			p.fail("se esperaba ':' después del nombre del campo")
+			return
+		}
+		p.pos++
+		p.out.WriteByte(':')
+
+		p.skipSpace()
+		if p.err != nil {
+			return
+		}
+		p.parseValue()
+
+		p.skipSpace()
+		if p.err != nil {
+			return
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		case 0:
+			p.fail("fin inesperado; falta cerrar un objeto con '}'")
+		default:
+			p.fail("se esperaba ',' o '}', se encontró %q", p.currentRune())
+		}
+	}
+}
+
+// parseArray converts an array, allowing a trailing comma
+func (p *json5Parser) parseArray() {
+	p.pos++
+	p.out.WriteByte('[')
+
+	first := true
+	for p.err == nil {
+		p.skipSpace()
+		if p.err != nil {
+			return
+		}
+		if p.peek() == ']' {
+			p.pos++
+			p.out.WriteByte(']')
+			return
+		}
+		if !first {
+			p.out.WriteByte(',')
+		}
+		first = false
+
+		p.parseValue()
+
+		p.skipSpace()
+		if p.err != nil {
+			return
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		case 0:
+			p.fail("fin inesperado; falta cerrar una lista con ']'")
+		default:
+			p.fail("se esperaba ',' o ']', se encontró %q", p.currentRune())
+		}
+	}
+}
+
+// parseString converts a single or double quoted string
+func (p *json5Parser) parseString() {
+	quote := p.data[p.pos]
+	start := p.pos
+	p.pos++
+
+	var s strings.Builder
+	for {
+		if p.pos >= len(p.data) {
+			p.pos = start
+			p.fail("texto sin cerrar")
+			return
+		}
+
+		c := p.data[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			writeJSONString(&p.out, s.String())
+			return
+		case c == '\n':
+			p.fail("salto de línea dentro de un texto")
+			return
+		case c == '\\':
+			p.pos++
+			if !p.parseEscape(&s) {
+				return
+			}
+		default:
+			r, size := utf8.DecodeRune(p.data[p.pos:])
+			s.WriteRune(r)
+			p.pos += size
+		}
+	}
+}
+
+// parseEscape decodes the escape sequence after a backslash
+func (p *json5Parser) parseEscape(s *strings.Builder) bool {
+	if p.pos >= len(p.data) {
+		p.fail("escape incompleto")
+		return false
+	}
+
+	c := p.data[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		s.WriteByte('\b')
+	case 'f':
+		s.WriteByte('\f')
+	case 'n':
+		s.WriteByte('\n')
+	case 'r':
+		s.WriteByte('\r')
+	case 't':
+		s.WriteByte('\t')
+	case 'v':
+		s.WriteByte('\v')
+	case '0':
+		s.WriteByte(0)
+	case '\n':
+		// Line continuation
+	case '\r':
+		if p.peek() == '\n' {
+			p.pos++
+		}
+	case 'x':
+		value, ok := p.parseHex(2)
+		if !ok {
+			return false
+		}
+		s.WriteRune(rune(value))
+	case 'u':
+		value, ok := p.parseHex(4)
+		if !ok {
+			return false
+		}
+		r := rune(value)
+		if utf16.IsSurrogate(r) && strings.HasPrefix(string(p.data[p.pos:min(p.pos+2, len(p.data))]), `\u`) {
+			p.pos += 2
+			low, ok := p.parseHex(4)
+			if !ok {
+				return false
+			}
+			r = utf16.DecodeRune(r, rune(low))
+		}
+		s.WriteRune(r)
+	default:
+		// \" \' \\ \/ and any other character stand for themselves
+		p.pos--
+		r, size := utf8.DecodeRune(p.data[p.pos:])
+		s.WriteRune(r)
+		p.pos += size
+	}
+	return true
+}
+
+// parseHex reads n hexadecimal digits
+func (p *json5Parser) parseHex(n int) (uint64, bool) {
+	if p.pos+n > len(p.data) {
+		p.fail("escape incompleto")
+		return 0, false
+	}
+	value, err := strconv.ParseUint(string(p.data[p.pos:p.pos+n]), 16, 32)
+	if err != nil {
+		p.fail("escape inválido")
+		return 0, false
+	}
+	p.pos += n
+	return value, true
+}
+
+// parseNumber converts a number to JSON notation
+func (p *json5Parser) parseNumber() {
+	start := p.pos
+	for p.pos < len(p.data) && strings.IndexByte("+-.0123456789abcdefABCDEFxX", p.data[p.pos]) >= 0 {
+		p.pos++
+	}
+	text := string(p.data[start:p.pos])
+
+	number := strings.TrimPrefix(text, "+")
+	negative := strings.HasPrefix(number, "-")
+	digits := strings.TrimPrefix(number, "-")
+
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		value, err := strconv.ParseUint(digits[2:], 16, 64)
+		if err != nil {
+			p.pos = start
+			p.fail("número hexadecimal inválido %q", text)
+			return
+		}
+		if negative {
+			p.out.WriteByte('-')
+		}
+		p.out.WriteString(strconv.FormatUint(value, 10))
+		return
+	}
+
+	if strings.HasPrefix(digits, ".") {
+		digits = "0" + digits
+	}
+	digits = strings.Replace(digits, ".e", "e", 1)
+	digits = strings.Replace(digits, ".E", "E", 1)
+	digits = strings.TrimSuffix(digits, ".")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		digits = strings.TrimLeft(digits, "0")
+		if digits == "" || digits[0] == '.' || digits[0] == 'e' || digits[0] == 'E' {
+			digits = "0" + digits
+		}
+	}
+
+	if _, err := strconv.ParseFloat(digits, 64); err != nil || !json.Valid([]byte(digits)) {
+		p.pos = start
+		p.fail("número inválido %q", text)
+		return
+	}
+	if negative {
+		p.out.WriteByte('-')
+	}
+	p.out.WriteString(digits)
+}
+
+// parseIdentifier reads an unquoted key or keyword
+func (p *json5Parser) parseIdentifier() string {
+	start := p.pos
+	for p.pos < len(p.data) && (isIdentStart(p.data[p.pos]) || (p.data[p.pos] >= '0' && p.data[p.pos] <= '9')) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// currentRune returns the character at the current position
+func (p *json5Parser) currentRune() rune {
+	r, _ := utf8.DecodeRune(p.data[p.pos:])
+	return r
+}
+
+// isIdentStart reports whether c can start an unquoted key
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// writeJSONString writes s as a JSON string without escaping HTML
+func writeJSONString(out *bytes.Buffer, s string) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	out.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
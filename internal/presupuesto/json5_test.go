@@ -0,0 +1,56 @@
+package presupuesto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseJSON5(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   string
+		line   int
+		column int
+	}{
+		{name: "JSON normal", input: `{"a": [1, "b", true, null]}`, want: `{"a":[1,"b",true,null]}`},
+		{name: "comentario de línea", input: "{\n  // nota\n  \"a\": 1\n}", want: `{"a":1}`},
+		{name: "comentario de bloque", input: `{/* nota */ "a": 1}`, want: `{"a":1}`},
+		{name: "comas finales", input: `{"a": [1, 2,], "b": 3,}`, want: `{"a":[1,2],"b":3}`},
+		{name: "comillas simples", input: `{'a': 'dijo "hola"'}`, want: `{"a":"dijo \"hola\""}`},
+		{name: "claves sin comillas", input: `{total_item: 1, $id: 2}`, want: `{"$id":2,"total_item":1}`},
+		{name: "hexadecimal", input: `{"a": 0x1F}`, want: `{"a":31}`},
+		{name: "punto decimal al inicio y al final", input: `[.5, 5., +1, -2]`, want: `[0.5,5,1,-2]`},
+		{name: "escapes", input: `["á\t", 'it\'s']`, want: `["á\t","it's"]`},
+		{name: "texto con salto escapado", input: "['uno\\\ndos']", want: `["unodos"]`},
+		{name: "falta cerrar objeto", input: "{\n  \"a\": 1\n", line: 3, column: 1},
+		{name: "falta valor", input: `{"a": }`, line: 1, column: 7},
+		{name: "valor inesperado", input: `{"a": verdadero}`, line: 1, column: 7},
+		{name: "infinito", input: `[Infinity]`, line: 1, column: 2},
+		{name: "texto sin cerrar", input: `["abc`, line: 1, column: 2},
+		{name: "contenido sobrante", input: `{} {}`, line: 1, column: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ParseJSON5([]byte(tt.input))
+			if tt.line == 0 {
+				if err != nil {
+					t.Fatalf("ParseJSON5 error = %v", err)
+				}
+				if got := compactJSON(t, out); got != tt.want {
+					t.Errorf("ParseJSON5 = %s, want %s", got, tt.want)
+				}
+				return
+			}
+
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("ParseJSON5 error = %v, want *SyntaxError", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+				t.Errorf("posición = %d:%d, want %d:%d (%v)", syntaxErr.Line, syntaxErr.Column, tt.line, tt.column, syntaxErr)
+			}
+		})
+	}
+}
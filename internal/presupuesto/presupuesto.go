@@ -0,0 +1,416 @@
+package presupuesto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"orgmprop/internal/config"
+)
+
+// FileName is the budget stored in a project's Oferta folder
+const FileName = "presupuesto.json"
+
+// Presupuesto is a cotización as described by the example of presupuesto.yaml
+type Presupuesto struct {
+	Datos       Datos    `json:"datos"`
+	Notas       Notas    `json:"notas"`
+	Presupuesto Partidas `json:"presupuesto"`
+}
+
+// Datos holds the client, project and commercial terms of a cotización
+type Datos struct {
+	IDCotizacion       string `json:"id_cotizacion"`
+	IDCliente          string `json:"id_cliente"`
+	Cliente            string `json:"cliente"`
+	RNC                string `json:"rnc"`
+	BR                 string `json:"br"`
+	Contacto           string `json:"contacto"`
+	Fecha              string `json:"fecha"`
+	Proyecto           string `json:"proyecto"`
+	Ubicacion          string `json:"ubicacion"`
+	Servicio           string `json:"servicio"`
+	ServicioCategoria  string `json:"servicio_categoria"`
+	DescripcionGeneral string `json:"descripcion_general"`
+	TiempoEntrega      string `json:"tiempo_entrega"`
+	DiasValidez        string `json:"dias_validez"`
+	FormatoPago        string `json:"formato_pago"`
+
+	DescuentoPorcentaje float64 `json:"descuento_porcentaje"`
+	ItbisPorcentaje     float64 `json:"itbis_porcentaje"`
+	RetencionPorcentaje float64 `json:"retencion_porcentaje"`
+
+	// Tenant is the company that issues the cotización
+	Tenant      config.Tenant `json:"tenant"`
+	ClienteLogo string        `json:"cliente_logo"`
+}
+
+// Notas are the numbered notes of a cotización, keyed "1" to "5"
+type Notas map[string]string
+
+// Partidas holds the indirect costs and the items of a cotización
+type Partidas struct {
+	Indirectos  []Item `json:"indirectos"`
+	Presupuesto []Item `json:"presupuesto"`
+}
+
+// Item is a line of the budget. Top-level items group their products in
+// Children; an item with children totals the sum of them.
+type Item struct {
+	ID          string  `json:"id"`
+	Item        string  `json:"item"`
+	Descripcion string  `json:"descripcion"`
+	Cantidad    float64 `json:"cantidad"`
+	Unidad      string  `json:"unidad"`
+	Precio      float64 `json:"precio"`
+	Total       float64 `json:"total"`
+	Moneda      string  `json:"moneda,omitempty"`
+	Categoria   string  `json:"categoria,omitempty"`
+	Children    []Item  `json:"children,omitempty"`
+
+	// Porcentaje and Monto are the alternative form of an indirecto
+	// described in the system prompt
+	Porcentaje *float64 `json:"porcentaje,omitempty"`
+	Monto      *float64 `json:"monto,omitempty"`
+
+	// present records the optional fields the parsed item had, which are
+	// written back even when empty
+	present struct{ moneda, categoria, children bool }
+}
+
+// MarshalJSON writes moneda, categoria and children when they are set or the
+// parsed item had them, so a saved file keeps the shape it was read with
+func (i Item) MarshalJSON() ([]byte, error) {
+	type plain Item
+	out := struct {
+		plain
+		Moneda    *string `json:"moneda,omitempty"`
+		Categoria *string `json:"categoria,omitempty"`
+		Children  *[]Item `json:"children,omitempty"`
+	}{plain: plain(i)}
+
+	if i.Moneda != "" || i.present.moneda {
+		out.Moneda = &i.Moneda
+	}
+	if i.Categoria != "" || i.present.categoria {
+		out.Categoria = &i.Categoria
+	}
+	if len(i.Children) > 0 || i.present.children {
+		children := i.Children
+		if children == nil {
+			children = []Item{}
+		}
+		out.Children = &children
+	}
+	return json.Marshal(out)
+}
+
+// keepPresentFields records which optional fields each parsed item had in
+// the decoded JSON list raw
+func keepPresentFields(raw interface{}, items []Item) {
+	list, _ := raw.([]interface{})
+	for i := range items {
+		if i >= len(list) {
+			return
+		}
+		object, ok := list[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		_, items[i].present.moneda = object["moneda"]
+		_, items[i].present.categoria = object["categoria"]
+		_, items[i].present.children = object["children"]
+		keepPresentFields(object["children"], items[i].Children)
+	}
+}
+
+// shortFormFields are the fields an indirecto written as {id, descripcion,
+// porcentaje, monto} leaves out
+var shortFormFields = []string{"item", "cantidad", "unidad", "precio", "total"}
+
+// optionalFields returns the required fields that object may omit: an item
+// with porcentaje or monto uses the short form of an indirecto
+func (Item) optionalFields(object map[string]interface{}) []string {
+	_, porcentaje := object["porcentaje"]
+	_, monto := object["monto"]
+	if porcentaje || monto {
+		return shortFormFields
+	}
+	return nil
+}
+
+// optionalFielder is implemented by types whose required fields depend on
+// the object being decoded
+type optionalFielder interface {
+	optionalFields(object map[string]interface{}) []string
+}
+
+// Problem is a field that is unknown, missing or of the wrong type
+type Problem struct {
+	// Path is the location of the field, as presupuesto.presupuesto[0].total
+	Path    string
+	Message string
+}
+
+// String returns the problem with its path
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+// DecodeError lists every problem found by Decode
+type DecodeError struct {
+	Problems []Problem
+}
+
+// Error joins the problems
+func (e *DecodeError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = problem.String()
+	}
+	return fmt.Sprintf("presupuesto inválido (%d problemas):\n  %s", len(lines), strings.Join(lines, "\n  "))
+}
+
+// Lista returns the notes that are not empty, in numeric order
+func (n Notas) Lista() []string {
+	keys := make([]string, 0, len(n))
+	for key := range n {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.Atoi(keys[i])
+		b, errB := strconv.Atoi(keys[j])
+		if errA != nil || errB != nil {
+			return keys[i] < keys[j]
+		}
+		return a < b
+	})
+
+	var notas []string
+	for _, key := range keys {
+		if nota := strings.TrimSpace(n[key]); nota != "" {
+			notas = append(notas, nota)
+		}
+	}
+	return notas
+}
+
+// Parse decodes a presupuesto. Syntax errors fail; unknown fields, missing
+// fields and wrong types are returned as problems, with the fields that could
+// be decoded filled in.
+func Parse(data []byte) (*Presupuesto, []Problem, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("error parseando presupuesto: %w", err)
+	}
+	if _, ok := raw.(map[string]interface{}); !ok {
+		return nil, nil, fmt.Errorf("el presupuesto debe ser un objeto JSON")
+	}
+
+	var problems []Problem
+	checkValue(raw, reflect.TypeOf(Presupuesto{}), "", &problems)
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+
+	var doc Presupuesto
+	if err := json.Unmarshal(data, &doc); err != nil {
+		// Type errors are already in problems; decoding keeps going past them
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			return nil, nil, fmt.Errorf("error decodificando presupuesto: %w", err)
+		}
+	}
+
+	if partidas, ok := raw.(map[string]interface{})["presupuesto"].(map[string]interface{}); ok {
+		keepPresentFields(partidas["indirectos"], doc.Presupuesto.Indirectos)
+		keepPresentFields(partidas["presupuesto"], doc.Presupuesto.Presupuesto)
+	}
+
+	return &doc, problems, nil
+}
+
+// Decode decodes a presupuesto strictly, failing with a DecodeError that
+// lists every unknown, missing or mistyped field
+func Decode(data []byte) (*Presupuesto, error) {
+	doc, problems, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, &DecodeError{Problems: problems}
+	}
+	return doc, nil
+}
+
+// Load reads and strictly decodes a presupuesto file
+func Load(path string) (*Presupuesto, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", path, err)
+	}
+
+	doc, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// Marshal encodes a presupuesto with indentation
+func (p *Presupuesto) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(p); err != nil {
+		return nil, fmt.Errorf("error serializando presupuesto: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Save writes a presupuesto file
+func (p *Presupuesto) Save(path string) error {
+	data, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error guardando %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkValue compares a decoded JSON value with the Go type it maps to
+func checkValue(value interface{}, t reflect.Type, path string, problems *[]Problem) {
+	if t.Kind() == reflect.Ptr {
+		if value == nil {
+			return
+		}
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			*problems = append(*problems, Problem{Path: displayPath(path), Message: fmt.Sprintf("se esperaba un objeto, se encontró %s", jsonType(value))})
+			return
+		}
+
+		fields := jsonFields(t)
+		optional := map[string]bool{}
+		if fielder, ok := reflect.Zero(t).Interface().(optionalFielder); ok {
+			for _, name := range fielder.optionalFields(object) {
+				optional[name] = true
+			}
+		}
+		for name, field := range fields {
+			if _, ok := object[name]; !ok && field.required && !optional[name] {
+				*problems = append(*problems, Problem{Path: joinPath(path, name), Message: "campo requerido ausente"})
+			}
+		}
+		for name, fieldValue := range object {
+			field, ok := fields[name]
+			if !ok {
+				*problems = append(*problems, Problem{Path: joinPath(path, name), Message: "campo desconocido"})
+				continue
+			}
+			checkValue(fieldValue, field.typ, joinPath(path, name), problems)
+		}
+
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			if value != nil {
+				*problems = append(*problems, Problem{Path: displayPath(path), Message: fmt.Sprintf("se esperaba una lista, se encontró %s", jsonType(value))})
+			}
+			return
+		}
+		for i, item := range items {
+			checkValue(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			*problems = append(*problems, Problem{Path: displayPath(path), Message: fmt.Sprintf("se esperaba un objeto, se encontró %s", jsonType(value))})
+			return
+		}
+		for key, item := range object {
+			checkValue(item, t.Elem(), joinPath(path, key), problems)
+		}
+
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			*problems = append(*problems, Problem{Path: displayPath(path), Message: fmt.Sprintf("se esperaba texto, se encontró %s", jsonType(value))})
+		}
+
+	case reflect.Float64:
+		if _, ok := value.(float64); !ok {
+			*problems = append(*problems, Problem{Path: displayPath(path), Message: fmt.Sprintf("se esperaba un número, se encontró %s", jsonType(value))})
+		}
+	}
+}
+
+// jsonField is a field of a struct as seen by encoding/json
+type jsonField struct {
+	typ      reflect.Type
+	required bool
+}
+
+// jsonFields maps the json names of a struct to their types. Fields without
+// omitempty are required.
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := map[string]jsonField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = jsonField{typ: field.Type, required: !strings.Contains(options, "omitempty")}
+	}
+	return fields
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "texto"
+	case float64:
+		return "número"
+	case bool:
+		return "booleano"
+	case []interface{}:
+		return "lista"
+	default:
+		return "objeto"
+	}
+}
+
+// joinPath appends a field to a path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// displayPath names the document root
+func displayPath(path string) string {
+	if path == "" {
+		return "(raíz)"
+	}
+	return path
+}
@@ -0,0 +1,313 @@
+package presupuesto
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"orgmprop/assets"
+)
+
+// exampleDoc returns the embedded example as generic JSON
+func exampleDoc(t *testing.T) map[string]interface{} {
+	t.Helper()
+	data, err := assets.GetPresupuestoExample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// object returns the object at a path of keys and list indexes
+func object(doc map[string]interface{}, path ...interface{}) map[string]interface{} {
+	var value interface{} = doc
+	for _, step := range path {
+		switch step := step.(type) {
+		case string:
+			value = value.(map[string]interface{})[step]
+		case int:
+			value = value.([]interface{})[step]
+		}
+	}
+	return value.(map[string]interface{})
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		mutate func(doc map[string]interface{})
+		want   []string
+		// wantErr is a syntax or root error, not a problem
+		wantErr bool
+	}{
+		{name: "ejemplo"},
+		{
+			name:   "campo desconocido",
+			mutate: func(doc map[string]interface{}) { object(doc, "datos")["extra"] = 1.0 },
+			want:   []string{"datos.extra: campo desconocido"},
+		},
+		{
+			name: "campo desconocido en un producto",
+			mutate: func(doc map[string]interface{}) {
+				object(doc, "presupuesto", "presupuesto", 0, "children", 1)["marca"] = "x"
+			},
+			want: []string{"presupuesto.presupuesto[0].children[1].marca: campo desconocido"},
+		},
+		{
+			name:   "número como texto",
+			mutate: func(doc map[string]interface{}) { object(doc, "datos")["itbis_porcentaje"] = "18" },
+			want:   []string{"datos.itbis_porcentaje: se esperaba un número, se encontró texto"},
+		},
+		{
+			name:   "texto como número",
+			mutate: func(doc map[string]interface{}) { object(doc, "presupuesto", "indirectos", 0)["unidad"] = 1.0 },
+			want:   []string{"presupuesto.indirectos[0].unidad: se esperaba texto, se encontró número"},
+		},
+		{
+			name:   "lista como objeto",
+			mutate: func(doc map[string]interface{}) { object(doc, "presupuesto")["indirectos"] = map[string]interface{}{} },
+			want:   []string{"presupuesto.indirectos: se esperaba una lista, se encontró objeto"},
+		},
+		{
+			name:   "notas como lista",
+			mutate: func(doc map[string]interface{}) { doc["notas"] = []interface{}{"a"} },
+			want:   []string{"notas: se esperaba un objeto, se encontró lista"},
+		},
+		{
+			name:   "texto ausente",
+			mutate: func(doc map[string]interface{}) { delete(object(doc, "datos"), "cliente") },
+			want:   []string{"datos.cliente: campo requerido ausente"},
+		},
+		{
+			name:   "texto null",
+			mutate: func(doc map[string]interface{}) { object(doc, "datos")["cliente"] = nil },
+			want:   []string{"datos.cliente: se esperaba texto, se encontró null"},
+		},
+		{
+			name:   "objeto null",
+			mutate: func(doc map[string]interface{}) { object(doc, "datos")["tenant"] = nil },
+			want:   []string{"datos.tenant: se esperaba un objeto, se encontró null"},
+		},
+		{
+			name:   "lista null",
+			mutate: func(doc map[string]interface{}) { object(doc, "presupuesto", "indirectos", 0)["children"] = nil },
+		},
+		{
+			name:   "opcional ausente",
+			mutate: func(doc map[string]interface{}) { delete(object(doc, "presupuesto", "indirectos", 0), "moneda") },
+		},
+		{
+			name: "indirecto en forma corta",
+			mutate: func(doc map[string]interface{}) {
+				object(doc, "presupuesto")["indirectos"] = []interface{}{
+					map[string]interface{}{"id": "ind001", "descripcion": "DIRECCION TECNICA", "porcentaje": 10.0, "monto": 1500.0},
+					map[string]interface{}{"id": "ind002", "descripcion": "TRANSPORTE", "monto": 800.0},
+				}
+			},
+		},
+		{
+			name: "indirecto en forma corta con porcentaje null",
+			mutate: func(doc map[string]interface{}) {
+				object(doc, "presupuesto")["indirectos"] = []interface{}{
+					map[string]interface{}{"id": "ind001", "descripcion": "DIRECCION TECNICA", "porcentaje": nil},
+				}
+			},
+		},
+		{
+			name: "indirecto incompleto",
+			mutate: func(doc map[string]interface{}) {
+				object(doc, "presupuesto")["indirectos"] = []interface{}{
+					map[string]interface{}{"id": "ind001", "descripcion": "DIRECCION TECNICA"},
+				}
+			},
+			want: []string{
+				"presupuesto.indirectos[0].cantidad: campo requerido ausente",
+				"presupuesto.indirectos[0].item: campo requerido ausente",
+				"presupuesto.indirectos[0].precio: campo requerido ausente",
+				"presupuesto.indirectos[0].total: campo requerido ausente",
+				"presupuesto.indirectos[0].unidad: campo requerido ausente",
+			},
+		},
+		{name: "JSON inválido", data: `{"datos": `, wantErr: true},
+		{name: "raíz que no es objeto", data: `[]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			if tt.data == "" {
+				doc := exampleDoc(t)
+				if tt.mutate != nil {
+					tt.mutate(doc)
+				}
+				var err error
+				if data, err = json.Marshal(doc); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			doc, problems, err := Parse(data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Parse succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if doc == nil {
+				t.Fatal("Parse returned no document")
+			}
+
+			var got []string
+			for _, problem := range problems {
+				got = append(got, problem.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKeepsDecodedFields(t *testing.T) {
+	doc := exampleDoc(t)
+	object(doc, "datos")["itbis_porcentaje"] = "18"
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, problems, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 {
+		t.Errorf("problems = %v, want one", problems)
+	}
+	if parsed.Datos.Cliente == "" || len(parsed.Presupuesto.Presupuesto) == 0 {
+		t.Errorf("Parse dropped the fields after a type error: %+v", parsed.Datos)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	doc := exampleDoc(t)
+	valid, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	object(doc, "datos")["extra"] = true
+	delete(object(doc, "datos"), "cliente")
+	invalid, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decode(valid); err != nil {
+		t.Errorf("Decode(example) = %v, want nil", err)
+	}
+
+	_, err = Decode(invalid)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Decode error = %v, want a DecodeError", err)
+	}
+	if len(decodeErr.Problems) != 2 || !strings.Contains(err.Error(), "2 problemas") {
+		t.Errorf("Decode error = %v, want 2 problems", err)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "ejemplo"},
+		{
+			name: "opcionales vacíos y ausentes",
+			data: `{"datos": {}, "notas": {}, "presupuesto": {
+				"indirectos": [{"id": "i", "descripcion": "d", "porcentaje": 2}],
+				"presupuesto": [
+					{"id": "a", "moneda": "", "categoria": "", "children": []},
+					{"id": "b", "children": [{"id": "b_1"}, {"id": "b_2", "moneda": "RD$"}]},
+					{"id": "c"}
+				]
+			}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			if tt.data == "" {
+				var err error
+				if data, err = assets.GetPresupuestoExample(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			doc, _, err := Parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved, err := doc.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Fields the Go types fill in with zero values are added, but no
+			// field the input had is dropped
+			var original, got map[string]interface{}
+			if err := json.Unmarshal(data, &original); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(saved, &got); err != nil {
+				t.Fatal(err)
+			}
+			assertSubset(t, "", original, got)
+		})
+	}
+}
+
+// assertSubset checks that every field of want is in got with the same value
+func assertSubset(t *testing.T, path string, want, got interface{}) {
+	t.Helper()
+	switch want := want.(type) {
+	case map[string]interface{}:
+		object, ok := got.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s = %v, want an object", path, got)
+			return
+		}
+		for key, value := range want {
+			gotValue, ok := object[key]
+			if !ok {
+				t.Errorf("%s.%s dropped on save", path, key)
+				continue
+			}
+			assertSubset(t, path+"."+key, value, gotValue)
+		}
+	case []interface{}:
+		list, ok := got.([]interface{})
+		if !ok || len(list) != len(want) {
+			t.Errorf("%s = %v, want %v", path, got, want)
+			return
+		}
+		for i := range want {
+			assertSubset(t, path+"["+strconv.Itoa(i)+"]", want[i], list[i])
+		}
+	default:
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package presupuesto
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxRepairCuts bounds how many incomplete trailing elements are dropped
+// when closing a truncated response
+const maxRepairCuts = 20
+
+// RepairJSON fixes the usual defects of JSON written by a model: smart
+// quotes, comments, trailing commas, raw line breaks inside strings and a
+// truncated tail, closing the open strings and brackets. It returns the
+// repaired, indented JSON and a description of every change; valid JSON is
+// returned unchanged.
+func RepairJSON(text string) ([]byte, []string, error) {
+	if json.Valid([]byte(text)) {
+		return []byte(text), nil, nil
+	}
+
+	var fixes []string
+	s := scanJSON(text)
+	cleaned := s.out.String()
+
+	if s.smartQuotes > 0 {
+		fixes = append(fixes, fmt.Sprintf("comillas tipográficas reemplazadas: %d", s.smartQuotes))
+	}
+	if s.comments > 0 {
+		fixes = append(fixes, fmt.Sprintf("comentarios eliminados: %d", s.comments))
+	}
+	if s.trailingCommas > 0 {
+		fixes = append(fixes, fmt.Sprintf("comas finales eliminadas: %d", s.trailingCommas))
+	}
+	if s.newlines > 0 {
+		fixes = append(fixes, fmt.Sprintf("saltos de línea escapados dentro de textos: %d", s.newlines))
+	}
+
+	if s.inString || len(s.stack) > 0 {
+		closed, closeFixes, err := closeTruncated(cleaned)
+		if err != nil {
+			return nil, fixes, err
+		}
+		cleaned = closed
+		fixes = append(fixes, closeFixes...)
+	}
+
+	repaired, err := ParseJSON5([]byte(cleaned))
+	if err != nil {
+		return nil, fixes, fmt.Errorf("JSON irreparable: %w", err)
+	}
+	if !json.Valid([]byte(cleaned)) {
+		fixes = append(fixes, "sintaxis JSON5 normalizada (comillas simples o claves sin comillas)")
+	}
+
+	return repaired, fixes, nil
+}
+
+// jsonScan is the result of scanning possibly malformed JSON
+type jsonScan struct {
+	out strings.Builder
+
+	// inString and quote describe a string left open at the end
+	inString bool
+	quote    rune
+	// stack holds the closing brackets of the open objects and arrays, and
+	// opens the output offsets of their opening brackets
+	stack []rune
+	opens []int
+	// commas are the output offsets of the commas outside strings
+	commas []int
+
+	smartQuotes    int
+	comments       int
+	trailingCommas int
+	newlines       int
+}
+
+// scanJSON rewrites smart quote delimiters and raw line breaks in strings,
+// drops comments and trailing commas, and tracks the open strings and
+// brackets. Smart quotes inside regular strings are kept as text.
+func scanJSON(text string) *jsonScan {
+	s := &jsonScan{}
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		if s.inString {
+			switch {
+			case c == '\\':
+				// A backslash cut at the end is dropped with the truncated tail
+				if i+1 < len(runes) {
+					s.out.WriteRune(c)
+					i++
+					s.out.WriteRune(runes[i])
+				}
+			case c == s.quote || (s.quote == '”' && c == '"') || (s.quote == '’' && c == '\''):
+				s.inString = false
+				if c != '"' && c != '\'' {
+					s.smartQuotes++
+				}
+				s.out.WriteRune(closingQuote(s.quote))
+			case c == '\n':
+				s.newlines++
+				s.out.WriteString(`\n`)
+			case c == '\r':
+			default:
+				s.out.WriteRune(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			s.inString, s.quote = true, c
+			s.out.WriteRune(c)
+		case '“', '”', '„', '‟':
+			s.smartQuotes++
+			s.inString, s.quote = true, '”'
+			s.out.WriteRune('"')
+		case '‘', '’':
+			s.smartQuotes++
+			s.inString, s.quote = true, '’'
+			s.out.WriteRune('\'')
+		case '/':
+			if i+1 < len(runes) && runes[i+1] == '/' {
+				s.comments++
+				for i+1 < len(runes) && runes[i+1] != '\n' {
+					i++
+				}
+				continue
+			}
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				s.comments++
+				end := strings.Index(string(runes[i+2:]), "*/")
+				if end == -1 {
+					i = len(runes)
+				} else {
+					i += 2 + len([]rune(string(runes[i+2:])[:end])) + 1
+				}
+				continue
+			}
+			s.out.WriteRune(c)
+		case '{', '[':
+			if c == '{' {
+				s.stack = append(s.stack, '}')
+			} else {
+				s.stack = append(s.stack, ']')
+			}
+			s.opens = append(s.opens, s.out.Len())
+			s.out.WriteRune(c)
+		case '}', ']':
+			current := strings.TrimRight(s.out.String(), " \t\r\n")
+			if strings.HasSuffix(current, ",") {
+				s.trailingCommas++
+				s.out.Reset()
+				s.out.WriteString(strings.TrimSuffix(current, ","))
+				s.commas = s.commas[:len(s.commas)-1]
+			}
+			if len(s.stack) > 0 && s.stack[len(s.stack)-1] == c {
+				s.stack = s.stack[:len(s.stack)-1]
+				s.opens = s.opens[:len(s.opens)-1]
+			}
+			s.out.WriteRune(c)
+		case ',':
+			s.commas = append(s.commas, s.out.Len())
+			s.out.WriteRune(c)
+		default:
+			s.out.WriteRune(c)
+		}
+	}
+
+	return s
+}
+
+// closingQuote returns the straight quote that closes a string opened with quote
+func closingQuote(quote rune) rune {
+	switch quote {
+	case '\'', '’':
+		return '\''
+	default:
+		return '"'
+	}
+}
+
+// closeTruncated closes the strings and brackets left open by a truncated
+// response. When the last element is incomplete, such as a key without a
+// value or a cut number, it is dropped.
+func closeTruncated(text string) (string, []string, error) {
+	var fixes []string
+
+	for cuts := 0; cuts <= maxRepairCuts; cuts++ {
+		s := scanJSON(text)
+		closed := s.out.String()
+
+		if s.inString {
+			closed += string(closingQuote(s.quote))
+		}
+
+		// A bare scalar or a key without a value may have been cut anywhere;
+		// a comma after it shows it was complete
+		closed = strings.TrimRight(closed, " \t\r\n")
+		complete := strings.HasSuffix(closed, ",")
+		closed = strings.TrimSuffix(closed, ",")
+
+		if len(s.stack) == 0 || s.inString || complete || !incompleteTail(closed) {
+			for i := len(s.stack) - 1; i >= 0; i-- {
+				closed += string(s.stack[i])
+			}
+			if _, err := ParseJSON5([]byte(closed)); err == nil {
+				if s.inString {
+					fixes = append(fixes, "respuesta truncada: se cerró un texto abierto")
+				}
+				if len(s.stack) > 0 {
+					fixes = append(fixes, fmt.Sprintf("respuesta truncada: llaves o corchetes cerrados: %d", len(s.stack)))
+				}
+				return closed, fixes, nil
+			}
+		}
+
+		cut, ok := lastElementStart(s)
+		if !ok {
+			break
+		}
+		if cut >= len(strings.TrimRight(s.out.String(), " \t\r\n")) {
+			// The element before the trailing comma is the broken one
+			cut--
+		}
+		// Drop the incomplete element and try again
+		text = s.out.String()[:cut]
+		fixes = append(fixes, "respuesta truncada: se descartó el último elemento incompleto")
+	}
+
+	return "", fixes, fmt.Errorf("no se pudo cerrar la respuesta truncada")
+}
+
+// incompleteTail reports whether text ends in a key without a value or in a
+// bare scalar such as a number, which a truncation may have cut
+func incompleteTail(text string) bool {
+	if text == "" {
+		return false
+	}
+	switch text[len(text)-1] {
+	case '"', '\'', '}', ']', '{', '[':
+		return false
+	}
+	return true
+}
+
+// lastElementStart returns the output offset where the last element of the
+// innermost open object or array starts: after its last comma, which is kept,
+// or after the opening bracket when it has a single element
+func lastElementStart(s *jsonScan) (int, bool) {
+	if len(s.opens) == 0 {
+		return 0, false
+	}
+
+	open := s.opens[len(s.opens)-1]
+	if len(s.commas) > 0 && s.commas[len(s.commas)-1] > open {
+		return s.commas[len(s.commas)-1] + 1, true
+	}
+	if strings.TrimSpace(s.out.String()[open+1:]) == "" {
+		// The container is already empty; drop it from its parent
+		return open, true
+	}
+	return open + 1, true
+}
@@ -0,0 +1,66 @@
+package presupuesto
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// compactJSON returns data without insignificant whitespace
+func compactJSON(t *testing.T, data []byte) string {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatalf("JSON inválido %s: %v", data, err)
+	}
+	compact, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(compact)
+}
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		fixes   int
+		wantErr bool
+	}{
+		{name: "válido", input: `{"a": 1}`, want: `{"a":1}`},
+		{name: "coma final", input: `{"a": [1, 2,],}`, want: `{"a":[1,2]}`, fixes: 1},
+		{name: "comentarios", input: "{\"a\": 1 // uno\n/* dos */}", want: `{"a":1}`, fixes: 1},
+		{name: "comillas tipográficas", input: `{“a”: “b”}`, want: `{"a":"b"}`, fixes: 1},
+		{name: "comilla tipográfica dentro de texto", input: `{"a": "dijo “hola”", "b": [}`, want: `{"a":"dijo “hola”","b":[]}`, fixes: 2},
+		{name: "salto de línea en texto", input: "{\"a\": \"uno\ndos\"", want: `{"a":"uno\ndos"}`, fixes: 2},
+		{name: "texto abierto", input: `{"a": "uno`, want: `{"a":"uno"}`, fixes: 2},
+		{name: "número cortado", input: `{"a": {"total": 12`, want: `{"a":{}}`, fixes: 2},
+		{name: "número cortado tras otro campo", input: `{"a": {"cantidad": 2, "total": 12`, want: `{"a":{"cantidad":2}}`, fixes: 2},
+		{name: "literal cortado en arreglo", input: `{"a": [1, 2, tr`, want: `{"a":[1,2]}`, fixes: 2},
+		{name: "clave sin valor", input: `{"a": 1, "b":`, want: `{"a":1}`, fixes: 2},
+		{name: "clave cortada", input: `{"a": 1, "b`, want: `{"a":1}`, fixes: 2},
+		{name: "coma al final", input: `{"a": 1,`, want: `{"a":1}`, fixes: 1},
+		{name: "objeto completo sin cerrar", input: `{"a": {"b": 1}`, want: `{"a":{"b":1}}`, fixes: 1},
+		{name: "elemento de arreglo cortado", input: `{"items": [{"id": "1", "total": 5}, {"id": "2", "tot`, want: `{"items":[{"id":"1","total":5},{"id":"2"}]}`, fixes: 2},
+		{name: "claves sin comillas", input: `{a: 'b'}`, want: `{"a":"b"}`, fixes: 1},
+		{name: "irreparable", input: `{"a" 1}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repaired, fixes, err := RepairJSON(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RepairJSON error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := compactJSON(t, repaired); got != tt.want {
+				t.Errorf("RepairJSON = %s, want %s", got, tt.want)
+			}
+			if len(fixes) != tt.fixes {
+				t.Errorf("fixes = %q, want %d", fixes, tt.fixes)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package project
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -152,6 +153,47 @@ func EnsureProjectStructure(projectName string) error {
 	return nil
 }
 
+// ListRecibidoFiles lists the files received from the client in a project's
+// Recibido folder, as paths relative to it. Hidden files are skipped.
+func ListRecibidoFiles(projectPath string) ([]string, error) {
+	recibidoPath := filepath.Join(projectPath, "Recibido")
+	logger.Debug("Listando archivos recibidos en: %s", recibidoPath)
+
+	var files []string
+	err := filepath.WalkDir(recibidoPath, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != recibidoPath {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(recibidoPath, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error leyendo carpeta Recibido: %w", err)
+	}
+
+	sort.Strings(files)
+
+	logger.Debug("Encontrados %d archivos recibidos", len(files))
+	return files, nil
+}
+
 // ProposalSummary represents a summary of a proposal
 type ProposalSummary struct {
 	Project   string
@@ -318,6 +360,45 @@ func getFolderStructure() []string {
 	return defaultFolders
 }
 
+// ValidateFolderStructure checks folder.json: it must decode into
+// FolderStructure without unknown fields and define the Proyectos folders,
+// including Oferta
+func ValidateFolderStructure(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var structure FolderStructure
+	if err := decoder.Decode(&structure); err != nil {
+		return fmt.Errorf("error parseando folder.json: %w", err)
+	}
+
+	proyectos, ok := structure.Tipos["Proyectos"]
+	if !ok {
+		return fmt.Errorf("falta el tipo \"Proyectos\" en folder.json")
+	}
+	if len(proyectos.Carpetas) == 0 {
+		return fmt.Errorf("\"Proyectos\" no define carpetas")
+	}
+
+	hasOferta := false
+	for _, folder := range proyectos.Carpetas {
+		if strings.TrimSpace(folder) == "" {
+			return fmt.Errorf("\"Proyectos\" tiene una carpeta sin nombre")
+		}
+		if strings.ContainsAny(folder, `/\:*?"<>|`) {
+			return fmt.Errorf("nombre de carpeta inválido: %q", folder)
+		}
+		if folder == "Oferta" {
+			hasOferta = true
+		}
+	}
+	if !hasOferta {
+		return fmt.Errorf("\"Proyectos\" debe incluir la carpeta Oferta, donde se guardan las propuestas")
+	}
+
+	return nil
+}
+
 // sanitizeName sanitizes a name for use in file paths
 func sanitizeName(name string) string {
 	// Replace spaces with underscores
@@ -332,6 +413,27 @@ func sanitizeName(name string) string {
 	return name
 }
 
+// SplitOfertaPath returns the project folder and the Oferta folder of path,
+// which may be either of them
+func SplitOfertaPath(path string) (string, string) {
+	if filepath.Base(path) == "Oferta" {
+		return filepath.Dir(path), path
+	}
+	return path, filepath.Join(path, "Oferta")
+}
+
+// CurrentProjectDir returns the project folder of the current directory,
+// which is normally the project's Oferta folder
+func CurrentProjectDir() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("error obteniendo directorio actual: %w", err)
+	}
+
+	projectDir, _ := SplitOfertaPath(cwd)
+	return projectDir, nil
+}
+
 // ChangeToOfertaDirectory changes to the Oferta directory of a project
 func ChangeToOfertaDirectory(projectName string) error {
 	ofertaPath, err := GetProjectOfertaPath(projectName)
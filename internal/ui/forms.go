@@ -174,6 +174,32 @@ func SelectWithKeys(prompt string, options map[string]string) (string, error) {
 	return selected, nil
 }
 
+// MultiSelect muestra opciones y permite seleccionar varias
+func MultiSelect(prompt, description string, options []string) ([]string, error) {
+	var selected []string
+
+	opts := make([]huh.Option[string], len(options))
+	for i, opt := range options {
+		opts[i] = huh.NewOption(opt, opt)
+	}
+
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title(prompt).
+				Description(description).
+				Options(opts...).
+				Value(&selected),
+		),
+	).WithTheme(getTheme())
+
+	if err := form.Run(); err != nil {
+		return nil, err
+	}
+
+	return selected, nil
+}
+
 // Confirm muestra una confirmación
 func Confirm(message string) (bool, error) {
 	var confirmed bool
@@ -263,6 +289,67 @@ func NewProjectForm() (*ProjectForm, error) {
 	return form, nil
 }
 
+// TenantForm represents the company data of a tenant profile
+type TenantForm struct {
+	Name            string
+	NombreComercial string
+	RazonSocial     string
+	RNC             string
+	Direccion       string
+	Ubicacion       string
+	Logo            string
+	LogoPropuesta   string
+	QRCode          string
+}
+
+// NewTenantForm shows a form for a tenant profile, prefilled with form.
+// validName checks the profile name.
+func NewTenantForm(form *TenantForm, validName func(string) error) error {
+	f := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Nombre del Perfil").
+				Placeholder("Ej: dapec").
+				Validate(validName).
+				Value(&form.Name),
+			huh.NewInput().
+				Title("Nombre Comercial").
+				Placeholder("Ej: DAPEC").
+				Value(&form.NombreComercial),
+			huh.NewInput().
+				Title("Razón Social").
+				Placeholder("Ej: DAPEC SRL").
+				Value(&form.RazonSocial),
+			huh.NewInput().
+				Title("RNC").
+				Placeholder("Ej: 131-00000-1").
+				Value(&form.RNC),
+			huh.NewInput().
+				Title("Dirección").
+				Value(&form.Direccion),
+			huh.NewInput().
+				Title("Ubicación").
+				Placeholder("Ej: Santo Domingo, DN").
+				Value(&form.Ubicacion),
+		),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("URL del Logo (presupuestos)").
+				Placeholder("Ej: https://r2.or-gm.com/dapec.png").
+				Value(&form.Logo),
+			huh.NewInput().
+				Title("URL del Logo (propuestas)").
+				Description("Vacío usa el logo de presupuestos").
+				Value(&form.LogoPropuesta),
+			huh.NewInput().
+				Title("URL del Código QR").
+				Value(&form.QRCode),
+		),
+	).WithTheme(getTheme())
+
+	return f.Run()
+}
+
 // NewPresupuestoForm shows a form for entering project description for budget generation
 func NewPresupuestoForm() (string, error) {
 	var descripcion string
@@ -284,3 +371,57 @@ func NewPresupuestoForm() (string, error) {
 	return descripcion, nil
 }
 
+// NewRefineForm shows a form for requesting changes to an existing proposal
+func NewRefineForm() (string, error) {
+	var instruccion string
+
+	f := huh.NewForm(
+		huh.NewGroup(
+			huh.NewText().
+				Title("Cambios a la Propuesta").
+				Description("Se editará el documento actual, no se generará de nuevo").
+				Placeholder("Ej: sube el monto del ítem 2 a RD$ 150,000").
+				CharLimit(10000).
+				Value(&instruccion),
+		),
+	).WithTheme(getTheme())
+
+	if err := f.Run(); err != nil {
+		return "", err
+	}
+
+	return instruccion, nil
+}
+
+// ResolveMergeConflict shows both versions of a conflicting region and
+// returns "usuario", "nuevo" or "ambos"
+func ResolveMergeConflict(file, user, updated string) (string, error) {
+	fmt.Println(HeaderStyle.Render("Conflicto en " + file))
+	fmt.Println()
+	fmt.Println(PromptStyle.Render("Tu versión:"))
+	fmt.Println(ErrorStyle.Render(user))
+	fmt.Println()
+	fmt.Println(PromptStyle.Render("Nueva versión:"))
+	fmt.Println(SuccessStyle.Render(updated))
+	fmt.Println()
+
+	var selected string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("¿Qué versión conservar?").
+				Options(
+					huh.NewOption("Mantener mi versión", "usuario"),
+					huh.NewOption("Usar la nueva versión", "nuevo"),
+					huh.NewOption("Conservar ambas (mía primero)", "ambos"),
+				).
+				Value(&selected),
+		),
+	).WithTheme(getTheme())
+
+	if err := form.Run(); err != nil {
+		return "", err
+	}
+
+	return selected, nil
+}
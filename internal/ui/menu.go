@@ -2,6 +2,8 @@ package ui
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/huh"
 )
@@ -16,11 +18,16 @@ type MenuOption struct {
 func MainMenuOptions() []MenuOption {
 	return []MenuOption{
 		{Label: "📝 Nueva Propuesta", Value: "new"},
+		{Label: "✏️  Refinar Propuesta", Value: "refinar"},
 		{Label: "💰 Generar Presupuesto", Value: "presupuesto"},
+		{Label: "🧮 Recalcular Presupuesto", Value: "recalcular"},
+		{Label: "🧾 Generar Cotización (HTML)", Value: "cotizacion"},
 		{Label: "📂 Crear Proyecto", Value: "proyecto"},
 		{Label: "📋 Listar Proyectos", Value: "list"},
 		{Label: "📊 Resumen de Propuestas", Value: "resumen"},
 		{Label: "💰 Resumen de Presupuestos", Value: "resumen_presupuestos"},
+		{Label: "💵 Costos de IA", Value: "costos"},
+		{Label: "🩺 Diagnóstico", Value: "doctor"},
 		{Label: "⚙️  Configuración", Value: "config"},
 		{Label: "❌ Salir", Value: "exit"},
 	}
@@ -31,11 +38,16 @@ func ConfigMenuOptions() []MenuOption {
 	return []MenuOption{
 		{Label: "🔑 Configurar API Key", Value: "apikey"},
 		{Label: "🤖 Seleccionar Modelo", Value: "model"},
+		{Label: "🔌 Seleccionar Proveedor de IA", Value: "provider"},
+		{Label: "🏢 Seleccionar Empresa (Tenant)", Value: "tenant"},
 		{Label: "📁 Configurar Carpeta Base", Value: "folder"},
 		{Label: "📄 Actualizar Template (CSS)", Value: "css"},
 		{Label: "📄 Actualizar Prompt (YAML)", Value: "yaml"},
 		{Label: "💰 Actualizar Presupuesto (YAML)", Value: "presupuesto_yaml"},
 		{Label: "🖼️  Actualizar Logo", Value: "logo"},
+		{Label: "🔍 Comparar con Originales", Value: "diff"},
+		{Label: "♻️  Restablecer Archivo", Value: "reset"},
+		{Label: "🔄 Sincronizar Plantillas", Value: "sync"},
 		{Label: "⬅️  Volver", Value: "back"},
 	}
 }
@@ -122,15 +134,42 @@ func ShowProjectList(projects []string) (string, error) {
 	return selected, nil
 }
 
+// ModelOption represents a model of the catalog for display.
+// Zero values mean the metadata is unknown.
+type ModelOption struct {
+	ID              string
+	DisplayName     string
+	ContextWindow   int64
+	MaxOutputTokens int64
+	InputPrice      float64
+	OutputPrice     float64
+	Priced          bool
+}
+
+// Label returns the selector label with the known metadata
+func (m ModelOption) Label() string {
+	label := m.ID
+	if m.ContextWindow > 0 {
+		label += fmt.Sprintf(" | %dK contexto", m.ContextWindow/1000)
+	}
+	if m.MaxOutputTokens > 0 {
+		label += fmt.Sprintf(" | %dK salida", m.MaxOutputTokens/1000)
+	}
+	if m.Priced {
+		label += fmt.Sprintf(" | $%g/$%g por MTok", m.InputPrice, m.OutputPrice)
+	}
+	return label
+}
+
 // ShowModelSelector displays a model selector and returns the selected model
-func ShowModelSelector(models []string, currentModel string) (string, error) {
+func ShowModelSelector(models []ModelOption, currentModel string) (string, error) {
 	opts := make([]huh.Option[string], len(models))
 	for i, model := range models {
-		label := model
-		if model == currentModel {
-			label = model + " (actual)"
+		label := model.Label()
+		if model.ID == currentModel {
+			label += " (actual)"
 		}
-		opts[i] = huh.NewOption(label, model)
+		opts[i] = huh.NewOption(label, model.ID)
 	}
 
 	var selected string
@@ -150,6 +189,106 @@ func ShowModelSelector(models []string, currentModel string) (string, error) {
 	return selected, nil
 }
 
+// ShowProviderSelector displays a provider selector and returns the selected provider
+func ShowProviderSelector(providers []string, currentProvider string) (string, error) {
+	opts := make([]huh.Option[string], len(providers))
+	for i, provider := range providers {
+		label := provider
+		if provider == currentProvider {
+			label = provider + " (actual)"
+		}
+		opts[i] = huh.NewOption(label, provider)
+	}
+
+	var selected string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Seleccionar Proveedor de IA").
+				Options(opts...).
+				Value(&selected),
+		),
+	).WithTheme(getTheme())
+
+	if err := form.Run(); err != nil {
+		return "", err
+	}
+
+	return selected, nil
+}
+
+// Tenant selector actions
+const (
+	TenantSelect = "select"
+	TenantNew    = "new"
+	TenantEdit   = "edit"
+	TenantBack   = "back"
+)
+
+// TenantChoice is the outcome of the tenant selector. Name is set for
+// TenantSelect; keeping the action apart lets a profile be named like one.
+type TenantChoice struct {
+	Action string
+	Name   string
+}
+
+// ShowTenantSelector displays the tenant profiles and returns the selected
+// one, or the action to add a profile or edit the current one
+func ShowTenantSelector(tenants []string, currentTenant string) (TenantChoice, error) {
+	opts := make([]huh.Option[TenantChoice], 0, len(tenants)+3)
+	for _, tenant := range tenants {
+		label := tenant
+		if tenant == currentTenant {
+			label = tenant + " (actual)"
+		}
+		opts = append(opts, huh.NewOption(label, TenantChoice{Action: TenantSelect, Name: tenant}))
+	}
+	opts = append(opts,
+		huh.NewOption("➕ Nueva Empresa", TenantChoice{Action: TenantNew}),
+		huh.NewOption("✏️  Editar Empresa Actual", TenantChoice{Action: TenantEdit}),
+		huh.NewOption("⬅️ Volver", TenantChoice{Action: TenantBack}),
+	)
+
+	var selected TenantChoice
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[TenantChoice]().
+				Title("Seleccionar Empresa (Tenant)").
+				Description("Datos de la empresa usados en propuestas y presupuestos").
+				Options(opts...).
+				Value(&selected),
+		),
+	).WithTheme(getTheme())
+
+	if err := form.Run(); err != nil {
+		return TenantChoice{}, err
+	}
+
+	return selected, nil
+}
+
+// Setting represents the effective value of a setting for display
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// ShowSettings prints every setting with the source of its value
+func ShowSettings(settings []Setting) {
+	fmt.Println(HeaderStyle.Render("Configuración Efectiva"))
+	fmt.Println()
+	fmt.Println(PromptStyle.Render(fmt.Sprintf("  %-32s %-36s %s", "Clave", "Valor", "Origen")))
+
+	for _, setting := range settings {
+		value := setting.Value
+		if value == "" {
+			value = "(vacío)"
+		}
+		fmt.Println(MenuItemStyle.Render(fmt.Sprintf("%-32s %-36s %s", setting.Key, value, setting.Source)))
+	}
+}
+
 // ProposalSummary represents a proposal summary for display
 type ProposalSummary struct {
 	Project  string
@@ -165,6 +304,141 @@ type PresupuestoSummary struct {
 	FilePath string
 }
 
+// CostSummary represents the AI spend of a month, project or model
+type CostSummary struct {
+	Key          string
+	Generations  int
+	InputTokens  int64
+	OutputTokens int64
+	Cost         float64
+	// Unpriced counts generations whose model has no price configured
+	Unpriced int
+}
+
+// ShowCostSummaries prints a table of cost summaries
+func ShowCostSummaries(title string, summaries []CostSummary) {
+	if len(summaries) == 0 {
+		PrintWarning("No hay generaciones registradas")
+		return
+	}
+
+	fmt.Println(HeaderStyle.Render(title))
+	fmt.Println()
+	fmt.Println(PromptStyle.Render(fmt.Sprintf("  %-40s %6s %12s %12s %12s", "", "Gen.", "Entrada", "Salida", "USD")))
+
+	var total CostSummary
+	for _, summary := range summaries {
+		key := summary.Key
+		if key == "" {
+			key = "(sin nombre)"
+		}
+		fmt.Println(MenuItemStyle.Render(fmt.Sprintf("%-40s %6d %12d %12d %12.4f", key, summary.Generations, summary.InputTokens, summary.OutputTokens, summary.Cost)))
+
+		total.Generations += summary.Generations
+		total.InputTokens += summary.InputTokens
+		total.OutputTokens += summary.OutputTokens
+		total.Cost += summary.Cost
+		total.Unpriced += summary.Unpriced
+	}
+
+	fmt.Println(TitleStyle.Render(fmt.Sprintf("  %-40s %6d %12d %12d %12.4f", "TOTAL", total.Generations, total.InputTokens, total.OutputTokens, total.Cost)))
+
+	if total.Unpriced > 0 {
+		PrintWarning(fmt.Sprintf("%d generaciones sin precio configurado para su modelo", total.Unpriced))
+	}
+}
+
+// BatchResult represents the outcome of one entry of a batch for display
+type BatchResult struct {
+	Project      string
+	Output       string
+	Error        string
+	Warning      string
+	Duration     time.Duration
+	InputTokens  int64
+	OutputTokens int64
+}
+
+// ShowBatchReport prints the success and failure report of a batch
+func ShowBatchReport(results []BatchResult) {
+	fmt.Println(HeaderStyle.Render("Reporte del Lote"))
+	fmt.Println()
+
+	var failed int
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+			PrintError(fmt.Sprintf("%s: %s", result.Project, result.Error))
+			continue
+		}
+		PrintSuccess(fmt.Sprintf("%s (%s, %d/%d tokens) → %s", result.Project, result.Duration.Round(time.Second), result.InputTokens, result.OutputTokens, result.Output))
+		if result.Warning != "" {
+			PrintWarning(fmt.Sprintf("%s: %s", result.Project, result.Warning))
+		}
+	}
+
+	fmt.Println()
+	summary := fmt.Sprintf("%d exitosos, %d fallidos de %d", len(results)-failed, failed, len(results))
+	if failed > 0 {
+		PrintWarning(summary)
+		return
+	}
+	fmt.Println(TitleStyle.Render(summary))
+}
+
+// ComparisonOption represents the draft of one model in a comparison
+type ComparisonOption struct {
+	Model    string
+	Duration time.Duration
+	Cost     float64
+	Priced   bool
+	Error    string
+}
+
+// Label returns the model with its latency and cost
+func (c ComparisonOption) Label() string {
+	cost := "sin precio"
+	if c.Priced {
+		cost = fmt.Sprintf("US$ %.4f", c.Cost)
+	}
+	return fmt.Sprintf("%s | %s | %s", c.Model, c.Duration.Round(time.Second), cost)
+}
+
+// ShowComparisonSelector displays the drafts of a comparison and returns the
+// model to promote, or "back" to keep the current proposal
+func ShowComparisonSelector(options []ComparisonOption) (string, error) {
+	var opts []huh.Option[string]
+	for _, option := range options {
+		if option.Error != "" {
+			PrintError(fmt.Sprintf("%s: %s", option.Model, option.Error))
+			continue
+		}
+		opts = append(opts, huh.NewOption(option.Label(), option.Model))
+	}
+	if len(opts) == 0 {
+		PrintWarning("Ninguna variante se generó correctamente")
+		return "back", nil
+	}
+	opts = append(opts, huh.NewOption("⬅️ Volver", "back"))
+
+	var selected string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Seleccionar Propuesta Ganadora").
+				Description("Compara las variantes en propuesta.comparacion.html").
+				Options(opts...).
+				Value(&selected),
+		),
+	).WithTheme(getTheme())
+
+	if err := form.Run(); err != nil {
+		return "", err
+	}
+
+	return selected, nil
+}
+
 // ShowProposalSummaries displays a list of proposal summaries
 func ShowProposalSummaries(summaries []ProposalSummary) (string, error) {
 	if len(summaries) == 0 {
@@ -227,3 +501,154 @@ func ShowPresupuestoSummaries(summaries []PresupuestoSummary) (string, error) {
 	return selected, nil
 }
 
+// TemplateUpgrade represents the outcome of upgrading a template for display
+type TemplateUpgrade struct {
+	File      string
+	Result    string
+	Conflicts int
+}
+
+// ShowTemplateUpgrades prints the outcome of a template upgrade
+func ShowTemplateUpgrades(upgrades []TemplateUpgrade) {
+	fmt.Println(HeaderStyle.Render("Actualización de Plantillas"))
+	fmt.Println()
+
+	for _, upgrade := range upgrades {
+		msg := fmt.Sprintf("%s: %s", upgrade.File, upgrade.Result)
+		if upgrade.Conflicts > 0 {
+			msg += fmt.Sprintf(" (%d)", upgrade.Conflicts)
+		}
+		if upgrade.Result == "personalizado sin versión base" {
+			PrintWarning(msg + "; revisa con 'orgmprop config diff'")
+			continue
+		}
+		PrintSuccess(msg)
+	}
+}
+
+// TemplateChange is a row of ShowTemplateChanges
+type TemplateChange struct {
+	File   string
+	Status string
+}
+
+// ShowTemplateChanges prints the files changed by a template sync. With
+// dryRun the files are only listed.
+func ShowTemplateChanges(source string, changes []TemplateChange, dryRun bool) {
+	fmt.Println(HeaderStyle.Render("Sincronización de Plantillas"))
+	fmt.Println(InfoStyle.Render("Fuente: " + source))
+	fmt.Println()
+
+	pending := 0
+	for _, change := range changes {
+		msg := fmt.Sprintf("%s: %s", change.File, change.Status)
+		if change.Status == "igual" {
+			fmt.Println(msg)
+			continue
+		}
+		pending++
+		if dryRun {
+			PrintWarning(msg)
+			continue
+		}
+		PrintSuccess(msg)
+	}
+	fmt.Println()
+
+	switch {
+	case pending == 0:
+		PrintInfo("Las plantillas ya están sincronizadas")
+	case dryRun:
+		PrintInfo(fmt.Sprintf("%d archivo(s) cambiarían. Ejecuta 'orgmprop templates sync' para aplicarlos", pending))
+	}
+}
+
+// Finding is a row of ShowFindings
+type Finding struct {
+	Check   string
+	Level   string
+	Message string
+	Hint    string
+}
+
+// ShowFindings prints the doctor findings with their fix hints
+func ShowFindings(findings []Finding) {
+	fmt.Println(HeaderStyle.Render("Diagnóstico"))
+	fmt.Println()
+
+	problems := 0
+	for _, finding := range findings {
+		msg := fmt.Sprintf("%s: %s", finding.Check, finding.Message)
+		switch finding.Level {
+		case "error":
+			PrintError(msg)
+		case "aviso":
+			PrintWarning(msg)
+		default:
+			PrintSuccess(msg)
+			continue
+		}
+		problems++
+		if finding.Hint != "" {
+			fmt.Println(InfoStyle.Render("   → " + finding.Hint))
+		}
+	}
+	fmt.Println()
+
+	if problems == 0 {
+		PrintSuccess("Todo en orden")
+		return
+	}
+	PrintWarning(fmt.Sprintf("%d problema(s) encontrado(s)", problems))
+}
+
+// TotalRow is a line of the totals of a budget
+type TotalRow struct {
+	Label  string
+	Amount string
+}
+
+// ShowRecalculation prints the corrections made to a budget and its totals
+func ShowRecalculation(file string, discrepancies []string, totals []TotalRow) {
+	fmt.Println(HeaderStyle.Render("Recalcular Presupuesto"))
+	fmt.Println(InfoStyle.Render(file))
+	fmt.Println()
+
+	if len(discrepancies) == 0 {
+		PrintSuccess("Los totales ya son correctos")
+	} else {
+		for _, discrepancy := range discrepancies {
+			PrintWarning(discrepancy)
+		}
+		fmt.Println()
+		PrintSuccess(fmt.Sprintf("%d valor(es) corregido(s); respaldo en %s.bak", len(discrepancies), file))
+	}
+	fmt.Println()
+
+	for _, total := range totals {
+		fmt.Printf("%-20s %15s\n", total.Label, total.Amount)
+	}
+	fmt.Println()
+}
+
+// ShowDiff prints a unified diff with removed lines in red and added lines in green
+func ShowDiff(title, diff string) {
+	fmt.Println(HeaderStyle.Render(title))
+	fmt.Println()
+
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Println(PromptStyle.Render(line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Println(InfoStyle.Render(line))
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(SuccessStyle.Render(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(ErrorStyle.Render(line))
+		default:
+			fmt.Println(line)
+		}
+	}
+	fmt.Println()
+}